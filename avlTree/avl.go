@@ -3,64 +3,134 @@ package avlTree
 import (
 	"LSM-Tree/core"
 	"fmt"
+	"unsafe"
 )
 
+/* 每个节点除key和value外的固定开销 */
+const nodeOverhead = int(unsafe.Sizeof(AVLNode{}))
+
 type AVLTree struct {
 	root *AVLNode
 	size int
+	/* 树占用的近似字节数，包括所有key、value和节点的开销 */
+	memUsage int
+	/* 范围删除标记，只作用于比本树更旧的数据 */
+	rangeDels []core.RangeTombstone
+	/* key的排序方式，为nil时按字节序 */
+	cmp core.Comparator
+}
+
+/* 创建一棵按cmp排序的树，零值的AVLTree按字节序排序 */
+func NewAVLTree(cmp core.Comparator) *AVLTree {
+	return &AVLTree{cmp: cmp}
+}
+
+func (t *AVLTree) Comparator() core.Comparator {
+	if t.cmp == nil {
+		return core.BytewiseComparator
+	}
+	return t.cmp
 }
 
 /** 若key存在则更新value，若key不存在则插入新节点
  * 插入成功返回1，更新成功返回0
  */
-func (t *AVLTree) Add(key string, value string) int {
+func (t *AVLTree) Add(key []byte, value []byte) int {
+	return t.AddWithExpire(key, value, 0)
+}
+
+/** 与Add相同，同时记录该键值对的过期时间（UnixNano），0表示永不过期
+ * 插入成功返回1，更新成功返回0
+ */
+func (t *AVLTree) AddWithExpire(key []byte, value []byte, expireAt int64) int {
+	return t.AddElement(&core.Element{Key: key, Value: value, ExpireAt: expireAt})
+}
+
+/** 插入或更新一个元素，元素的所有字段都会被保存到节点中
+ * 插入成功返回1，更新成功返回0
+ */
+func (t *AVLTree) AddElement(e *core.Element) int {
 	var isAdd bool
-	t.root, isAdd = t.root.add(key, value)
+	var old int
+	t.root, isAdd = t.root.add(e, t.Comparator(), &old)
+	t.memUsage += e.ApproximateSize() - old
 	if isAdd {
 		t.size += 1
+		t.memUsage += nodeOverhead
 		return 1
 	}
 	return 0
 }
 
 func (t *AVLTree) BatchAdd(elems []core.Element) {
-	for _, e := range elems {
-		t.Add(e.Key, e.Value)
+	for i := range elems {
+		t.AddElement(&elems[i])
 	}
 }
 
-func (t *AVLTree) Remove(key string) {
+func (t *AVLTree) Remove(key []byte) {
 	if t.root == nil {
 		return
 	}
-	t.root = t.root.remove(key)
+	node := t.Search(key)
+	if node == nil {
+		return
+	}
+	t.memUsage -= node.Element().ApproximateSize() + nodeOverhead
+	t.size -= 1
+	t.root = t.root.remove(key, t.Comparator())
 }
 
-func (t *AVLTree) Search(key string) *AVLNode {
+func (t *AVLTree) Search(key []byte) *AVLNode {
 	if t.root == nil {
 		return nil
 	}
-	return t.root.search(key)
+	return t.root.search(key, t.Comparator())
+}
+
+/* 查找key对应的元素，查找不到时返回nil */
+func (t *AVLTree) Get(key []byte) *core.Element {
+	if node := t.Search(key); node != nil {
+		return node.Element()
+	}
+	return nil
 }
 
 /** 查找小于等于参数key的最大key对应的节点
  * 若查找不到满足的节点，则返回nil
  */
-func (t *AVLTree) LowerBound(key string) *AVLNode {
+func (t *AVLTree) LowerBound(key []byte) *AVLNode {
 	if t.root == nil {
 		return nil
 	}
-	return t.root.lowerBound(key)
+	return t.root.lowerBound(key, t.Comparator())
 }
 
 /** 查找大于参数key的最小key对应的节点
  * 若查找不到满足的节点，则返回nil
  */
-func (t *AVLTree) UpperBound(key string) *AVLNode {
+func (t *AVLTree) UpperBound(key []byte) *AVLNode {
 	if t.root == nil {
 		return nil
 	}
-	return t.root.upperBound(key)
+	return t.root.upperBound(key, t.Comparator())
+}
+
+/* 按中序返回key在[start, end)内的所有节点 */
+func (t *AVLTree) Range(start, end []byte) []*core.Element {
+	nodes := make([]*core.Element, 0)
+	t.root.rangeInorder(start, end, t.Comparator(), &nodes)
+	return nodes
+}
+
+/* 记录一个范围删除标记，树中已有的key不受影响 */
+func (t *AVLTree) AddRangeTombstone(start, end []byte) {
+	t.rangeDels = append(t.rangeDels, core.RangeTombstone{Start: start, End: end})
+	t.memUsage += len(start) + len(end)
+}
+
+func (t *AVLTree) RangeTombstones() []core.RangeTombstone {
+	return t.rangeDels
 }
 
 /* 按中序遍历整棵树并打印节点数组 */
@@ -91,29 +161,49 @@ func (t *AVLTree) Size() int {
 	return t.size
 }
 
+/* 树占用的近似字节数 */
+func (t *AVLTree) ApproximateMemoryUsage() int {
+	return t.memUsage
+}
+
 type AVLNode struct {
-	Key    string
-	Value  string
-	height int
-	left   *AVLNode
-	right  *AVLNode
+	Key   []byte
+	Value []byte
+	// 过期时间（UnixNano），0表示永不过期
+	ExpireAt int64
+	// Value是否为merge操作数
+	IsMerge bool
+	height  int
+	left    *AVLNode
+	right   *AVLNode
 }
 
-func (n *AVLNode) add(key string, value string) (node *AVLNode, isAdd bool) {
-	if key == "" {
-		fmt.Printf("empty key not supported!\n")
-		return n, false
+/* 返回节点中保存的元素的副本 */
+func (n *AVLNode) Element() *core.Element {
+	return &core.Element{
+		Key:      n.Key,
+		Value:    n.Value,
+		ExpireAt: n.ExpireAt,
+		IsMerge:  n.IsMerge,
 	}
+}
+
+/* old记录被更新的元素原来的字节数，插入新节点时不修改 */
+func (n *AVLNode) add(e *core.Element, cmp core.Comparator, old *int) (node *AVLNode, isAdd bool) {
+	key := e.Key
 	if n == nil {
-		return &AVLNode{key, value, 1, nil, nil}, true
+		return &AVLNode{key, e.Value, e.ExpireAt, e.IsMerge, 1, nil, nil}, true
 	}
 
-	if key < n.Key {
-		n.left, isAdd = n.left.add(key, value)
-	} else if key > n.Key {
-		n.right, isAdd = n.right.add(key, value)
+	if c := cmp.Compare(key, n.Key); c < 0 {
+		n.left, isAdd = n.left.add(e, cmp, old)
+	} else if c > 0 {
+		n.right, isAdd = n.right.add(e, cmp, old)
 	} else {
-		n.Value = value
+		*old = n.Element().ApproximateSize()
+		n.Value = e.Value
+		n.ExpireAt = e.ExpireAt
+		n.IsMerge = e.IsMerge
 		isAdd = false
 	}
 	// 只有isAdd==true即有新节点插入时，才进行rebalance
@@ -124,14 +214,14 @@ func (n *AVLNode) add(key string, value string) (node *AVLNode, isAdd bool) {
 
 }
 
-func (n *AVLNode) remove(key string) *AVLNode {
+func (n *AVLNode) remove(key []byte, cmp core.Comparator) *AVLNode {
 	if n == nil {
 		return nil
 	}
-	if key < n.Key {
-		n.left = n.left.remove(key)
-	} else if key > n.Key {
-		n.right = n.right.remove(key)
+	if c := cmp.Compare(key, n.Key); c < 0 {
+		n.left = n.left.remove(key, cmp)
+	} else if c > 0 {
+		n.right = n.right.remove(key, cmp)
 	} else {
 		if n.left != nil && n.right != nil {
 			// node to delete found with both children;
@@ -139,8 +229,10 @@ func (n *AVLNode) remove(key string) *AVLNode {
 			rightMinNode := n.right.findSmallest()
 			n.Key = rightMinNode.Key
 			n.Value = rightMinNode.Value
+			n.ExpireAt = rightMinNode.ExpireAt
+			n.IsMerge = rightMinNode.IsMerge
 			// delete smallest node that we replaced
-			n.right = n.right.remove(rightMinNode.Key)
+			n.right = n.right.remove(rightMinNode.Key, cmp)
 		} else if n.left != nil {
 			// node only has left child
 			n = n.left
@@ -158,47 +250,47 @@ func (n *AVLNode) remove(key string) *AVLNode {
 }
 
 // Searches for a node
-func (n *AVLNode) search(key string) *AVLNode {
+func (n *AVLNode) search(key []byte, cmp core.Comparator) *AVLNode {
 	if n == nil {
 		return nil
 	}
-	if key < n.Key {
-		return n.left.search(key)
-	} else if key > n.Key {
-		return n.right.search(key)
+	if c := cmp.Compare(key, n.Key); c < 0 {
+		return n.left.search(key, cmp)
+	} else if c > 0 {
+		return n.right.search(key, cmp)
 	} else {
 		return n
 	}
 }
 
 /* 查找小于等于参数key的最大key对应的节点 */
-func (n *AVLNode) lowerBound(key string) *AVLNode {
+func (n *AVLNode) lowerBound(key []byte, cmp core.Comparator) *AVLNode {
 	if n == nil {
 		return nil
 	}
-	if n.Key <= key {
-		rightTreeResult := n.right.lowerBound(key)
+	if cmp.Compare(n.Key, key) <= 0 {
+		rightTreeResult := n.right.lowerBound(key, cmp)
 		if rightTreeResult == nil {
 			return n
 		}
 		return rightTreeResult
 	} else {
-		return n.left.lowerBound(key)
+		return n.left.lowerBound(key, cmp)
 	}
 }
 
-func (n *AVLNode) upperBound(key string) *AVLNode {
+func (n *AVLNode) upperBound(key []byte, cmp core.Comparator) *AVLNode {
 	if n == nil {
 		return nil
 	}
-	if n.Key > key {
-		leftTreeResult := n.left.upperBound(key)
+	if cmp.Compare(n.Key, key) > 0 {
+		leftTreeResult := n.left.upperBound(key, cmp)
 		if leftTreeResult == nil {
 			return n
 		}
 		return leftTreeResult
 	} else {
-		return n.right.upperBound(key)
+		return n.right.upperBound(key, cmp)
 	}
 }
 
@@ -209,15 +301,29 @@ func (n *AVLNode) inorder(nodes *[]*core.Element) {
 	if n.left != nil {
 		n.left.inorder(nodes)
 	}
-	*nodes = append(*nodes, &core.Element{
-		Key:   n.Key,
-		Value: n.Value,
-	})
+	*nodes = append(*nodes, n.Element())
 	if n.right != nil {
 		n.right.inorder(nodes)
 	}
 }
 
+func (n *AVLNode) rangeInorder(start, end []byte, cmp core.Comparator, nodes *[]*core.Element) {
+	if n == nil {
+		return
+	}
+	afterStart := cmp.Compare(n.Key, start)
+	beforeEnd := cmp.Compare(n.Key, end) < 0
+	if afterStart > 0 {
+		n.left.rangeInorder(start, end, cmp, nodes)
+	}
+	if afterStart >= 0 && beforeEnd {
+		*nodes = append(*nodes, n.Element())
+	}
+	if beforeEnd {
+		n.right.rangeInorder(start, end, cmp, nodes)
+	}
+}
+
 func (n *AVLNode) getHeight() int {
 	if n == nil {
 		return 0
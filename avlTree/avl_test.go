@@ -2,6 +2,7 @@ package avlTree
 
 import (
 	"LSM-Tree/core"
+	"bytes"
 	"fmt"
 	"math/rand"
 	"testing"
@@ -28,21 +29,21 @@ func TestTreePerformance(t *testing.T) {
 		switch op {
 		case opAdd:
 			v := fmt.Sprintf("%d", rand.Int())
-			tree.Add(k, v)
+			tree.Add([]byte(k), []byte(v))
 			m[k] = v
 		case opRemove:
-			tree.Remove(k)
+			tree.Remove([]byte(k))
 			delete(m, k)
 		case opSearch:
-			node := tree.Search(k)
+			node := tree.Search([]byte(k))
 			tok := node != nil
 			mv, mok := m[k]
 			if tok != mok {
 				t.Errorf("Incorrect key searching. key: %v, want {ok} : {%v}, got: {%v}", k, mok, tok)
 				continue
 			}
-			if tok && node.Value != mv {
-				t.Errorf("Incorrect key searching. key: %v, want {val} : {%v}, got: {%v}", k, mv, node.Value)
+			if tok && string(node.Value) != mv {
+				t.Errorf("Incorrect key searching. key: %v, want {val} : {%v}, got: {%s}", k, mv, node.Value)
 			}
 		}
 	}
@@ -51,42 +52,128 @@ func TestTreePerformance(t *testing.T) {
 func TestLowerUpperBound(t *testing.T) {
 	tree := AVLTree{}
 	key := ""
-	val := "b"
+	val := []byte("b")
 	for i := 0; i < 5; i++ {
 		key += "x"
-		tree.Add(key, val)
+		tree.Add([]byte(key), val)
 	}
-	assert.Equal(t, true, tree.LowerBound("a") == nil)
-	assert.Equal(t, "x", tree.LowerBound("x").Key)
-	assert.Equal(t, "xxxxx", tree.LowerBound("xxxxx").Key)
-	assert.Equal(t, "xxxxx", tree.LowerBound("xxxxxxxx").Key)
-	assert.Equal(t, "xxxxx", tree.LowerBound("y").Key)
-
-	assert.Equal(t, "x", tree.UpperBound("a").Key)
-	assert.Equal(t, "xx", tree.UpperBound("x").Key)
-	assert.Equal(t, "xxxxx", tree.UpperBound("xxxx").Key)
-	assert.Equal(t, true, tree.UpperBound("xxxxx") == nil)
-	assert.Equal(t, true, tree.UpperBound("y") == nil)
+	assert.Equal(t, true, tree.LowerBound([]byte("a")) == nil)
+	assert.Equal(t, []byte("x"), tree.LowerBound([]byte("x")).Key)
+	assert.Equal(t, []byte("xxxxx"), tree.LowerBound([]byte("xxxxx")).Key)
+	assert.Equal(t, []byte("xxxxx"), tree.LowerBound([]byte("xxxxxxxx")).Key)
+	assert.Equal(t, []byte("xxxxx"), tree.LowerBound([]byte("y")).Key)
+
+	assert.Equal(t, []byte("x"), tree.UpperBound([]byte("a")).Key)
+	assert.Equal(t, []byte("xx"), tree.UpperBound([]byte("x")).Key)
+	assert.Equal(t, []byte("xxxxx"), tree.UpperBound([]byte("xxxx")).Key)
+	assert.Equal(t, true, tree.UpperBound([]byte("xxxxx")) == nil)
+	assert.Equal(t, true, tree.UpperBound([]byte("y")) == nil)
 }
 
 func TestInorder(t *testing.T) {
 	tree := AVLTree{}
 	key := ""
-	val := "b"
+	val := []byte("b")
 
 	expected := make([]*core.Element, 0)
 	for i := 0; i < 5; i++ {
 		key += "x"
-		expected = append(expected, &core.Element{Key: key, Value: val})
-		tree.Add(key, val)
+		expected = append(expected, &core.Element{Key: []byte(key), Value: val})
+		tree.Add([]byte(key), val)
 	}
 
 	got := tree.Inorder()
 	assert.Equal(t, expected, got)
 
-	e := &core.Element{Key: "xxa", Value: val}
+	e := &core.Element{Key: []byte("xxa"), Value: val}
 	expected = append(expected[:2], append([]*core.Element{e}, expected[2:]...)...)
-	tree.Add("xxa", val)
+	tree.Add([]byte("xxa"), val)
 	got = tree.Inorder()
 	assert.Equal(t, expected, got)
 }
+
+func TestAddWithExpire(t *testing.T) {
+	tree := AVLTree{}
+	tree.Add([]byte("a"), []byte("1"))
+	tree.AddWithExpire([]byte("b"), []byte("2"), 100)
+	assert.Equal(t, int64(0), tree.Search([]byte("a")).ExpireAt)
+	assert.Equal(t, int64(100), tree.Search([]byte("b")).ExpireAt)
+
+	// 更新时同时更新过期时间
+	tree.Add([]byte("b"), []byte("3"))
+	assert.Equal(t, int64(0), tree.Search([]byte("b")).ExpireAt)
+	tree.AddWithExpire([]byte("a"), []byte("4"), 200)
+	expected := []*core.Element{{Key: []byte("a"), Value: []byte("4"), ExpireAt: 200}, {Key: []byte("b"), Value: []byte("3")}}
+	assert.Equal(t, expected, tree.Inorder())
+}
+
+func TestRange(t *testing.T) {
+	tree := AVLTree{}
+	for i := 0; i < 10; i++ {
+		tree.Add([]byte(fmt.Sprintf("%d", i)), []byte("v"))
+	}
+	keys := func(elems []*core.Element) []string {
+		res := make([]string, 0)
+		for _, e := range elems {
+			res = append(res, string(e.Key))
+		}
+		return res
+	}
+	assert.Equal(t, []string{"3", "4", "5"}, keys(tree.Range([]byte("3"), []byte("6"))))
+	assert.Equal(t, []string{"0", "1"}, keys(tree.Range([]byte(""), []byte("2"))))
+	assert.Equal(t, []string{"8", "9"}, keys(tree.Range([]byte("75"), []byte("a"))))
+	assert.Equal(t, []string{}, keys(tree.Range([]byte("5"), []byte("5"))))
+}
+
+/* 按字节序逆序排列 */
+type reverseComparator struct{}
+
+func (reverseComparator) Compare(a, b []byte) int { return bytes.Compare(b, a) }
+func (reverseComparator) Name() string            { return "test.ReverseComparator" }
+func (reverseComparator) FindShortestSeparator(start, limit []byte) []byte {
+	return start
+}
+func (reverseComparator) FindShortSuccessor(key []byte) []byte { return key }
+
+func TestCustomComparator(t *testing.T) {
+	tree := NewAVLTree(reverseComparator{})
+	for _, k := range []string{"b", "a", "c"} {
+		tree.Add([]byte(k), []byte(k))
+	}
+	keys := make([]string, 0)
+	for _, e := range tree.Inorder() {
+		keys = append(keys, string(e.Key))
+	}
+	assert.Equal(t, []string{"c", "b", "a"}, keys)
+	assert.Equal(t, []byte("c"), tree.LowerBound([]byte("bb")).Key)
+	assert.Equal(t, []byte("a"), tree.UpperBound([]byte("b")).Key)
+}
+
+/* 空key是合法的最小key */
+func TestEmptyKey(t *testing.T) {
+	tree := AVLTree{}
+	assert.Equal(t, 1, tree.Add([]byte("a"), []byte("1")))
+	assert.Equal(t, 1, tree.Add([]byte{}, []byte("empty")))
+	assert.Equal(t, 0, tree.Add(nil, []byte("nil")))
+	assert.Equal(t, 2, tree.Size())
+	assert.Equal(t, []byte("nil"), tree.Search([]byte{}).Value)
+	assert.Equal(t, 0, len(tree.Inorder()[0].Key))
+	assert.Equal(t, true, tree.LowerBound([]byte{}) != nil)
+	assert.Equal(t, []byte("a"), tree.UpperBound(nil).Key)
+}
+
+func TestApproximateMemoryUsage(t *testing.T) {
+	tree := NewAVLTree(nil)
+	assert.Equal(t, 0, tree.ApproximateMemoryUsage())
+	tree.Add([]byte("key"), []byte("value"))
+	one := tree.ApproximateMemoryUsage()
+	assert.Less(t, len("key")+len("value"), one)
+	// 更新时只计算value的变化
+	tree.Add([]byte("key"), make([]byte, 100))
+	assert.Equal(t, one+100-len("value"), tree.ApproximateMemoryUsage())
+	tree.AddRangeTombstone([]byte("a"), []byte("b"))
+	assert.Equal(t, one+100-len("value")+2, tree.ApproximateMemoryUsage())
+	tree.Remove([]byte("key"))
+	assert.Equal(t, 2, tree.ApproximateMemoryUsage())
+	assert.Equal(t, 0, tree.Size())
+}
@@ -1,22 +1,125 @@
 package config
 
+import (
+	"time"
+
+	"LSM-Tree/core"
+	log "LSM-Tree/log"
+	"LSM-Tree/vfs"
+)
+
+/* 磁盘文件的归并方式 */
+type CompactionStyle int
+
+const (
+	// 分层归并：level-0文件数量达到上限时向level-1合并
+	CompactionStyleLevel CompactionStyle = iota
+	// 先进先出：所有文件都留在level-0，不做任何重写，总体积超过上限或文件过期时直接删除最旧的文件
+	CompactionStyleFIFO
+)
+
+/* 内存中的树的实现方式 */
+type MemtableType int
+
+const (
+	// AVL树，读写都需要加锁
+	MemtableAVLTree MemtableType = iota
+	// 并发跳表，读者无需加锁，不会被写者阻塞，但可能看到写入了一部分的WriteBatch
+	MemtableSkipList
+)
+
+/** 磁盘文件数据块的压缩方式，均使用Go标准库中的实现
+ * 每个数据块的第一个字节记录该块的压缩方式，因此各值写入文件后不能再修改
+ */
+type CompressionType byte
+
+const (
+	NoCompression CompressionType = iota
+	// compress/flate
+	FlateCompression
+	// compress/zlib
+	ZlibCompression
+	// compress/gzip
+	GzipCompression
+	// compress/lzw，LSB顺序，8位字面量
+	LZWCompression
+)
+
 type Config struct {
 	// 特殊的value值，当访问到的Elem的value值等于该值时，表示该key被删除
 	DeleteValue string
-	// 该值为true时，log日志中会有每个键的详细操作记录
-	IsTracing bool
+	// 日志输出，为nil时不输出任何日志
+	Logger log.Logger
+	// 以该前缀开头的key会以Debug级别输出详细操作记录，nil表示不跟踪，可在运行时通过LSMTree.SetTracePrefix修改
+	TraceKeyPrefix []byte
 
 	// 磁盘文件
-	// 每隔多少个元素建立一个索引节点
+	// 每隔多少个元素建立一个索引节点，即每个数据块中的元素个数
 	IndexDistance int
-	// 内存中的树的能存储的最大键值对个数，容量满时flush到一个level-0文件，清空内存中的树
-	ElemCnt2Flush int
+	// 分区索引中每个分区的索引项个数，文件的索引项超过该值时使用两级索引，顶层索引只记录各个分区，0表示不分区
+	IndexPartitionSize int
+	// 非空时每个磁盘文件写入该目录下的文件，并以只读方式映射到内存中读取，冷数据由操作系统的页缓存而不是Go的堆保存
+	// FS不支持映射时文件内容仍保存在Go的堆中
+	MmapDir string
+	// 每层磁盘文件所在的目录，下标即层级，层级超出长度时使用最后一项，为空时所有层都使用MmapDir
+	// 例如level0的文件放在快速的磁盘上，level1放在容量大的慢速磁盘上；只有level0和level1有文件，最多设置两项
+	LevelDirs []string
+	// 各目录中磁盘文件总字节数的上限，超过时通过EventListener报告该目录已满，但不会阻止写入，未列出的目录不限制，路径按filepath.Clean后比较
+	DirCapacity map[string]int64
+	// LSMTree读写的所有文件都通过它访问，默认为操作系统的文件系统
+	FS vfs.FS
+	// 非空时每次写入先追加到该目录下的预写日志，打开时重放其中尚未flush的数据，为空时不写日志
+	WALDir string
+	// 大于0时后台每隔该时长Sync一次日志，不要求Sync的写入在断电时最多丢失该时长内的数据
+	WALSyncInterval time.Duration
+	// 非nil时以其当前密钥用AES-GCM按块加密新的磁盘文件，归并时旧文件的数据以当前密钥重新加密，从而完成密钥轮换
+	KeyProvider core.KeyProvider
+	// 每层磁盘文件的数据块压缩方式，下标即层级，层级超出长度时使用最后一项，为空时不压缩
+	Compression []CompressionType
+	// 内存中的树的字节数上限，包括key、value和节点的开销，达到上限时flush到一个level-0文件，清空内存中的树
+	WriteBufferSize int
+	// 内存中的树的实现方式
+	MemtableType MemtableType
 	// level-0文件数量上限，达到上限时向level-1合并
 	MaxLevel0FileCnt int
-	// Level-1+ 每个文件的最大体积，单位是键值对个数
+	// Level-1+ 每个文件的目标体积，单位是字节，归并时写满该体积后开始写下一个文件
 	LevelLFileSize int
 	// 磁盘层级个数,包括level0
 	FileLevelCnt int
+
+	// 归并方式，默认为分层归并
+	CompactionStyle CompactionStyle
+	// FIFO模式下所有磁盘文件的总体积上限，单位是字节，超过后从最旧的文件开始删除，0表示不限制
+	FIFOMaxTotalSize int
+	// FIFO模式下文件的存活时间，文件创建时间早于该时长的文件不再被读取，并在flush时或由后台线程定期删除，0表示不限制
+	FIFOTTL time.Duration
+
+	// key的排序方式，内存中的树、磁盘文件和归并都使用该排序方式；清单和每个磁盘文件都记录其名称，用不同名称的排序方式打开时返回ErrInvalidArgument
+	Comparator core.Comparator
+
+	// 合并Merge写入的操作数的方式，为nil时不支持Merge；打开时在重放日志之前设置，日志中有merge操作数时必须设置
+	MergeOperator core.MergeOperator
+
+	// key的最大字节数，空key是合法的最小key，0表示不限制
+	MaxKeySize int
+	// value和merge操作数的最大字节数，0表示不限制
+	MaxValueSize int
+}
+
+/* 返回level层的磁盘文件使用的压缩方式 */
+func (c *Config) CompressionForLevel(level int) CompressionType {
+	if len(c.Compression) == 0 {
+		return NoCompression
+	}
+	return c.Compression[min(level, len(c.Compression)-1)]
+}
+
+/* 返回level层的磁盘文件所在的目录，为空表示文件只保存在内存中 */
+func (c *Config) DirForLevel(level int) string {
+	if len(c.LevelDirs) == 0 {
+		return c.MmapDir
+	}
+	return c.LevelDirs[min(level, len(c.LevelDirs)-1)]
 }
 
 var (
@@ -27,12 +130,19 @@ func DefaultConfig() *Config {
 	if defaultConfig == nil {
 		defaultConfig = &Config{
 			DeleteValue:      "DeleteValue",
-			IsTracing:        false,
 			IndexDistance:    10,
-			ElemCnt2Flush:    10000,
+			WriteBufferSize:  4 << 20,
+			MemtableType:     MemtableAVLTree,
 			MaxLevel0FileCnt: 4,
-			LevelLFileSize:   40000,
+			LevelLFileSize:   16 << 20,
 			FileLevelCnt:     5,
+			CompactionStyle:  CompactionStyleLevel,
+			FIFOMaxTotalSize: 0,
+			FIFOTTL:          0,
+			Comparator:       core.BytewiseComparator,
+			FS:               vfs.Default,
+			MaxKeySize:       1 << 16,
+			MaxValueSize:     1 << 24,
 		}
 	}
 	return defaultConfig
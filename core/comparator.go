@@ -0,0 +1,63 @@
+package core
+
+import "bytes"
+
+/** 定义key的全序关系，内存中的树、磁盘文件的索引、合并和归并都使用同一个Comparator
+ * Name用于标识排序方式，按某种排序方式写入的数据不能用另一种排序方式读取
+ */
+type Comparator interface {
+	/* a < b 返回负数，a == b 返回0，a > b 返回正数 */
+	Compare(a, b []byte) int
+	Name() string
+	/* 返回一个尽量短的key，满足 start <= key < limit，要求 start < limit */
+	FindShortestSeparator(start, limit []byte) []byte
+	/* 返回一个尽量短的key，满足 key >= 参数key */
+	FindShortSuccessor(key []byte) []byte
+}
+
+/* 按字节序比较key */
+type bytewiseComparator struct{}
+
+var BytewiseComparator Comparator = bytewiseComparator{}
+
+func (bytewiseComparator) Compare(a, b []byte) int {
+	return bytes.Compare(a, b)
+}
+
+func (bytewiseComparator) Name() string {
+	return "lsmt.BytewiseComparator"
+}
+
+func (bytewiseComparator) FindShortestSeparator(start, limit []byte) []byte {
+	// 找到公共前缀之后的第一个不同字节，若将其加一后仍小于limit，则截断到该字节
+	n := len(start)
+	if len(limit) < n {
+		n = len(limit)
+	}
+	diff := 0
+	for diff < n && start[diff] == limit[diff] {
+		diff++
+	}
+	if diff >= n {
+		// 一个key是另一个key的前缀，无法缩短
+		return append([]byte{}, start...)
+	}
+	if b := start[diff]; b < 0xff && b+1 < limit[diff] {
+		sep := append([]byte{}, start[:diff+1]...)
+		sep[diff]++
+		return sep
+	}
+	return append([]byte{}, start...)
+}
+
+func (bytewiseComparator) FindShortSuccessor(key []byte) []byte {
+	// 找到第一个不是0xff的字节，加一后截断
+	for i, b := range key {
+		if b != 0xff {
+			succ := append([]byte{}, key[:i+1]...)
+			succ[i]++
+			return succ
+		}
+	}
+	return append([]byte{}, key...)
+}
@@ -0,0 +1,24 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBytewiseComparator(t *testing.T) {
+	cmp := BytewiseComparator
+	assert.Equal(t, -1, cmp.Compare([]byte("a"), []byte("b")))
+	assert.Equal(t, 0, cmp.Compare([]byte("a"), []byte("a")))
+	assert.Equal(t, 1, cmp.Compare([]byte{0x01, 0x00}, []byte{0x01}))
+
+	assert.Equal(t, []byte("abd"), cmp.FindShortestSeparator([]byte("abcxyz"), []byte("abzzz")))
+	// 相邻字节无法缩短
+	assert.Equal(t, []byte("abc1"), cmp.FindShortestSeparator([]byte("abc1"), []byte("abd")))
+	// 前缀关系无法缩短
+	assert.Equal(t, []byte("ab"), cmp.FindShortestSeparator([]byte("ab"), []byte("abc")))
+
+	assert.Equal(t, []byte("b"), cmp.FindShortSuccessor([]byte("abc")))
+	assert.Equal(t, []byte{0xff, 0x01}, cmp.FindShortSuccessor([]byte{0xff, 0x00, 0x05}))
+	assert.Equal(t, []byte{0xff, 0xff}, cmp.FindShortSuccessor([]byte{0xff, 0xff}))
+}
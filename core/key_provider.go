@@ -0,0 +1,56 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+)
+
+/** 提供加密磁盘文件的密钥，每个密钥由一个ID标识，密钥长度为16、24或32字节，分别对应AES-128、AES-192和AES-256
+ * 新文件使用CurrentKey加密，并在文件尾记录密钥的ID，读取时按ID取回密钥
+ * 轮换密钥后，旧的密钥需继续可以通过Key取得，直到用它加密的文件都被归并重写
+ */
+type KeyProvider interface {
+	/* 返回加密新文件使用的密钥及其ID */
+	CurrentKey() (id string, key []byte, err error)
+	/* 返回ID为id的密钥，不存在时返回错误 */
+	Key(id string) ([]byte, error)
+}
+
+/* 在内存中保存所有密钥的KeyProvider，可被多个线程并发调用 */
+type MemKeyProvider struct {
+	mu      sync.RWMutex
+	keys    map[string][]byte
+	current string
+}
+
+func NewMemKeyProvider() *MemKeyProvider {
+	return &MemKeyProvider{keys: make(map[string][]byte)}
+}
+
+/* 添加一个密钥并将其设为当前密钥，之前的密钥仍可用于解密 */
+func (p *MemKeyProvider) Rotate(id string, key []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys[id] = append([]byte{}, key...)
+	p.current = id
+}
+
+func (p *MemKeyProvider) CurrentKey() (string, []byte, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	key, ok := p.keys[p.current]
+	if !ok {
+		return "", nil, fmt.Errorf("no current key")
+	}
+	return p.current, key, nil
+}
+
+func (p *MemKeyProvider) Key(id string) ([]byte, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	key, ok := p.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("key %q not found", id)
+	}
+	return key, nil
+}
@@ -0,0 +1,26 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemKeyProvider(t *testing.T) {
+	p := NewMemKeyProvider()
+	_, _, err := p.CurrentKey()
+	assert.NotNil(t, err)
+
+	p.Rotate("k1", []byte("0123456789abcdef"))
+	p.Rotate("k2", []byte("fedcba9876543210"))
+	id, key, err := p.CurrentKey()
+	assert.Nil(t, err)
+	assert.Equal(t, "k2", id)
+	assert.Equal(t, []byte("fedcba9876543210"), key)
+	// 轮换后旧的密钥仍可取得
+	key, err = p.Key("k1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("0123456789abcdef"), key)
+	_, err = p.Key("k3")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,13 @@
+package core
+
+/** 用户自定义的合并操作，用于实现无需先读后写的read-modify-write
+ * Merge写入的操作数会与同一个key的更旧的记录合并，合并发生在Get、写入内存中的树和compact时
+ * 同一个key的相邻操作数必须能通过PartialMerge合并成一个，即合并操作需满足结合律
+ */
+type MergeOperator interface {
+	/* 将操作数按从旧到新的顺序作用在existing上，existing为nil表示该key没有更旧的value */
+	FullMerge(key []byte, existing []byte, operands [][]byte) ([]byte, error)
+	/* 将两个相邻的操作数合并成一个，left比right旧 */
+	PartialMerge(key []byte, left, right []byte) ([]byte, error)
+	Name() string
+}
@@ -1,5 +1,29 @@
 package core
 
 type Element struct {
-	Key, Value string
+	Key, Value []byte
+	// 过期时间（UnixNano），0表示永不过期
+	ExpireAt int64
+	// 为true时Value是一个merge操作数，需与更旧的记录合并后才能得到完整的value
+	IsMerge bool
+}
+
+/* 判断该元素在给定时间（UnixNano）是否已过期 */
+func (e *Element) IsExpired(now int64) bool {
+	return e.ExpireAt > 0 && e.ExpireAt <= now
+}
+
+/* 范围删除标记，表示[Start, End)内的所有key在更旧的数据中均已被删除 */
+type RangeTombstone struct {
+	Start, End []byte
+}
+
+func (r *RangeTombstone) Covers(cmp Comparator, key []byte) bool {
+	return cmp.Compare(r.Start, key) <= 0 && cmp.Compare(key, r.End) < 0
+}
+
+/* 元素的近似字节数，包括key、value以及过期时间等固定字段，不包括所在数据结构的开销 */
+func (e *Element) ApproximateSize() int {
+	// ExpireAt占8字节，IsMerge占1字节
+	return len(e.Key) + len(e.Value) + 9
 }
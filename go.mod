@@ -1,16 +1,19 @@
 module LSM-Tree
 
-go 1.17
+go 1.21
+
+require (
+	github.com/inconshreveable/log15 v2.16.0+incompatible
+	github.com/stretchr/testify v1.8.4
+)
 
 require (
 	github.com/Workiva/go-datastructures v1.1.0 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/go-stack/stack v1.8.1 // indirect
-	github.com/inconshreveable/log15 v2.16.0+incompatible // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.16 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/stretchr/testify v1.8.4 // indirect
 	golang.org/x/sys v0.8.0 // indirect
 	golang.org/x/term v0.8.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
@@ -1,66 +1,21 @@
 package lsmt
 
-import (
-	"LSM-Tree/config"
-	"os"
-	"path/filepath"
-
-	log "github.com/inconshreveable/log15"
-)
-
-var (
-	logFile = "logfile.log"
-	Logger  log.Logger
-)
-
-func init() {
-	wd, err := os.Getwd()
-	if err != nil {
-		panic(err)
-	}
-	logFile = filepath.Join(wd, logFile)
-	// 创建日志输出文件
-	_, err = os.Create(logFile)
-	if err != nil {
-		panic(err)
-	}
-	// 设置日志
-	handler, err := log.FileHandler(logFile, log.LogfmtFormat())
-	if err != nil {
-		panic(err)
-	}
-	log.Root().SetHandler(log.CallerFileHandler(handler))
-	// 使用日志
-	log.Debug("第一条日志")
-
-	Logger = log.Root()
+/** 日志接口，ctx为交替出现的键和值
+ * 方法与log15.Logger一致，log15.Logger可直接使用；slog.Logger可通过NewSlogLogger转换
+ */
+type Logger interface {
+	Debug(msg string, ctx ...interface{})
+	Info(msg string, ctx ...interface{})
+	Warn(msg string, ctx ...interface{})
+	Error(msg string, ctx ...interface{})
 }
 
-/* 一些比debug信息更细的内容用此函数打印，只在需要跟踪某个key时打印，其余时候不打印 */
-func Trace(msg string, ctx ...interface{}) {
-	// 下面语句默认不调用，只在需要较详细的debug信息时调用
-	if config.DefaultConfig().IsTracing {
-		msg = "==Trace==" + msg
-		log.Debug(msg, ctx)
-	}
-}
-
-// func Debug(msg string, ctx ...interface{}) {
-// 	log.Debug(msg, ctx)
-// }
-
-// func Info(msg string, ctx ...interface{}) {
-// 	log.Info(msg, ctx)
-// }
-
-// func Warn(msg string, ctx ...interface{}) {
-// 	log.Warn(msg, ctx)
-// }
+/* 丢弃所有日志的Logger，未设置Logger时默认使用 */
+var Discard Logger = discard{}
 
-// func Error(msg string, ctx ...interface{}) {
-// 	log.Error(msg, ctx)
-// }
+type discard struct{}
 
-// func Crit(msg string, ctx ...interface{}) {
-// 	log.Crit(msg, ctx)
-// }
+func (discard) Debug(msg string, ctx ...interface{}) {}
+func (discard) Info(msg string, ctx ...interface{})  {}
+func (discard) Warn(msg string, ctx ...interface{})  {}
+func (discard) Error(msg string, ctx ...interface{}) {}
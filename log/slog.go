@@ -0,0 +1,34 @@
+package lsmt
+
+import (
+	"context"
+	"log/slog"
+)
+
+/* 将slog.Logger包装为Logger，ctx中的[]byte按字符串输出 */
+func NewSlogLogger(l *slog.Logger) Logger {
+	return slogLogger{l}
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+func (s slogLogger) Debug(msg string, ctx ...interface{}) { s.log(slog.LevelDebug, msg, ctx) }
+func (s slogLogger) Info(msg string, ctx ...interface{})  { s.log(slog.LevelInfo, msg, ctx) }
+func (s slogLogger) Warn(msg string, ctx ...interface{})  { s.log(slog.LevelWarn, msg, ctx) }
+func (s slogLogger) Error(msg string, ctx ...interface{}) { s.log(slog.LevelError, msg, ctx) }
+
+func (s slogLogger) log(level slog.Level, msg string, ctx []interface{}) {
+	if !s.l.Enabled(context.Background(), level) {
+		return
+	}
+	args := make([]interface{}, len(ctx))
+	for i, v := range ctx {
+		if b, ok := v.([]byte); ok {
+			v = string(b)
+		}
+		args[i] = v
+	}
+	s.l.Log(context.Background(), level, msg, args...)
+}
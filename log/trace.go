@@ -0,0 +1,46 @@
+package lsmt
+
+import (
+	"bytes"
+	"sync/atomic"
+)
+
+/** 按key跟踪每个键的详细操作记录
+ * 只有key以指定前缀开头时才以Debug级别输出，前缀可在运行时修改，nil表示关闭跟踪，空前缀表示跟踪所有key
+ * 零值和nil的Tracer都不输出任何内容
+ */
+type Tracer struct {
+	logger Logger
+	// 类型为 *[]byte
+	prefix atomic.Value
+}
+
+func NewTracer(logger Logger, prefix []byte) *Tracer {
+	t := &Tracer{logger: logger}
+	t.SetPrefix(prefix)
+	return t
+}
+
+/* 修改跟踪的key前缀，可与Trace并发调用 */
+func (t *Tracer) SetPrefix(prefix []byte) {
+	if prefix != nil {
+		prefix = append([]byte{}, prefix...)
+	}
+	t.prefix.Store(&prefix)
+}
+
+/* 判断是否跟踪key */
+func (t *Tracer) Enabled(key []byte) bool {
+	if t == nil || t.logger == nil {
+		return false
+	}
+	p, _ := t.prefix.Load().(*[]byte)
+	return p != nil && *p != nil && bytes.HasPrefix(key, *p)
+}
+
+/* 若跟踪key则输出一条日志 */
+func (t *Tracer) Trace(key []byte, msg string, ctx ...interface{}) {
+	if t.Enabled(key) {
+		t.logger.Debug("==Trace=="+msg, append([]interface{}{"key", key}, ctx...)...)
+	}
+}
@@ -0,0 +1,46 @@
+package lsmt
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracerPrefix(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewSlogLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	tracer := NewTracer(logger, nil)
+	tracer.Trace([]byte("user1"), "Put")
+	assert.Equal(t, 0, buf.Len())
+
+	tracer.SetPrefix([]byte("user"))
+	assert.True(t, tracer.Enabled([]byte("user1")))
+	assert.False(t, tracer.Enabled([]byte("order1")))
+	tracer.Trace([]byte("order1"), "Put")
+	tracer.Trace([]byte("user1"), "Put", "value", []byte("v1"))
+	assert.Equal(t, 1, strings.Count(buf.String(), "\n"))
+	assert.Contains(t, buf.String(), `msg="==Trace==Put" key=user1 value=v1`)
+
+	// 空前缀跟踪所有key
+	tracer.SetPrefix([]byte{})
+	assert.True(t, tracer.Enabled([]byte("order1")))
+
+	var nilTracer *Tracer
+	assert.False(t, nilTracer.Enabled([]byte("user1")))
+	nilTracer.Trace([]byte("user1"), "Put")
+}
+
+func TestSlogLoggerLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewSlogLogger(slog.New(slog.NewTextHandler(&buf, nil)))
+	logger.Debug("debug")
+	logger.Warn("warn", "key", []byte("k"))
+	assert.NotContains(t, buf.String(), "debug")
+	assert.Contains(t, buf.String(), "level=WARN msg=warn key=k")
+
+	Discard.Error("nothing")
+}
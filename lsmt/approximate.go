@@ -0,0 +1,79 @@
+package lsmt
+
+/* key范围[Start, End) */
+type KeyRange struct {
+	Start []byte
+	End   []byte
+}
+
+/** 估算每个范围内的数据占用的字节数，不读取磁盘文件中的数据
+ * 磁盘文件按索引块估算，每个文件的误差不超过一个数据块；内存中的树按键值对的近似大小精确累加
+ * 同一个key的多个版本、删除标记和merge操作数分别计入，Start不小于End时该范围的结果为0
+ */
+func (t *LSMTree) ApproximateSizes(ranges []KeyRange) []int {
+	sizes := make([]int, len(ranges))
+	for i, r := range ranges {
+		sizes[i], _ = t.approximateRange(r.Start, r.End)
+	}
+	return sizes
+}
+
+/* 估算[start, end)内的键值对个数，估算方式与ApproximateSizes相同 */
+func (t *LSMTree) ApproximateCount(start, end []byte) int {
+	_, cnt := t.approximateRange(start, end)
+	return cnt
+}
+
+func (t *LSMTree) approximateRange(start, end []byte) (size, cnt int) {
+	if t.cmp.Compare(start, end) >= 0 {
+		return 0, 0
+	}
+	view, release := t.acquireView()
+	for _, m := range append([]Memtable{view.mutable}, view.immutables...) {
+		for _, e := range m.Range(start, end) {
+			size += e.ApproximateSize()
+			cnt++
+		}
+	}
+	release()
+
+	v := t.CurrentVersion()
+	defer v.Release()
+	for _, files := range v.levels {
+		for _, d := range files {
+			s, c := d.approximateRange(start, end)
+			size += s
+			cnt += c
+		}
+	}
+	return size, cnt
+}
+
+/** 估算文件中[start, end)内的字节数和键值对个数
+ * 字节数由索引项记录的数据块位置相减得到，键值对个数按文件中键值对的平均大小折算
+ */
+func (d *DiskFile) approximateRange(start, end []byte) (size, cnt int) {
+	if d.Empty() {
+		return 0, 0
+	}
+	size = d.approximateOffset(end) - d.approximateOffset(start)
+	if size <= 0 {
+		return 0, 0
+	}
+	return size, (d.size*size + d.data_size/2) / d.data_size
+}
+
+/** 估算文件中小于key的键值对占用的字节数
+ * key不在文件的key范围内时结果准确，否则取key所在数据块的中点
+ */
+func (d *DiskFile) approximateOffset(key []byte) int {
+	if d.cmp.Compare(key, d.start_key) <= 0 {
+		return 0
+	}
+	if d.cmp.Compare(key, d.end_key) > 0 {
+		return d.data_size
+	}
+	// 索引损坏时b为空，估算为0
+	b, _, _ := d.findBlock(key)
+	return b.offset + b.length/2
+}
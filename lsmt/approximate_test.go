@@ -0,0 +1,78 @@
+package lsmt
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"LSM-Tree/config"
+	"LSM-Tree/core"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiskFileApproximateRange(t *testing.T) {
+	elems := make([]*core.Element, 1000)
+	for i := range elems {
+		elems[i] = &core.Element{Key: []byte(fmt.Sprintf("key%04d", i)), Value: []byte(fmt.Sprintf("value%04d", i))}
+	}
+	d := newTestDiskFile(t, elems, 1)
+
+	// 每一端的误差不超过半个数据块
+	indexDistance := config.DefaultConfig().IndexDistance
+	size, cnt := d.approximateRange([]byte("key0100"), []byte("key0600"))
+	assert.InDelta(t, 500, cnt, float64(indexDistance))
+	assert.InEpsilon(t, d.data_size/2, size, 0.02)
+	_, cnt = d.approximateRange([]byte("key0105"), []byte("key0603"))
+	assert.InDelta(t, 498, cnt, float64(indexDistance))
+
+	size, cnt = d.approximateRange([]byte("a"), []byte("z"))
+	assert.Equal(t, d.data_size, size)
+	assert.Equal(t, 1000, cnt)
+	size, cnt = d.approximateRange([]byte("key1000"), []byte("z"))
+	assert.Equal(t, 0, size)
+	assert.Equal(t, 0, cnt)
+}
+
+func TestApproximateSizes(t *testing.T) {
+	tree := NewLSMTree(1000)
+	const n = 10000
+	for _, i := range rand.Perm(n) {
+		assert.Nil(t, tree.Put([]byte(fmt.Sprintf("key%05d", i)), []byte(fmt.Sprintf("value%05d", i))))
+	}
+	// 等待flush和归并，部分数据仍在内存中的树里
+	time.Sleep(1 * time.Second)
+
+	assert.Equal(t, n, tree.ApproximateCount([]byte("key"), []byte("kez")))
+	cnt := tree.ApproximateCount([]byte("key02000"), []byte("key04000"))
+	assert.InDelta(t, 2000, cnt, 2000*0.05)
+	cnt = tree.ApproximateCount([]byte("key05003"), []byte("key05503"))
+	assert.InDelta(t, 500, cnt, 500*0.1)
+
+	sizes := tree.ApproximateSizes([]KeyRange{
+		{Start: []byte("key"), End: []byte("kez")},
+		{Start: []byte("key00000"), End: []byte("key05000")},
+		{Start: []byte("key05000"), End: []byte("kez")},
+		{Start: []byte("a"), End: []byte("b")},
+		{Start: []byte("kez"), End: []byte("key")},
+	})
+	totalFileSize, _ := tree.GetIntProperty(PropTotalFileSize)
+	// 文件体积还包括索引块，不计入估算结果
+	assert.InEpsilon(t, totalFileSize, sizes[0], 0.15)
+	assert.InEpsilon(t, sizes[0]/2, sizes[1], 0.05)
+	assert.InEpsilon(t, sizes[0]/2, sizes[2], 0.05)
+	assert.Equal(t, 0, sizes[3])
+	assert.Equal(t, 0, sizes[4])
+}
+
+/* 只在内存中的树里的数据按键值对精确计数 */
+func TestApproximateCountMemtable(t *testing.T) {
+	tree := NewLSMTree(0)
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, tree.Put([]byte(fmt.Sprintf("%03d", i)), []byte("value")))
+	}
+	assert.Equal(t, 30, tree.ApproximateCount([]byte("010"), []byte("040")))
+	e := core.Element{Key: []byte("010"), Value: []byte("value")}
+	assert.Equal(t, []int{30 * e.ApproximateSize()}, tree.ApproximateSizes([]KeyRange{{Start: []byte("010"), End: []byte("040")}}))
+}
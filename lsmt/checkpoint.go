@@ -0,0 +1,126 @@
+package lsmt
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"LSM-Tree/vfs"
+)
+
+/** 在dir中创建树此刻的一致副本，写入可以与Checkpoint同时进行
+ * 副本包含Checkpoint开始时已写入的所有数据，不包含之后的写入；打开副本时将config.WALDir和MmapDir都设为dir，LevelDirs设为空，其他配置需与本树相同，可以用Open或OpenReadOnly打开
+ * 磁盘文件写入后不再修改，文件系统支持时以硬链接加入副本，否则复制；尚未flush的内存中的树写入副本中的一个日志文件，包括以DisableWAL写入的数据
+ * dir需不存在或为空目录，清单最后写入，没有清单的目录不是完整的副本
+ */
+func (t *LSMTree) Checkpoint(dir string) error {
+	fs := t.config.FS
+	if err := fs.MkdirAll(dir); err != nil {
+		return fmt.Errorf("create checkpoint directory %s: %w", dir, err)
+	}
+	names, err := fs.List(dir)
+	if err != nil {
+		return fmt.Errorf("list checkpoint directory %s: %w", dir, err)
+	}
+	if len(names) > 0 {
+		return fmt.Errorf("%w: checkpoint directory %s is not empty", ErrInvalidArgument, dir)
+	}
+
+	// 持有installMu时flush不会发布新文件，磁盘文件和内存中的树恰好覆盖所有数据且不重叠
+	t.installMu.Lock()
+	t.rwm.RLock()
+	v := t.CurrentVersion()
+	records := t.memtableRecords()
+	t.rwm.RUnlock()
+	t.installMu.Unlock()
+	defer v.Release()
+
+	m := manifest{Comparator: t.cmp.Name(), LogNum: 1}
+	for _, files := range v.levels {
+		level := make([]manifestFile, 0, len(files))
+		for _, d := range files {
+			path := filepath.Join(dir, fmt.Sprintf("%06d.sst", d.id))
+			if err := d.checkpointTo(fs, path); err != nil {
+				return fmt.Errorf("checkpoint disk file %d: %w", d.id, err)
+			}
+			level = append(level, newManifestFile(d, path))
+		}
+		m.Levels = append(m.Levels, level)
+	}
+	if len(records) > 0 {
+		w, err := newLogWriter(fs, dir, m.LogNum, nil, t.config.KeyProvider, newStatistics(t.config.FileLevelCnt))
+		if err != nil {
+			return fmt.Errorf("create checkpoint log: %w", err)
+		}
+		_, err = w.write(records, true)
+		if cerr := w.close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("write checkpoint log: %w", err)
+		}
+	}
+	if err := fs.SyncDir(dir); err != nil {
+		return fmt.Errorf("sync checkpoint directory %s: %w", dir, err)
+	}
+	if err := writeManifest(fs, dir, &m); err != nil {
+		return err
+	}
+	t.logger.Info("Created checkpoint", "dir", dir, "logRecords", len(records))
+	return nil
+}
+
+/* 按从旧到新的顺序将所有内存中的树编码为日志记录，每棵树一条，调用者需持有rwm */
+func (t *LSMTree) memtableRecords() [][]byte {
+	trees := make([]Memtable, 0, t.treesInFlush.Len()+1)
+	for e := t.treesInFlush.Back(); e != nil; e = e.Prev() {
+		trees = append(trees, e.Value.(Memtable))
+	}
+	trees = append(trees, t.tree)
+	var records [][]byte
+	for _, tree := range trees {
+		b := &WriteBatch{}
+		// 树中的范围删除标记只作用于更旧的数据，先于树中的元素重放
+		for _, r := range tree.RangeTombstones() {
+			b.DeleteRange(r.Start, r.End)
+		}
+		for _, e := range tree.Inorder() {
+			switch {
+			case e.IsMerge:
+				b.Merge(e.Key, e.Value)
+			case string(e.Value) == t.config.DeleteValue:
+				b.Delete(e.Key)
+			default:
+				b.Put(e.Key, e.Value)
+				b.ops[len(b.ops)-1].expireAt = e.ExpireAt
+			}
+		}
+		if b.Len() > 0 {
+			records = append(records, b.encode())
+		}
+	}
+	return records
+}
+
+/* 将文件加入fs中的副本：已写入文件的磁盘文件优先创建硬链接，无法链接或只在内存中的文件写入一份副本 */
+func (d *DiskFile) checkpointTo(fs vfs.FS, path string) error {
+	if d.path != "" {
+		if err := fs.Link(d.path, path); err == nil {
+			return nil
+		}
+	}
+	f, err := fs.Create(path)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(d.data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fs.Remove(path)
+	}
+	return err
+}
@@ -0,0 +1,114 @@
+package lsmt
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"LSM-Tree/vfs"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/* 写入的同时创建副本，副本包含调用前已返回的所有写入，不包含调用返回后才开始的写入 */
+func TestCheckpoint(t *testing.T) {
+	fs := vfs.NewMem()
+	assert.Nil(t, fs.MkdirAll("/db"))
+	conf := manifestConfig(fs)
+	tree, err := Open(10, conf)
+	assert.Nil(t, err)
+	putKeys(t, tree, 0, 45)
+	assert.Nil(t, tree.Delete([]byte("key001")))
+	assert.Nil(t, tree.DeleteRange([]byte("key030"), []byte("key033")))
+	assert.Nil(t, tree.PutWithOptions([]byte("nowal"), []byte("value"), WriteOptions{DisableWAL: true}))
+	// 调用Checkpoint之前已确认的写入
+	expected := map[string]string{"nowal": "value"}
+	for i := 0; i < 45; i++ {
+		if i != 1 && (i < 30 || i >= 33) {
+			expected[fmt.Sprintf("key%03d", i)] = fmt.Sprintf("value%d", i)
+		}
+	}
+
+	// 另一个线程按顺序写入新的key，started和written分别是已开始和已返回的写入个数
+	var started, written int32
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			atomic.StoreInt32(&started, int32(i+1))
+			assert.Nil(t, tree.Put([]byte(fmt.Sprintf("w%05d", i)), []byte("value")))
+			atomic.StoreInt32(&written, int32(i+1))
+		}
+	}()
+	for atomic.LoadInt32(&written) < 20 {
+		time.Sleep(time.Millisecond)
+	}
+	acked := int(atomic.LoadInt32(&written))
+	assert.Nil(t, tree.Checkpoint("/cp"))
+	begun := int(atomic.LoadInt32(&started))
+	close(stop)
+	wg.Wait()
+
+	// 源树之后的归并和写入不影响副本
+	putKeys(t, tree, 45, 80)
+	assert.Nil(t, tree.Close())
+
+	cpConf := walConfig(fs)
+	cpConf.WALDir, cpConf.MmapDir = "/cp", "/cp"
+	cp, err := OpenReadOnly(cpConf)
+	assert.Nil(t, err)
+	for i := 0; i < 45; i++ {
+		key := fmt.Sprintf("key%03d", i)
+		if v, ok := expected[key]; ok {
+			assertValue(t, cp, key, v)
+		} else {
+			assertMissing(t, cp, key)
+		}
+	}
+	assertValue(t, cp, "nowal", expected["nowal"])
+	assertMissing(t, cp, "key045")
+	// 并发写入的key在副本中是一个前缀，包含调用前已返回的写入，不包含调用返回后才开始的写入
+	for i := 0; i < acked; i++ {
+		assertValue(t, cp, fmt.Sprintf("w%05d", i), "value")
+	}
+	n := acked
+	for ; n < begun; n++ {
+		if _, err := cp.Get([]byte(fmt.Sprintf("w%05d", n))); err != nil {
+			break
+		}
+	}
+	for i := n; i < int(atomic.LoadInt32(&written)); i++ {
+		assertMissing(t, cp, fmt.Sprintf("w%05d", i))
+	}
+	assert.Nil(t, cp.Close())
+
+	// 副本也可以作为主实例打开并继续写入
+	cp, err = Open(10, cpConf)
+	assert.Nil(t, err)
+	putKeys(t, cp, 45, 50)
+	assertValue(t, cp, "key046", "value46")
+	assertValue(t, cp, "key002", "value2")
+	assert.Nil(t, cp.Close())
+}
+
+/* 副本的目录需为空 */
+func TestCheckpointDirNotEmpty(t *testing.T) {
+	fs := vfs.NewMem()
+	conf := walConfig(fs)
+	tree, err := Open(10, conf)
+	assert.Nil(t, err)
+	assert.Nil(t, tree.Put([]byte("a"), []byte("b")))
+	assert.Nil(t, tree.Checkpoint("/cp"))
+	assert.True(t, errors.Is(tree.Checkpoint("/cp"), ErrInvalidArgument))
+	assert.Nil(t, tree.Close())
+}
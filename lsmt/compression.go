@@ -0,0 +1,88 @@
+package lsmt
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/lzw"
+	"compress/zlib"
+	"fmt"
+	"io"
+
+	"LSM-Tree/config"
+)
+
+/** 按c压缩一个数据块，返回的块以一个记录压缩方式的字节开头，之后是压缩后的数据
+ * 压缩后不小于原数据时按不压缩存放，读取时不需要解压
+ */
+func compressBlock(c config.CompressionType, raw []byte) ([]byte, error) {
+	if c != config.NoCompression {
+		var buf bytes.Buffer
+		buf.WriteByte(byte(c))
+		w, err := newCompressWriter(c, &buf)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(raw); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		if buf.Len() < len(raw)+1 {
+			return buf.Bytes(), nil
+		}
+	}
+	return append([]byte{byte(config.NoCompression)}, raw...), nil
+}
+
+/** 解压compressBlock返回的块
+ * 未压缩的块直接返回块中的字节，不复制
+ */
+func decompressBlock(b []byte) ([]byte, error) {
+	if len(b) == 0 {
+		return nil, fmt.Errorf("empty block")
+	}
+	c := config.CompressionType(b[0])
+	if c == config.NoCompression {
+		return b[1:], nil
+	}
+	r, err := newDecompressReader(c, bytes.NewReader(b[1:]))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("decompress block with codec %d: %w", c, err)
+	}
+	return raw, nil
+}
+
+func newCompressWriter(c config.CompressionType, w io.Writer) (io.WriteCloser, error) {
+	switch c {
+	case config.FlateCompression:
+		return flate.NewWriter(w, flate.DefaultCompression)
+	case config.ZlibCompression:
+		return zlib.NewWriter(w), nil
+	case config.GzipCompression:
+		return gzip.NewWriter(w), nil
+	case config.LZWCompression:
+		return lzw.NewWriter(w, lzw.LSB, 8), nil
+	}
+	return nil, fmt.Errorf("unknown compression type %d", c)
+}
+
+func newDecompressReader(c config.CompressionType, r io.Reader) (io.ReadCloser, error) {
+	switch c {
+	case config.FlateCompression:
+		return flate.NewReader(r), nil
+	case config.ZlibCompression:
+		return zlib.NewReader(r)
+	case config.GzipCompression:
+		return gzip.NewReader(r)
+	case config.LZWCompression:
+		return lzw.NewReader(r, lzw.LSB, 8), nil
+	}
+	return nil, fmt.Errorf("unknown compression type %d", c)
+}
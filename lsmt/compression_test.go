@@ -0,0 +1,104 @@
+package lsmt
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"LSM-Tree/config"
+	"LSM-Tree/core"
+	log "LSM-Tree/log"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var compressionTypes = []config.CompressionType{
+	config.NoCompression,
+	config.FlateCompression,
+	config.ZlibCompression,
+	config.GzipCompression,
+	config.LZWCompression,
+}
+
+func TestCompressBlock(t *testing.T) {
+	raw := bytes.Repeat([]byte("compressible "), 100)
+	for _, c := range compressionTypes {
+		b, err := compressBlock(c, raw)
+		assert.Nil(t, err)
+		assert.Equal(t, byte(c), b[0])
+		if c != config.NoCompression {
+			assert.Less(t, len(b), len(raw))
+		}
+		got, err := decompressBlock(b)
+		assert.Nil(t, err)
+		assert.Equal(t, raw, got)
+	}
+
+	// 压缩后变大的块按不压缩存放
+	b, err := compressBlock(config.GzipCompression, []byte("x"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{byte(config.NoCompression), 'x'}, b)
+
+	_, err = compressBlock(config.CompressionType(100), raw)
+	assert.NotNil(t, err)
+	_, err = decompressBlock([]byte{100, 1, 2})
+	assert.NotNil(t, err)
+}
+
+func TestDiskFileCompression(t *testing.T) {
+	elems := make([]*core.Element, 1000)
+	for i := range elems {
+		elems[i] = &core.Element{Key: []byte(fmt.Sprintf("key%04d", i)), Value: bytes.Repeat([]byte("v"), 100)}
+	}
+	for _, typ := range compressionTypes {
+		conf := testConfig(func(c *config.Config) {
+			c.Compression = []config.CompressionType{typ}
+		})
+		d, err := newDiskFile(elems, 1, conf, core.BytewiseComparator, log.Discard, nil)
+		assert.Nil(t, err)
+		if typ == config.NoCompression {
+			assert.Less(t, d.raw_size, d.data_size)
+		} else {
+			assert.Less(t, d.data_size*2, d.raw_size, "codec %d", typ)
+		}
+		for _, i := range []int{0, 1, 555, 999} {
+			e, err := d.Search(elems[i].Key)
+			assert.Nil(t, err)
+			assert.Equal(t, elems[i].Value, e.Value)
+		}
+		assert.Equal(t, len(elems), len(allElements(t, d)))
+	}
+}
+
+/* 各层使用不同的压缩方式，归并读取level0的文件后以另一种方式写入level1 */
+func TestCompressionPerLevel(t *testing.T) {
+	conf := testConfig(func(c *config.Config) {
+		c.Compression = []config.CompressionType{config.NoCompression, config.GzipCompression, config.LZWCompression}
+	})
+	assert.Equal(t, config.LZWCompression, conf.CompressionForLevel(4))
+	tree := NewLSMTreeWithConfig(100, conf)
+	value := bytes.Repeat([]byte("value"), 20)
+	for i := 0; i < 400; i++ {
+		assert.Nil(t, tree.Put([]byte(fmt.Sprintf("key%04d", i)), value))
+		if i%100 == 99 {
+			// 等待flush，使每100个key写入一个level0文件
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	levels := tree.LevelSummary()
+	assert.Equal(t, 0, len(levels[0].Files))
+	assert.Equal(t, 1, len(levels[1].Files))
+	assert.Less(t, 3.0, levels[1].CompressionRatio())
+	for i := 0; i < 400; i++ {
+		v, err := tree.Get([]byte(fmt.Sprintf("key%04d", i)))
+		assert.Nil(t, err)
+		assert.Equal(t, value, v)
+	}
+
+	s := tree.Statistics().Snapshot()
+	assert.Equal(t, 0.0, s.LevelCompressionRatios[0])
+	assert.Equal(t, levels[1].CompressionRatio(), s.LevelCompressionRatios[1])
+}
@@ -2,15 +2,21 @@ package lsmt
 
 import (
 	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
 	"encoding/gob"
+	"errors"
 	"fmt"
-	"strconv"
+	"hash/crc32"
+	"io"
+	"path/filepath"
 	"sync/atomic"
+	"time"
 
-	"LSM-Tree/avlTree"
 	"LSM-Tree/config"
 	"LSM-Tree/core"
 	log "LSM-Tree/log"
+	"LSM-Tree/vfs"
 )
 
 var (
@@ -18,126 +24,504 @@ var (
 	globalID int32 = -1
 )
 
+/* 每个块之后的校验和uint32(crc32c(块))，块加密时校验加密后的字节 */
+const blockTrailerLen = 4
+
 /** 模拟一个磁盘文件
  */
 type DiskFile struct {
-	level     int              // 所属磁盘层级
-	id        int32            // 每个文件独有的ID
-	start_key string           // 文件中的最小键
-	end_key   string           // 文件中的最大键
-	index     *avlTree.AVLTree // 索引树
-	size      int              // 文件中的键值对个数
-	buf       bytes.Buffer     // 字节数组，键值对以字节数组形式顺序存储在buf中
+	level     int        // 所属磁盘层级
+	id        int32      // 每个文件独有的ID
+	start_key []byte     // 文件中的最小键
+	end_key   []byte     // 文件中的最大键
+	index     indexBlock // 索引块，分区索引时为顶层索引，其索引项指向data中的分区索引块
+	size      int        // 文件中的键值对个数
+	data      []byte     // 文件内容，依次存放数据块、分区索引块（若有）、索引块和文件尾，每个块之后是它的校验和
+	data_size int        // data中数据块的总字节数，即压缩后的字节数
+	raw_size  int        // 数据块压缩前的总字节数
+	file_size int        // data的总字节数，data被释放后仍然有效
+	// 是否使用两级的分区索引
+	partitioned bool
+	// 加密文件使用的密钥ID和AES-GCM，未加密时key_id为空，aead为nil
+	key_id string
+	aead   cipher.AEAD
+	// 文件写入fs时path是该文件的路径，mmapped表示data是否为只读映射的文件
+	fs      vfs.FS
+	path    string
+	mmapped bool
+	// 非0时引用计数归零后只释放data，不删除文件，用于仍在清单中的文件和只读实例加载的文件
+	keep int32
+	// 引用计数，创建者、包含该文件的每个Version和正在读取该文件的后台任务各持有一个引用，计数归零时释放data
+	refs int32
+	// 文件创建时间，文件中所有键值对的写入时间都不晚于该时间
+	create_time time.Time
+	// 范围删除标记，只作用于比本文件更旧的数据
+	range_dels []core.RangeTombstone
+	// 文件中key的排序方式，以及写入时记录的排序方式名称
+	cmp             core.Comparator
+	comparator_name string
+	// 所属LSMTree的日志，单独创建的文件不输出日志
+	logger log.Logger
+	tracer *log.Tracer
 }
 
-func (d DiskFile) Empty() bool {
+func (d *DiskFile) Empty() bool {
 	return d.size == 0
 }
 
 /** 创建一个新的磁盘文件
 * 注意，这里是在内存中用字节数组来模拟磁盘空间
-* 对于一个elem：key，value，在磁盘文件中按写入顺序写入elem，再另外保存一棵索引树，
-树的key即elem的key，value是elem的value在磁盘文件中的位置（第几个字节）
-* 为了减少索引树的体积，每隔几个elem存储一个索引
-*/
-func NewDiskFile(elems []*core.Element, level int) *DiskFile {
+* elem按写入顺序每config.IndexDistance个分为一个数据块，按所在层级的压缩方式压缩后依次写入磁盘文件，数据块之后写入一个有序的索引块，每个数据块对应一个索引项，记录块中的最大key以及块的位置和字节数
+* 索引项个数超过config.IndexPartitionSize时，索引项被分成多个分区索引块写入文件，顶层索引块只记录各个分区
+* 每个块之后写入该块的crc32c校验和，读取块时校验
+* 文件最后是记录索引块位置的文件尾
+ */
+func NewDiskFile(elems []*core.Element, level int) (*DiskFile, error) {
+	return NewDiskFileWithComparator(elems, level, core.BytewiseComparator)
+}
+
+/* 创建一个新的磁盘文件，elems需已按cmp排好序，文件内容保存在内存中，编码或压缩失败时返回错误 */
+func NewDiskFileWithComparator(elems []*core.Element, level int, cmp core.Comparator) (*DiskFile, error) {
+	conf := *config.DefaultConfig()
+	conf.MmapDir, conf.LevelDirs = "", nil
+	return newDiskFile(elems, level, &conf, cmp, log.Discard, nil)
+}
+
+/** 创建一个新的磁盘文件
+ * conf.DirForLevel(level)非空时，文件内容写入conf.FS中该目录下的文件，再以只读方式映射到内存，写入或映射失败时返回错误
+ * 数据块的压缩方式由conf.CompressionForLevel(level)决定，压缩失败时返回错误
+ * conf.KeyProvider非nil时，以当前密钥按块加密数据块和索引块，密钥的ID记录在文件尾
+ */
+func newDiskFile(elems []*core.Element, level int, conf *config.Config, cmp core.Comparator, logger log.Logger, tracer *log.Tracer) (*DiskFile, error) {
 	d := &DiskFile{
 		size:  len(elems),
 		id:    atomic.AddInt32(&globalID, 1),
-		index: &avlTree.AVLTree{},
 		level: level,
+		refs:  1,
+
+		create_time:     time.Now(),
+		cmp:             cmp,
+		comparator_name: cmp.Name(),
+		logger:          logger,
+		tracer:          tracer,
+	}
+	d.logger.Info("Create new diskFile", "diskID", d.id, "level", d.level)
+	footer := fileFooter{comparator: cmp.Name()}
+	if conf.KeyProvider != nil {
+		id, key, err := conf.KeyProvider.CurrentKey()
+		if err != nil {
+			return nil, fmt.Errorf("get encryption key for disk file %d: %w", d.id, err)
+		}
+		if d.aead, err = newAEAD(key); err != nil {
+			return nil, fmt.Errorf("create cipher with key %q: %w", id, err)
+		}
+		footer.keyID = id
+	}
+	var buf bytes.Buffer
+	// 依次写入一个块及其校验和，文件加密时写入加密后的块，返回该块的位置和包括校验和在内的字节数
+	writeBlock := func(lastKey, b []byte) (indexEntry, error) {
+		offset := buf.Len()
+		if d.aead != nil {
+			var err error
+			if b, err = sealBlock(d.aead, offset, b); err != nil {
+				return indexEntry{}, err
+			}
+		}
+		buf.Write(b)
+		buf.Write(binary.LittleEndian.AppendUint32(nil, crc32.Checksum(b, crcTable)))
+		return indexEntry{lastKey: lastKey, offset: offset, length: len(b) + blockTrailerLen}, nil
+	}
+
+	compression := conf.CompressionForLevel(level)
+	var raw bytes.Buffer
+	var entries []indexEntry
+	for i := 0; i < len(elems); i += conf.IndexDistance {
+		end := Min(i+conf.IndexDistance, len(elems))
+		// 每个数据块使用单独的编码器，可以从块的起始位置独立解码
+		raw.Reset()
+		enc := gob.NewEncoder(&raw)
+		for _, e := range elems[i:end] {
+			if err := enc.Encode(*e); err != nil {
+				return nil, fmt.Errorf("encode block of disk file %d: %w", d.id, err)
+			}
+		}
+		d.raw_size += raw.Len()
+		block, err := compressBlock(compression, raw.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("compress block of disk file %d: %w", d.id, err)
+		}
+		// 索引项只需区分相邻的块，用不小于块中最大key且小于下一个块第一个key的短key代替最大key，减小索引
+		var sep []byte
+		if end < len(elems) {
+			sep = cmp.FindShortestSeparator(elems[end-1].Key, elems[end].Key)
+		} else {
+			sep = cmp.FindShortSuccessor(elems[end-1].Key)
+		}
+		e, err := writeBlock(sep, block)
+		if err != nil {
+			return nil, fmt.Errorf("write block of disk file %d: %w", d.id, err)
+		}
+		entries = append(entries, e)
+		d.tracer.Trace(elems[i].Key, "diskFile created data block", "diskID", d.id, "offset", e.offset, "lastKey", elems[end-1].Key)
+	}
+	d.data_size = buf.Len()
+	if p := conf.IndexPartitionSize; p > 0 && len(entries) > p {
+		var top []indexEntry
+		for i := 0; i < len(entries); i += p {
+			end := Min(i+p, len(entries))
+			e, err := writeBlock(entries[end-1].lastKey, buildIndexBlock(entries[i:end]))
+			if err != nil {
+				return nil, fmt.Errorf("write index partition of disk file %d: %w", d.id, err)
+			}
+			top = append(top, e)
+		}
+		entries = top
+		footer.partitioned = true
+	}
+	footer.indexOffset = buf.Len()
+	if _, err := writeBlock(nil, buildIndexBlock(entries)); err != nil {
+		return nil, fmt.Errorf("write index of disk file %d: %w", d.id, err)
 	}
-	log.Logger.Info("Create new diskFile", "diskID", d.id, "level", d.level)
-	var indexElems []core.Element
-	var enc *gob.Encoder
-	indexDistance := config.DefaultConfig().IndexDistance
-	for i, e := range elems {
-		// log.Logger.Debug(fmt.Sprintf("writing to new diskfile %d, current elem.key: %v", d.id, e.Key))
-		if i%indexDistance == 0 {
-			// Create sparse index.
-			idx := core.Element{Key: e.Key, Value: fmt.Sprintf("%d", d.buf.Len())}
-			log.Trace("diskFile created sparse index element", "diskID", d.id, "key", idx.Key, "index", idx.Value)
-			indexElems = append(indexElems, idx)
-			enc = gob.NewEncoder(&d.buf)
+	buf.Write(footer.encode())
+	d.data = buf.Bytes()
+	d.file_size = len(d.data)
+	if dir := conf.DirForLevel(level); dir != "" {
+		if err := d.writeFile(conf.FS, filepath.Join(dir, fmt.Sprintf("%06d.sst", d.id))); err != nil {
+			return nil, fmt.Errorf("write disk file %d: %w", d.id, err)
 		}
-		enc.Encode(*e)
 	}
-	d.index.BatchAdd(indexElems)
-	// 默认至少有一个元素
-	d.start_key = elems[0].Key
-	d.end_key = elems[len(elems)-1].Key
-	return d
+	if err := d.loadIndex(conf.KeyProvider); err != nil {
+		return nil, fmt.Errorf("load index of disk file %d: %w", d.id, err)
+	}
+	// 只有范围删除标记的文件没有元素，key范围由setRangeTombstones决定
+	if len(elems) > 0 {
+		d.start_key = elems[0].Key
+		d.end_key = elems[len(elems)-1].Key
+	}
+	return d, nil
 }
 
-/** 在一个磁盘文件中搜索key，若搜到则返回该key对应的elem
- * 由于磁盘文件的索引树只索引了一部分elem，所以需要先从索引树中通过key的比较得到对应elem的存储区间，
-再遍历该区间查找elem
-*/
-func (d *DiskFile) Search(key string) (core.Element, error) {
-	canErr := fmt.Errorf("key %s not found in disk file", key)
-	if d.Empty() {
-		return core.Element{}, canErr
+/* 设置文件中的范围删除标记，文件中没有元素时以标记覆盖的范围作为文件的key范围 */
+func (d *DiskFile) setRangeTombstones(dels []core.RangeTombstone) {
+	d.range_dels = dels
+	if !d.Empty() || len(dels) == 0 {
+		return
 	}
-	var si, ei int
-	startNode := d.index.LowerBound(key)
-	if startNode == nil {
-		// Key smaller than all.
-		log.Trace(fmt.Sprintf("Searching key: %v in diskFile %d, not found", key, d.id))
-		return core.Element{}, canErr
+	d.start_key, d.end_key = dels[0].Start, dels[0].End
+	for _, r := range dels[1:] {
+		if d.cmp.Compare(r.Start, d.start_key) < 0 {
+			d.start_key = r.Start
+		}
+		if d.cmp.Compare(r.End, d.end_key) > 0 {
+			d.end_key = r.End
+		}
+	}
+}
+
+/** 由文件尾找到索引块，文件加密时按文件尾记录的密钥ID从keys取得密钥并解密索引块
+ * 文件尾记录的排序方式与d.cmp不同时返回ErrInvalidArgument，不能用另一种排序方式查找文件
+ * 未加密的索引块直接引用文件中的字节，文件写完后data不再修改
+ */
+func (d *DiskFile) loadIndex(keys core.KeyProvider) error {
+	footer, footer_offset, err := decodeFooter(d.data)
+	if err != nil {
+		return err
+	}
+	d.partitioned, d.key_id = footer.partitioned, footer.keyID
+	if footer.comparator != d.cmp.Name() {
+		return fmt.Errorf("%w: file was written with comparator %q, but %q is configured", ErrInvalidArgument, footer.comparator, d.cmp.Name())
+	}
+	d.comparator_name = footer.comparator
+	if d.key_id != "" && d.aead == nil {
+		if keys == nil {
+			return fmt.Errorf("file is encrypted with key %q but no KeyProvider is configured", d.key_id)
+		}
+		key, err := keys.Key(d.key_id)
+		if err != nil {
+			return err
+		}
+		if d.aead, err = newAEAD(key); err != nil {
+			return err
+		}
+	}
+	index, err := d.readIndexBlock(indexEntry{offset: footer.indexOffset, length: footer_offset - footer.indexOffset})
+	if err != nil {
+		return err
+	}
+	d.index = index
+	return nil
+}
+
+/* 文件系统中的文件不支持映射到内存 */
+var errMmapUnsupported = errors.New("mmap is not supported")
+
+/** 将data写入fs中的path并持久化，文件支持时再以只读方式映射到内存替换data
+ * 映射后读取的数据块都直接引用映射的内存，由操作系统的页缓存而不是Go的堆保存，不支持映射时data仍保存在堆中
+ */
+func (d *DiskFile) writeFile(fs vfs.FS, path string) error {
+	f, err := fs.Create(path)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(d.data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = fs.SyncDir(filepath.Dir(path))
+	}
+	if err != nil {
+		fs.Remove(path)
+		return err
+	}
+	d.fs, d.path = fs, path
+	data, err := mmapFile(fs, path, len(d.data))
+	if errors.Is(err, errMmapUnsupported) {
+		return nil
+	}
+	if err != nil {
+		fs.Remove(path)
+		return err
+	}
+	d.data, d.mmapped = data, true
+	return nil
+}
+
+/* 增加一个引用，调用者需已持有一个引用，或在持有drwm时从层级链表中取得该文件，链表中的文件一定被当前的Version引用 */
+func (d *DiskFile) ref() {
+	atomic.AddInt32(&d.refs, 1)
+}
+
+/** 释放一个引用，计数归零时解除映射并删除文件，设置了keep时保留文件
+ * 之后不能再读取该文件
+ */
+func (d *DiskFile) unref() {
+	if atomic.AddInt32(&d.refs, -1) != 0 {
+		return
+	}
+	if d.path == "" {
+		return
+	}
+	if d.mmapped {
+		if err := munmapFile(d.data); err != nil {
+			d.logger.Error("failed to unmap diskFile", "diskID", d.id, "err", err)
+		}
+	}
+	if atomic.LoadInt32(&d.keep) != 0 {
+		d.data, d.index = nil, nil
+		return
+	}
+	if err := d.fs.Remove(d.path); err != nil {
+		d.logger.Error("failed to remove diskFile", "diskID", d.id, "path", d.path, "err", err)
 	}
-	si, _ = strconv.Atoi(startNode.Value)
-	endNode := d.index.UpperBound(key)
-	if endNode == nil {
-		// Key larger than all or equal to the last one.
-		ei = d.buf.Len()
-	} else {
-		ei, _ = strconv.Atoi(endNode.Value)
-		// log.Logger.Debug(fmt.Sprintf("Searching key: %v in diskFile %d, endNode.key: %v, endNode.Val: %v", key, d.id, endNode.Key, endNode.Value))
-	}
-	// log.Logger.Debug(fmt.Sprintf("Searching key: %v in diskFile %d, searching in index range [%d,%d)]", key, d.id, si, ei))
-	buf := bytes.NewBuffer(d.buf.Bytes()[si:ei])
-	dec := gob.NewDecoder(buf)
+	d.data, d.index = nil, nil
+}
+
+func refFiles(files []*DiskFile) {
+	for _, d := range files {
+		d.ref()
+	}
+}
+
+func unrefFiles(files []*DiskFile) {
+	for _, d := range files {
+		d.unref()
+	}
+}
+
+/** 返回文件中索引项e指向的块，文件加密时返回解密后的块
+ * 块超出文件范围、校验和不符或无法解密时返回包装了ErrCorruption的错误
+ */
+func (d *DiskFile) readBlock(e indexEntry) ([]byte, error) {
+	if e.offset < 0 || e.length < blockTrailerLen || e.offset+e.length > len(d.data) {
+		return nil, fmt.Errorf("%w: block at %d with %d bytes is out of range in disk file %d", ErrCorruption, e.offset, e.length, d.id)
+	}
+	b := d.data[e.offset : e.offset+e.length-blockTrailerLen]
+	sum := binary.LittleEndian.Uint32(d.data[e.offset+e.length-blockTrailerLen:])
+	if crc32.Checksum(b, crcTable) != sum {
+		return nil, fmt.Errorf("%w: checksum mismatch in block at %d of disk file %d", ErrCorruption, e.offset, d.id)
+	}
+	if d.aead == nil {
+		return b, nil
+	}
+	plain, err := openBlock(d.aead, e.offset, b)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruption, err)
+	}
+	return plain, nil
+}
+
+/* 读取并检查索引项e指向的索引块，检查通过后entry和search不会越界 */
+func (d *DiskFile) readIndexBlock(e indexEntry) (indexBlock, error) {
+	b, err := d.readBlock(e)
+	if err != nil {
+		return nil, err
+	}
+	if err := indexBlock(b).check(); err != nil {
+		return nil, fmt.Errorf("index block at %d of disk file %d: %w", e.offset, d.id, err)
+	}
+	return indexBlock(b), nil
+}
+
+/** 返回可能包含key的数据块，即第一个最大key不小于key的数据块
+ * key大于文件中的所有key时返回false
+ */
+func (d *DiskFile) findBlock(key []byte) (indexEntry, bool, error) {
+	i := d.index.search(d.cmp, key)
+	if i == d.index.len() {
+		return indexEntry{}, false, nil
+	}
+	e := d.index.entry(i)
+	if d.partitioned {
+		// 分区的最大key不小于key，因此分区内一定能找到
+		part, err := d.readIndexBlock(e)
+		if err != nil {
+			return indexEntry{}, false, err
+		}
+		e = part.entry(part.search(d.cmp, key))
+	}
+	return e, true, nil
+}
+
+/* 按顺序返回所有数据块的索引项 */
+func (d *DiskFile) dataBlocks() ([]indexEntry, error) {
+	blocks := make([]indexEntry, 0)
+	for i := 0; i < d.index.len(); i++ {
+		e := d.index.entry(i)
+		if !d.partitioned {
+			blocks = append(blocks, e)
+			continue
+		}
+		part, err := d.readIndexBlock(e)
+		if err != nil {
+			return nil, err
+		}
+		for j := 0; j < part.len(); j++ {
+			blocks = append(blocks, part.entry(j))
+		}
+	}
+	return blocks, nil
+}
+
+/* 按顺序解码一个数据块中的elem，fn返回false时停止，块损坏时返回包装了ErrCorruption的错误 */
+func (d *DiskFile) scanBlock(b indexEntry, fn func(e *core.Element) bool) error {
+	block, err := d.readBlock(b)
+	if err != nil {
+		return err
+	}
+	raw, err := decompressBlock(block)
+	if err != nil {
+		return fmt.Errorf("%w: decompress block at %d of disk file %d: %v", ErrCorruption, b.offset, d.id, err)
+	}
+	dec := gob.NewDecoder(bytes.NewReader(raw))
 	for {
 		var e core.Element
 		if err := dec.Decode(&e); err != nil {
-			if err.Error() != "EOF" {
-				log.Logger.Error("got err", "err", err)
+			if err != io.EOF {
+				return fmt.Errorf("%w: decode block at %d of disk file %d: %v", ErrCorruption, b.offset, d.id, err)
 			}
-			break
+			return nil
 		}
-		if e.Key == key {
-			log.Trace(fmt.Sprintf("Searching key: %v in diskFile %d, searching in index range [%d,%d)], and find it!", key, d.id, si, ei))
-			return e, nil
+		if !fn(&e) {
+			return nil
 		}
 	}
-	return core.Element{}, canErr
 }
 
-/** 返回一个磁盘文件中的所有elem
+/** 在一个磁盘文件中搜索key，若搜到则返回该key对应的elem
+ * 先在索引块中二分查找到可能包含key的数据块，再遍历该数据块查找elem，块损坏时返回包装了ErrCorruption的错误
  */
-func (d *DiskFile) AllElements() []*core.Element {
-	indexElems := d.index.Inorder()
-	var elems []*core.Element = make([]*core.Element, d.size+1)
-	var dec *gob.Decoder
-	cnt := 0
-	for i, idx := range indexElems {
-		start, _ := strconv.Atoi(idx.Value)
-		end := d.buf.Len()
-		if i < len(indexElems)-1 {
-			end, _ = strconv.Atoi(indexElems[i+1].Value)
-		}
-		dec = gob.NewDecoder(bytes.NewBuffer(d.buf.Bytes()[start:end]))
-		for {
-			elems[cnt] = &core.Element{}
-			if dec.Decode(elems[cnt]) != nil {
-				break
+func (d *DiskFile) Search(key []byte) (core.Element, error) {
+	canErr := fmt.Errorf("key %s not found in disk file", key)
+	if d.Empty() || d.cmp.Compare(key, d.start_key) < 0 {
+		// Key smaller than all.
+		d.tracer.Trace(key, "Searching key in diskFile, not found", "diskID", d.id)
+		return core.Element{}, canErr
+	}
+	b, ok, err := d.findBlock(key)
+	if err != nil {
+		return core.Element{}, err
+	}
+	if !ok {
+		return core.Element{}, canErr
+	}
+	var found *core.Element
+	err = d.scanBlock(b, func(e *core.Element) bool {
+		c := d.cmp.Compare(e.Key, key)
+		if c == 0 {
+			found = e
+		}
+		return c < 0
+	})
+	if err != nil {
+		return core.Element{}, err
+	}
+	if found == nil {
+		return core.Element{}, canErr
+	}
+	d.tracer.Trace(key, "Searching key in diskFile, and find it!", "diskID", d.id, "blockOffset", b.offset)
+	return *found, nil
+}
+
+/** 在磁盘文件中查找多个已按cmp排好序的key，对每个找到的key调用found，i为key在keys中的下标
+ * 落在同一个数据块内的key只解码该块一次，块损坏时返回包装了ErrCorruption的错误
+ */
+func (d *DiskFile) searchSorted(keys [][]byte, found func(i int, e *core.Element)) error {
+	if d.Empty() {
+		return nil
+	}
+	i := 0
+	for i < len(keys) && d.cmp.Compare(keys[i], d.start_key) < 0 {
+		i++
+	}
+	for i < len(keys) {
+		b, ok, err := d.findBlock(keys[i])
+		if err != nil || !ok {
+			return err
+		}
+		err = d.scanBlock(b, func(e *core.Element) bool {
+			for i < len(keys) && d.cmp.Compare(keys[i], e.Key) < 0 {
+				i++
+			}
+			for i < len(keys) && d.cmp.Compare(keys[i], e.Key) == 0 {
+				d.tracer.Trace(keys[i], "Searching key in diskFile, and find it!", "diskID", d.id, "blockOffset", b.offset)
+				found(i, e)
+				i++
 			}
-			cnt += 1
+			return i < len(keys)
+		})
+		if err != nil {
+			return err
 		}
+		// 剩余的不大于该块最大key的key都不在文件中
+		for i < len(keys) && d.cmp.Compare(keys[i], b.lastKey) <= 0 {
+			i++
+		}
+	}
+	return nil
+}
 
+/** 返回一个磁盘文件中的所有elem，块损坏时返回包装了ErrCorruption的错误
+ */
+func (d *DiskFile) AllElements() ([]*core.Element, error) {
+	blocks, err := d.dataBlocks()
+	if err != nil {
+		return nil, err
+	}
+	elems := make([]*core.Element, 0, d.size)
+	for _, b := range blocks {
+		err := d.scanBlock(b, func(e *core.Element) bool {
+			elems = append(elems, e)
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
 	}
-	// log.Logger.Debug("DiskFile AllElements cnt", "expected", d.size, "got", len(elems), "level", d.level)
-	return elems[:len(elems)-1]
+	return elems, nil
 }
 
 func (d *DiskFile) GetID() int {
@@ -148,6 +532,24 @@ func (d *DiskFile) GetSize() int {
 	return d.size
 }
 
-func (d *DiskFile) GetKeyRange() [2]string {
-	return [2]string{d.start_key, d.end_key}
+/* 文件占用的字节数，包括数据块和索引块 */
+func (d *DiskFile) GetFileSize() int {
+	return d.file_size
+}
+
+func (d *DiskFile) GetKeyRange() [2][]byte {
+	return [2][]byte{d.start_key, d.end_key}
+}
+
+/* 返回写入该文件时使用的排序方式名称 */
+func (d *DiskFile) GetComparatorName() string {
+	return d.comparator_name
+}
+
+func (d *DiskFile) GetCreateTime() time.Time {
+	return d.create_time
+}
+
+func (d *DiskFile) GetRangeTombstones() []core.RangeTombstone {
+	return d.range_dels
 }
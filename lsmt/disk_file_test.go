@@ -1,23 +1,52 @@
 package lsmt
 
 import (
+	"LSM-Tree/config"
 	"LSM-Tree/core"
+	log "LSM-Tree/log"
+	"bytes"
+	"errors"
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 )
 
+/* 返回d中的所有elem，读取失败时结束测试 */
+func allElements(t *testing.T, d *DiskFile) []*core.Element {
+	t.Helper()
+	elems, err := d.AllElements()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return elems
+}
+
+/* 用默认配置创建磁盘文件，创建失败时结束测试 */
+func newTestDiskFile(t *testing.T, elems []*core.Element, level int) *DiskFile {
+	t.Helper()
+	d, err := NewDiskFile(elems, level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
 func TestDiskFileConstruction(t *testing.T) {
 	elems := []*core.Element{
-		{Key: "1", Value: "One"},
-		{Key: "2", Value: "Two"},
-		{Key: "3", Value: "Three"},
-		{Key: "4", Value: "Four"},
-		{Key: "5", Value: "Five"},
-		{Key: "6", Value: "Six"},
-		{Key: "7", Value: "Seven"},
-	}
-	d := NewDiskFile(elems, 0)
-	got := d.AllElements()
+		{Key: []byte("1"), Value: []byte("One")},
+		{Key: []byte("2"), Value: []byte("Two")},
+		{Key: []byte("3"), Value: []byte("Three")},
+		{Key: []byte("4"), Value: []byte("Four")},
+		{Key: []byte("5"), Value: []byte("Five")},
+		{Key: []byte("6"), Value: []byte("Six")},
+		{Key: []byte("7"), Value: []byte("Seven")},
+	}
+	d := newTestDiskFile(t, elems, 0)
+	got, err := d.AllElements()
+	if err != nil {
+		t.Fatal(err)
+	}
 	// for _, e := range got {
 	// 	fmt.Printf("%v", e)
 	// }
@@ -26,7 +55,10 @@ func TestDiskFileConstruction(t *testing.T) {
 	}
 
 	// 再测一次
-	got = d.AllElements()
+	got, err = d.AllElements()
+	if err != nil {
+		t.Fatal(err)
+	}
 	if !reflect.DeepEqual(elems, got) {
 		t.Errorf("all elements got %v; want %v", got, elems)
 	}
@@ -34,27 +66,110 @@ func TestDiskFileConstruction(t *testing.T) {
 
 func TestDiskFileSearch(t *testing.T) {
 	elems := []*core.Element{
-		{Key: "1", Value: "One"},
-		{Key: "2", Value: "Two"},
-		{Key: "3", Value: "Three"},
-		{Key: "4", Value: "Four"},
-		{Key: "5", Value: "Five"},
-		{Key: "6", Value: "Six"},
-		{Key: "7", Value: "Seven"},
-	}
-	d := NewDiskFile(elems, 0)
+		{Key: []byte("1"), Value: []byte("One")},
+		{Key: []byte("2"), Value: []byte("Two")},
+		{Key: []byte("3"), Value: []byte("Three")},
+		{Key: []byte("4"), Value: []byte("Four")},
+		{Key: []byte("5"), Value: []byte("Five")},
+		{Key: []byte("6"), Value: []byte("Six")},
+		{Key: []byte("7"), Value: []byte("Seven")},
+	}
+	d := newTestDiskFile(t, elems, 0)
 	for _, e := range elems {
-		if got, err := d.Search(e.Key); err != nil || got.Key != e.Key {
+		if got, err := d.Search(e.Key); err != nil || !bytes.Equal(got.Key, e.Key) {
 			t.Errorf("search got key %s, %v; want %s, nil", got.Key, err, e.Key)
 		}
 	}
-	if got, err := d.Search("0"); err == nil {
+	if got, err := d.Search([]byte("0")); err == nil {
 		t.Errorf("search 0 got key %s; want not found", got.Key)
 	}
-	if got, err := d.Search("8"); err == nil {
+	if got, err := d.Search([]byte("8")); err == nil {
 		t.Errorf("search 8 got key %s; want not found", got.Key)
 	}
-	if got, err := d.Search("3.5"); err == nil {
+	if got, err := d.Search([]byte("3.5")); err == nil {
 		t.Errorf("search 3.5 got key %s; want not found", got.Key)
 	}
 }
+
+func TestDiskFilePartitionedIndex(t *testing.T) {
+	conf := testConfig(func(c *config.Config) {
+		c.IndexDistance = 4
+		c.IndexPartitionSize = 3
+	})
+	elems := make([]*core.Element, 100)
+	for i := range elems {
+		elems[i] = &core.Element{Key: []byte(fmt.Sprintf("%03d", i*2)), Value: []byte(fmt.Sprintf("v%d", i*2))}
+	}
+	d, err := newDiskFile(elems, 1, conf, core.BytewiseComparator, log.Discard, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.partitioned || d.index.len() != 9 {
+		t.Fatalf("got partitioned %v with %d partitions; want true with 9", d.partitioned, d.index.len())
+	}
+	if blocks, err := d.dataBlocks(); err != nil || len(blocks) != 25 {
+		t.Errorf("got %d data blocks, %v; want 25, nil", len(blocks), err)
+	}
+	for _, e := range elems {
+		if got, err := d.Search(e.Key); err != nil || !bytes.Equal(got.Value, e.Value) {
+			t.Errorf("search got value %s, %v; want %s, nil", got.Value, err, e.Value)
+		}
+	}
+	for _, key := range []string{"", "001", "099", "197", "199"} {
+		if got, err := d.Search([]byte(key)); err == nil {
+			t.Errorf("search %s got key %s; want not found", key, got.Key)
+		}
+	}
+	if got, err := d.AllElements(); err != nil || !reflect.DeepEqual(elems, got) {
+		t.Errorf("all elements got %v, %v; want %v, nil", got, err, elems)
+	}
+}
+
+/* 索引项使用相邻块之间的短key，落在块中最大key和短key之间的key仍然找不到 */
+func TestDiskFileShortIndexKeys(t *testing.T) {
+	conf := testConfig(func(c *config.Config) {
+		c.IndexDistance = 4
+	})
+	elems := make([]*core.Element, 40)
+	for i := range elems {
+		key := fmt.Sprintf("key%05d-%s", i*2, strings.Repeat("x", 32))
+		elems[i] = &core.Element{Key: []byte(key), Value: []byte(fmt.Sprintf("v%d", i*2))}
+	}
+	d, err := newDiskFile(elems, 0, conf, core.BytewiseComparator, log.Discard, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// key00006和key00008之间可以缩短，key00038和key00040之间不能，最后一个块用最大key的短后继
+	for i, want := range map[int]string{0: "key00007", 4: string(elems[19].Key), 9: "l"} {
+		if got := d.index.entry(i).lastKey; string(got) != want {
+			t.Errorf("index entry %d has key %s; want %s", i, got, want)
+		}
+	}
+	for _, e := range elems {
+		if got, err := d.Search(e.Key); err != nil || !bytes.Equal(got.Value, e.Value) {
+			t.Errorf("search got value %s, %v; want %s, nil", got.Value, err, e.Value)
+		}
+	}
+	for _, key := range []string{"key00006-y", "key00007", "key00078-y", "l"} {
+		if got, err := d.Search([]byte(key)); err == nil {
+			t.Errorf("search %s got key %s; want not found", key, got.Key)
+		}
+	}
+}
+
+/* 文件尾记录写入时的排序方式，用另一种排序方式打开时返回ErrInvalidArgument */
+func TestDiskFileComparatorMismatch(t *testing.T) {
+	d := newTestDiskFile(t, []*core.Element{{Key: []byte("1"), Value: []byte("One")}}, 0)
+	footer, _, err := decodeFooter(d.data)
+	if err != nil || footer.comparator != core.BytewiseComparator.Name() {
+		t.Fatalf("got comparator %q, %v; want %q, nil", footer.comparator, err, core.BytewiseComparator.Name())
+	}
+	reopened := &DiskFile{data: d.data, cmp: reverseComparator{}}
+	if err := reopened.loadIndex(nil); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("load index with another comparator got %v; want ErrInvalidArgument", err)
+	}
+	reopened = &DiskFile{data: d.data, cmp: core.BytewiseComparator}
+	if err := reopened.loadIndex(nil); err != nil || reopened.GetComparatorName() != core.BytewiseComparator.Name() {
+		t.Errorf("load index got %q, %v; want %q, nil", reopened.GetComparatorName(), err, core.BytewiseComparator.Name())
+	}
+}
@@ -0,0 +1,46 @@
+package lsmt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+)
+
+/* 由AES密钥创建AES-GCM，密钥长度需为16、24或32字节 */
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+/** 加密一个块或一条记录，结果依次为随机生成的nonce、密文和认证标签
+ * offset是该块在文件中的位置，作为附加数据参与认证，块被移动到其他位置后无法解密
+ */
+func sealBlock(aead cipher.AEAD, offset int, plain []byte) ([]byte, error) {
+	out := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plain)+aead.Overhead())
+	if _, err := rand.Read(out); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+	return aead.Seal(out, out, plain, blockAD(offset)), nil
+}
+
+/* 解密sealBlock返回的块，offset需与加密时相同，块被篡改时返回错误 */
+func openBlock(aead cipher.AEAD, offset int, sealed []byte) ([]byte, error) {
+	n := aead.NonceSize()
+	if len(sealed) < n+aead.Overhead() {
+		return nil, fmt.Errorf("encrypted block at %d too short", offset)
+	}
+	plain, err := aead.Open(nil, sealed[:n], sealed[n:], blockAD(offset))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt block at %d: %w", offset, err)
+	}
+	return plain, nil
+}
+
+func blockAD(offset int) []byte {
+	return binary.LittleEndian.AppendUint64(nil, uint64(offset))
+}
@@ -0,0 +1,110 @@
+package lsmt
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"LSM-Tree/config"
+	"LSM-Tree/core"
+	log "LSM-Tree/log"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSealBlock(t *testing.T) {
+	aead, err := newAEAD([]byte("0123456789abcdef"))
+	assert.Nil(t, err)
+	plain := []byte("secret block")
+	sealed, err := sealBlock(aead, 100, plain)
+	assert.Nil(t, err)
+	assert.False(t, bytes.Contains(sealed, plain))
+	got, err := openBlock(aead, 100, sealed)
+	assert.Nil(t, err)
+	assert.Equal(t, plain, got)
+
+	// 移动到其他位置或被篡改的块无法解密
+	_, err = openBlock(aead, 200, sealed)
+	assert.NotNil(t, err)
+	sealed[len(sealed)-1] ^= 1
+	_, err = openBlock(aead, 100, sealed)
+	assert.NotNil(t, err)
+
+	_, err = newAEAD([]byte("short"))
+	assert.NotNil(t, err)
+}
+
+func TestDiskFileEncryption(t *testing.T) {
+	elems := make([]*core.Element, 1000)
+	for i := range elems {
+		elems[i] = &core.Element{Key: []byte(fmt.Sprintf("key%04d", i)), Value: []byte(fmt.Sprintf("secret%04d", i))}
+	}
+	keys := core.NewMemKeyProvider()
+	keys.Rotate("k1", []byte("0123456789abcdef0123456789abcdef"))
+	conf := testConfig(func(c *config.Config) {
+		c.KeyProvider = keys
+		c.IndexPartitionSize = 10
+		c.Compression = []config.CompressionType{config.FlateCompression}
+	})
+	d, err := newDiskFile(elems, 0, conf, core.BytewiseComparator, log.Discard, nil)
+	assert.Nil(t, err)
+
+	assert.False(t, bytes.Contains(d.data, []byte("secret")))
+	assert.False(t, bytes.Contains(d.data, []byte("key0")))
+	footer, _, err := decodeFooter(d.data)
+	assert.Nil(t, err)
+	assert.Equal(t, "k1", footer.keyID)
+	assert.True(t, footer.partitioned)
+	assert.Equal(t, "k1", d.summary().KeyID)
+	for _, i := range []int{0, 499, 999} {
+		e, err := d.Search(elems[i].Key)
+		assert.Nil(t, err)
+		assert.Equal(t, elems[i].Value, e.Value)
+	}
+	assert.Equal(t, len(elems), len(allElements(t, d)))
+
+	// 打开加密文件需要文件尾中记录的密钥
+	reopened := &DiskFile{data: d.data, cmp: core.BytewiseComparator}
+	assert.NotNil(t, reopened.loadIndex(nil))
+	assert.NotNil(t, reopened.loadIndex(core.NewMemKeyProvider()))
+	assert.Nil(t, reopened.loadIndex(keys))
+	assert.Equal(t, d.index, reopened.index)
+}
+
+/* 轮换密钥后，归并将旧密钥加密的文件以新密钥重写 */
+func TestKeyRotationThroughCompaction(t *testing.T) {
+	keys := core.NewMemKeyProvider()
+	keys.Rotate("k1", []byte("0123456789abcdef"))
+	conf := testConfig(func(c *config.Config) {
+		c.KeyProvider = keys
+	})
+	tree := NewLSMTreeWithConfig(10, conf)
+	put := func(from, to int) {
+		for i := from; i < to; i++ {
+			assert.Nil(t, tree.Put([]byte(fmt.Sprintf("key%03d", i)), []byte(fmt.Sprintf("value%d", i))))
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	for i := 0; i < 3; i++ {
+		put(i*10, i*10+10)
+	}
+	levels := tree.LevelSummary()
+	assert.Equal(t, 3, len(levels[0].Files))
+	for _, f := range levels[0].Files {
+		assert.Equal(t, "k1", f.KeyID)
+	}
+
+	keys.Rotate("k2", []byte("fedcba9876543210"))
+	put(30, 40)
+	time.Sleep(500 * time.Millisecond)
+	levels = tree.LevelSummary()
+	assert.Equal(t, 0, len(levels[0].Files))
+	assert.Equal(t, 1, len(levels[1].Files))
+	assert.Equal(t, "k2", levels[1].Files[0].KeyID)
+	for i := 0; i < 40; i++ {
+		v, err := tree.Get([]byte(fmt.Sprintf("key%03d", i)))
+		assert.Nil(t, err)
+		assert.Equal(t, fmt.Sprintf("value%d", i), string(v))
+	}
+}
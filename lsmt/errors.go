@@ -0,0 +1,18 @@
+package lsmt
+
+import "errors"
+
+var (
+	/* key超过config.MaxKeySize */
+	ErrInvalidKey = errors.New("lsmt: invalid key")
+	/* value或merge操作数超过config.MaxValueSize */
+	ErrValueTooLarge = errors.New("lsmt: value too large")
+	/* value与config.DeleteValue相同，该值被保留用作删除标记 */
+	ErrReservedValue = errors.New("lsmt: value is reserved as delete value")
+	/* 参数不合法，如ttl不为正数、范围删除的start不小于end、未设置合并操作等 */
+	ErrInvalidArgument = errors.New("lsmt: invalid argument")
+	/* 通过OpenReadOnly或OpenAsSecondary打开的树不能写入 */
+	ErrReadOnly = errors.New("lsmt: tree is read-only")
+	/* 磁盘文件中的块超出文件范围、校验和不符或无法解码 */
+	ErrCorruption = errors.New("lsmt: corruption")
+)
@@ -0,0 +1,148 @@
+package lsmt
+
+import (
+	"fmt"
+	"time"
+)
+
+/** 后台任务的事件回调
+ * 回调在执行flush和compact的后台线程中同步调用，调用时不持有树的锁，但耗时的回调会拖慢后台任务
+ * 只关心部分事件时可嵌入BaseEventListener
+ */
+type EventListener interface {
+	OnFlushBegin(info FlushJobInfo)
+	OnFlushCompleted(info FlushJobInfo)
+	OnCompactionBegin(info CompactionJobInfo)
+	OnCompactionCompleted(info CompactionJobInfo)
+	OnFileCreated(info TableFileInfo)
+	OnFileDeleted(info TableFileInfo)
+	/* 写者被WriteBufferManager阻塞或恢复时调用 */
+	OnStallConditionChanged(info StallConditionInfo)
+	/* 后台任务失败时调用，失败的flush或compact不会修改已有的磁盘文件 */
+	OnBackgroundError(reason BackgroundErrorReason, err error)
+	/* flush或compact后某个目录中的磁盘文件超过config.DirCapacity时调用，目录降到上限以下后再次超过时会再次调用 */
+	OnStorageFull(info DirUsage)
+}
+
+/* 所有回调都为空的EventListener，用于嵌入 */
+type BaseEventListener struct{}
+
+var _ EventListener = BaseEventListener{}
+
+func (BaseEventListener) OnFlushBegin(FlushJobInfo)                                 {}
+func (BaseEventListener) OnFlushCompleted(FlushJobInfo)                             {}
+func (BaseEventListener) OnCompactionBegin(CompactionJobInfo)                       {}
+func (BaseEventListener) OnCompactionCompleted(CompactionJobInfo)                   {}
+func (BaseEventListener) OnFileCreated(TableFileInfo)                               {}
+func (BaseEventListener) OnFileDeleted(TableFileInfo)                               {}
+func (BaseEventListener) OnStallConditionChanged(StallConditionInfo)                {}
+func (BaseEventListener) OnBackgroundError(reason BackgroundErrorReason, err error) {}
+func (BaseEventListener) OnStorageFull(DirUsage)                                    {}
+
+/* 磁盘文件创建或删除的原因 */
+type FileReason int
+
+const (
+	FileReasonFlush FileReason = iota
+	FileReasonCompaction
+	// FIFO模式下超出体积上限或过期而被删除
+	FileReasonFIFO
+)
+
+func (r FileReason) String() string {
+	switch r {
+	case FileReasonFlush:
+		return "flush"
+	case FileReasonCompaction:
+		return "compaction"
+	case FileReasonFIFO:
+		return "fifo"
+	}
+	return fmt.Sprintf("FileReason(%d)", int(r))
+}
+
+/* 一个被创建或删除的磁盘文件 */
+type TableFileInfo struct {
+	FileSummary
+	Level  int
+	Reason FileReason
+}
+
+type FlushJobInfo struct {
+	// 被flush的内存中的树的键值对个数和近似字节数
+	Entries     int
+	MemoryUsage int
+	// flush产生的level0文件，只在OnFlushCompleted中有效
+	OutputFile TableFileInfo
+	// flush耗时，只在OnFlushCompleted中有效
+	Duration time.Duration
+}
+
+type CompactionJobInfo struct {
+	InputLevel  int
+	OutputLevel int
+	InputFiles  []TableFileInfo
+	// 以下字段只在OnCompactionCompleted中有效
+	OutputFiles []TableFileInfo
+	Duration    time.Duration
+	// 归并失败的原因，成功时为nil，失败时输入文件保持不变
+	Err error
+}
+
+type StallConditionInfo struct {
+	// 为true时写者开始被阻塞，为false时恢复
+	Stalled bool
+	// WriteBufferManager统计的内存用量和预算
+	MemoryUsage int
+	BufferSize  int
+}
+
+/* 后台任务失败的原因 */
+type BackgroundErrorReason int
+
+const (
+	BackgroundErrorFlush BackgroundErrorReason = iota
+	BackgroundErrorCompaction
+)
+
+func (r BackgroundErrorReason) String() string {
+	switch r {
+	case BackgroundErrorFlush:
+		return "flush"
+	case BackgroundErrorCompaction:
+		return "compaction"
+	}
+	return fmt.Sprintf("BackgroundErrorReason(%d)", int(r))
+}
+
+/* 添加一个事件回调，需在读写之前调用 */
+func (t *LSMTree) AddEventListener(l EventListener) {
+	t.listeners = append(t.listeners, l)
+}
+
+func (t *LSMTree) notify(f func(l EventListener)) {
+	for _, l := range t.listeners {
+		f(l)
+	}
+}
+
+func newTableFileInfo(d *DiskFile, reason FileReason) TableFileInfo {
+	return TableFileInfo{
+		FileSummary: d.summary(),
+		Level:       d.level,
+		Reason:      reason,
+	}
+}
+
+func newTableFileInfos(files []*DiskFile, reason FileReason) []TableFileInfo {
+	infos := make([]TableFileInfo, 0, len(files))
+	for _, d := range files {
+		infos = append(infos, newTableFileInfo(d, reason))
+	}
+	return infos
+}
+
+func (t *LSMTree) backgroundError(reason BackgroundErrorReason, err error) {
+	t.logger.Error("background work failed", "reason", reason, "err", err)
+	t.notify(func(l EventListener) { l.OnBackgroundError(reason, err) })
+}
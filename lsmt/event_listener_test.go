@@ -0,0 +1,214 @@
+package lsmt
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/* 记录收到的所有事件 */
+type recordingListener struct {
+	mu          sync.Mutex
+	flushBegin  int
+	flushes     []FlushJobInfo
+	compBegin   int
+	compactions []CompactionJobInfo
+	created     []TableFileInfo
+	deleted     []TableFileInfo
+	stalls      []StallConditionInfo
+	errors      []BackgroundErrorReason
+	full        []DirUsage
+}
+
+func (r *recordingListener) OnFlushBegin(FlushJobInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.flushBegin++
+}
+
+func (r *recordingListener) OnFlushCompleted(info FlushJobInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.flushes = append(r.flushes, info)
+}
+
+func (r *recordingListener) OnCompactionBegin(CompactionJobInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.compBegin++
+}
+
+func (r *recordingListener) OnCompactionCompleted(info CompactionJobInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.compactions = append(r.compactions, info)
+}
+
+func (r *recordingListener) OnFileCreated(info TableFileInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.created = append(r.created, info)
+}
+
+func (r *recordingListener) OnFileDeleted(info TableFileInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deleted = append(r.deleted, info)
+}
+
+func (r *recordingListener) OnStallConditionChanged(info StallConditionInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stalls = append(r.stalls, info)
+}
+
+func (r *recordingListener) OnBackgroundError(reason BackgroundErrorReason, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors = append(r.errors, reason)
+}
+
+func (r *recordingListener) OnStorageFull(info DirUsage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.full = append(r.full, info)
+}
+
+/* 等待持有mu时cond成立，即等待后台任务发出对应的事件 */
+func (r *recordingListener) waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	assert.Eventually(t, func() bool {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return cond()
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+/* 等待完成n次flush，flush删除的文件在OnFlushCompleted之前已通知 */
+func (r *recordingListener) waitFlushes(t *testing.T, n int) {
+	t.Helper()
+	r.waitFor(t, func() bool { return len(r.flushes) >= n })
+}
+
+func TestEventListenerFlushAndCompaction(t *testing.T) {
+	tree := NewLSMTree(2)
+	r := &recordingListener{}
+	tree.AddEventListener(r)
+	for i := 0; i < 8; i++ {
+		assert.Nil(t, tree.Put([]byte(fmt.Sprintf("%d", i)), []byte("value")))
+		if i%2 == 1 {
+			// 保证每个文件按顺序flush
+			r.waitFlushes(t, i/2+1)
+		}
+	}
+	r.waitFor(t, func() bool { return len(r.compactions) == 1 })
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	assert.Equal(t, 4, r.flushBegin)
+	if assert.Equal(t, 4, len(r.flushes)) {
+		assert.Equal(t, 2, r.flushes[0].Entries)
+		assert.Equal(t, 0, r.flushes[0].OutputFile.Level)
+		assert.Equal(t, FileReasonFlush, r.flushes[0].OutputFile.Reason)
+		assert.Equal(t, "0", string(r.flushes[0].OutputFile.StartKey))
+	}
+	assert.Equal(t, 1, r.compBegin)
+	if assert.Equal(t, 1, len(r.compactions)) {
+		c := r.compactions[0]
+		assert.Nil(t, c.Err)
+		assert.Equal(t, 0, c.InputLevel)
+		assert.Equal(t, 1, c.OutputLevel)
+		assert.Equal(t, 4, len(c.InputFiles))
+		if assert.Equal(t, 1, len(c.OutputFiles)) {
+			assert.Equal(t, 1, c.OutputFiles[0].Level)
+			assert.Equal(t, 8, c.OutputFiles[0].Size)
+		}
+		// 输入文件即flush产生的文件
+		for _, f := range r.flushes {
+			assert.Contains(t, c.InputFiles, TableFileInfo{FileSummary: f.OutputFile.FileSummary, Level: 0, Reason: FileReasonCompaction})
+		}
+	}
+	assert.Equal(t, 5, len(r.created))
+	assert.Equal(t, 4, len(r.deleted))
+	assert.Equal(t, 0, len(r.errors))
+}
+
+/* 归并的输入文件损坏时归并失败，通知后台错误并保留输入文件 */
+func TestEventListenerBackgroundError(t *testing.T) {
+	tree := NewLSMTree(1)
+	r := &recordingListener{}
+	tree.AddEventListener(r)
+	for i := 0; i < tree.config.MaxLevel0FileCnt; i++ {
+		assert.Nil(t, tree.Put([]byte(fmt.Sprintf("key%d", i)), []byte("value")))
+		r.waitFlushes(t, i+1)
+		if i == 0 {
+			// 损坏第一个数据块中的一个字节，此时没有其他线程读取该文件
+			levelFiles(t, tree, 0)[0].data[1] ^= 0xff
+		}
+	}
+	r.waitFor(t, func() bool { return len(r.compactions) == 1 })
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	assert.Equal(t, []BackgroundErrorReason{BackgroundErrorCompaction}, r.errors)
+	if assert.Equal(t, 1, len(r.compactions)) {
+		assert.True(t, errors.Is(r.compactions[0].Err, ErrCorruption), "%v", r.compactions[0].Err)
+		assert.Equal(t, 0, len(r.compactions[0].OutputFiles))
+	}
+	// 归并失败时输入文件保持不变
+	assert.Equal(t, 0, len(r.deleted))
+	assert.Equal(t, tree.config.MaxLevel0FileCnt, tree.LevelSummary()[0].Size)
+	v, _ := tree.GetIntProperty(PropNumRunningCompactions)
+	assert.Equal(t, 0, v)
+}
+
+func TestEventListenerFIFO(t *testing.T) {
+	conf := fifoConfig()
+	conf.FIFOTTL = time.Hour
+	tree := NewLSMTreeWithConfig(1, conf)
+	r := &recordingListener{}
+	tree.AddEventListener(r)
+	assert.Nil(t, tree.Put([]byte("1"), []byte("1")))
+	r.waitFlushes(t, 1)
+	tree.drwm.Lock()
+	old := levelFiles(t, tree, 0)[0]
+	old.create_time = old.create_time.Add(-2 * time.Hour)
+	tree.drwm.Unlock()
+	assert.Nil(t, tree.Put([]byte("2"), []byte("2")))
+	r.waitFlushes(t, 2)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if assert.Equal(t, 1, len(r.deleted)) {
+		assert.Equal(t, old.GetID(), r.deleted[0].ID)
+		assert.Equal(t, FileReasonFIFO, r.deleted[0].Reason)
+	}
+}
+
+func TestEventListenerStall(t *testing.T) {
+	m := NewWriteBufferManager(1<<10, true)
+	tree := wbmTree(m)
+	r := &recordingListener{}
+	tree.AddEventListener(r)
+	m.markImmutable(tree, 2<<10)
+	done := make(chan struct{})
+	go func() {
+		tree.Put([]byte("k"), []byte("v"))
+		close(done)
+	}()
+	r.waitFor(t, func() bool { return len(r.stalls) == 1 })
+	m.freeImmutable(2 << 10)
+	<-done
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if assert.Equal(t, 2, len(r.stalls)) {
+		assert.True(t, r.stalls[0].Stalled)
+		assert.Equal(t, 1<<10, r.stalls[0].BufferSize)
+		assert.False(t, r.stalls[1].Stalled)
+	}
+}
@@ -0,0 +1,85 @@
+package lsmt
+
+import (
+	"sync/atomic"
+	"time"
+
+	"LSM-Tree/config"
+)
+
+/** FIFO模式下的归并：不重写任何数据，直接删除整个level-0文件
+ * 文件按从新到旧的顺序存放在level-0链表中，从链表尾部（最旧的文件）开始检查，当所有文件的总体积超过FIFOMaxTotalSize，或文件的创建时间早于FIFOTTL时，删除该文件
+ * 调用者需持有drwm的写锁，返回被删除的文件
+ */
+func (t *LSMTree) compactFIFO() []*DiskFile {
+	files := t.diskFiles[0]
+	totalSize := 0
+	for e := files.Front(); e != nil; e = e.Next() {
+		totalSize += e.Value.(*DiskFile).GetFileSize()
+	}
+	now := t.clock()
+	dropped := make([]*DiskFile, 0)
+	for e := files.Back(); e != nil; {
+		d := e.Value.(*DiskFile)
+		overSize := t.config.FIFOMaxTotalSize > 0 && totalSize > t.config.FIFOMaxTotalSize
+		expired := t.fifoExpired(d, now)
+		if !overSize && !expired {
+			// 更新的文件一定更晚创建，且剩余总体积已不超过上限，无需继续检查
+			break
+		}
+		prev := e.Prev()
+		files.Remove(e)
+		dropped = append(dropped, d)
+		totalSize -= d.GetFileSize()
+		t.logger.Info("FIFO compaction drops diskFile", "diskID", d.id, "size", d.GetFileSize(),
+			"overSize", overSize, "expired", expired)
+		e = prev
+	}
+	return dropped
+}
+
+/* 判断FIFO模式下文件是否已超过FIFOTTL，过期的文件即使尚未删除也不再被读取 */
+func (t *LSMTree) fifoExpired(d *DiskFile, now time.Time) bool {
+	return t.config.CompactionStyle == config.CompactionStyleFIFO && t.config.FIFOTTL > 0 && now.Sub(d.create_time) > t.config.FIFOTTL
+}
+
+/** 不再写入时flush不会发生，由后台线程每隔interval删除一次过期的文件，直到stop被关闭
+ * 删除后与flush中的FIFO归并一样重写清单并发布新的Version
+ */
+func (t *LSMTree) dropExpiredPeriodically(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			t.dropExpiredFiles()
+		}
+	}
+}
+
+func (t *LSMTree) dropExpiredFiles() {
+	t.drwm.Lock()
+	dropped := t.compactFIFO()
+	if len(dropped) == 0 {
+		t.drwm.Unlock()
+		return
+	}
+	manifestErr := t.saveManifest(0)
+	if manifestErr != nil {
+		// 清单中仍有被删除的文件，保留它们
+		for _, f := range dropped {
+			atomic.StoreInt32(&f.keep, 1)
+		}
+	}
+	t.stats.updateLevels(t.installVersion().LevelSummary())
+	t.drwm.Unlock()
+	if manifestErr != nil {
+		t.backgroundError(BackgroundErrorCompaction, manifestErr)
+	}
+	for _, f := range newTableFileInfos(dropped, FileReasonFIFO) {
+		t.notify(func(l EventListener) { l.OnFileDeleted(f) })
+	}
+	t.checkStorage()
+}
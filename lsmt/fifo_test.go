@@ -0,0 +1,125 @@
+package lsmt
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"LSM-Tree/config"
+	"LSM-Tree/core"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fifoConfig() *config.Config {
+	return testConfig(func(c *config.Config) {
+		c.CompactionStyle = config.CompactionStyleFIFO
+	})
+}
+
+/* 测试FIFO模式下总体积超过上限时删除最旧的文件 */
+func TestFIFOCompactionMaxSize(t *testing.T) {
+	conf := fifoConfig()
+	// 总体积上限为两个文件的大小，每个文件有两个键值对
+	sample := newTestDiskFile(t, []*core.Element{{Key: []byte("metric/0"), Value: []byte("0")}, {Key: []byte("metric/1"), Value: []byte("1")}}, 0)
+	conf.FIFOMaxTotalSize = 2 * sample.GetFileSize()
+	tree := NewLSMTreeWithConfig(2, conf)
+	r := &recordingListener{}
+	tree.AddEventListener(r)
+	for i := 0; i < 6; i++ {
+		tree.Put([]byte(fmt.Sprintf("metric/%d", i)), []byte(fmt.Sprintf("%d", i)))
+		if i%2 == 1 {
+			// 保证每个文件按顺序flush
+			r.waitFlushes(t, i/2+1)
+		}
+	}
+
+	// 最旧的文件被删除，且从未发生向level-1的归并
+	assert.Equal(t, 2, len(tree.LevelSummary()[0].Files))
+	assert.Equal(t, 0, len(tree.LevelSummary()[1].Files))
+	for i := 0; i < 2; i++ {
+		_, err := tree.Get([]byte(fmt.Sprintf("metric/%d", i)))
+		assert.NotNil(t, err)
+	}
+	for i := 2; i < 6; i++ {
+		val, err := tree.Get([]byte(fmt.Sprintf("metric/%d", i)))
+		assert.Nil(t, err)
+		assert.Equal(t, fmt.Sprintf("%d", i), string(val))
+	}
+}
+
+/* 测试FIFO模式下过期文件在下一次flush时被删除 */
+func TestFIFOCompactionTTL(t *testing.T) {
+	conf := fifoConfig()
+	conf.FIFOTTL = time.Hour
+	tree := NewLSMTreeWithConfig(2, conf)
+	r := &recordingListener{}
+	tree.AddEventListener(r)
+	tree.Put([]byte("metric/1"), []byte("1"))
+	tree.Put([]byte("metric/2"), []byte("2"))
+	r.waitFlushes(t, 1)
+	assert.Equal(t, 1, len(tree.LevelSummary()[0].Files))
+
+	// 模拟时间流逝，使该文件过期
+	tree.drwm.Lock()
+	old := levelFiles(t, tree, 0)[0]
+	old.create_time = old.create_time.Add(-2 * time.Hour)
+	tree.drwm.Unlock()
+
+	tree.Put([]byte("metric/3"), []byte("3"))
+	tree.Put([]byte("metric/4"), []byte("4"))
+	r.waitFlushes(t, 2)
+
+	assert.Equal(t, 1, len(tree.LevelSummary()[0].Files))
+	_, err := tree.Get([]byte("metric/1"))
+	assert.NotNil(t, err)
+	val, err := tree.Get([]byte("metric/4"))
+	assert.Nil(t, err)
+	assert.Equal(t, "4", string(val))
+}
+
+/* 过期的文件在被删除之前就不再被读取 */
+func TestFIFOTTLExpiredOnRead(t *testing.T) {
+	conf := fifoConfig()
+	conf.FIFOTTL = time.Hour
+	tree := NewLSMTreeWithConfig(2, conf)
+	var elapsed atomic.Int64
+	tree.SetClock(func() time.Time { return time.Now().Add(time.Duration(elapsed.Load())) })
+	tree.Put([]byte("metric/1"), []byte("1"))
+	tree.Put([]byte("metric/2"), []byte("2"))
+	assert.Eventually(t, func() bool {
+		return len(tree.LevelSummary()[0].Files) == 1
+	}, time.Second, 10*time.Millisecond)
+	_, err := tree.Get([]byte("metric/1"))
+	assert.Nil(t, err)
+
+	elapsed.Store(int64(2 * time.Hour))
+	_, err = tree.Get([]byte("metric/1"))
+	assert.NotNil(t, err)
+	_, errs := tree.MultiGet([][]byte{[]byte("metric/1"), []byte("metric/2")})
+	assert.NotNil(t, errs[0])
+	assert.NotNil(t, errs[1])
+	assert.Nil(t, tree.Close())
+}
+
+/* 不再写入时过期的文件由后台线程删除 */
+func TestFIFOTTLWithoutWrites(t *testing.T) {
+	conf := fifoConfig()
+	conf.FIFOTTL = 100 * time.Millisecond
+	tree := NewLSMTreeWithConfig(2, conf)
+	r := &recordingListener{}
+	tree.AddEventListener(r)
+	tree.Put([]byte("metric/1"), []byte("1"))
+	tree.Put([]byte("metric/2"), []byte("2"))
+	assert.Eventually(t, func() bool {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return len(r.deleted) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 0, len(tree.LevelSummary()[0].Files))
+	r.mu.Lock()
+	assert.Equal(t, FileReasonFIFO, r.deleted[0].Reason)
+	r.mu.Unlock()
+	assert.Nil(t, tree.Close())
+}
@@ -0,0 +1,67 @@
+package lsmt
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	footerMagic uint32 = 0x4c534d54 // "LSMT"
+	// 文件尾中keyID之后的字节数
+	footerTailSize = 2 + 1 + 8 + 4
+	// 文件尾中除keyID和排序方式名称外的字节数
+	footerFixedSize = 2 + footerTailSize
+
+	footerFlagPartitioned = 1 << 0
+)
+
+/** 文件尾，位于磁盘文件的最后，本身不加密，打开文件时由它找到索引块和解密使用的密钥，并检查排序方式
+ * 格式：comparator, uint16(len(comparator)), keyID, uint16(len(keyID)), uint8标志位, uint64(索引块的位置), uint32魔数，整数均为小端序
+ * 索引块位于indexOffset和文件尾之间，keyID为空表示文件未加密，comparator是写入文件时使用的排序方式名称
+ */
+type fileFooter struct {
+	indexOffset int
+	partitioned bool
+	keyID       string
+	comparator  string
+}
+
+func (f fileFooter) encode() []byte {
+	b := append([]byte{}, f.comparator...)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(f.comparator)))
+	b = append(b, f.keyID...)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(f.keyID)))
+	var flags byte
+	if f.partitioned {
+		flags |= footerFlagPartitioned
+	}
+	b = append(b, flags)
+	b = binary.LittleEndian.AppendUint64(b, uint64(f.indexOffset))
+	return binary.LittleEndian.AppendUint32(b, footerMagic)
+}
+
+/* 从文件内容的末尾解析文件尾，同时返回文件尾在data中的起始位置 */
+func decodeFooter(data []byte) (fileFooter, int, error) {
+	n := len(data)
+	if n < footerFixedSize || binary.LittleEndian.Uint32(data[n-4:]) != footerMagic {
+		return fileFooter{}, 0, fmt.Errorf("%w: bad footer magic", ErrCorruption)
+	}
+	fixed := data[n-footerTailSize:]
+	keyLen := int(binary.LittleEndian.Uint16(fixed))
+	keyStart := n - footerTailSize - keyLen
+	f := fileFooter{
+		partitioned: fixed[2]&footerFlagPartitioned != 0,
+		indexOffset: int(binary.LittleEndian.Uint64(fixed[3:])),
+	}
+	if keyStart < 2 {
+		return fileFooter{}, 0, fmt.Errorf("%w: footer out of range", ErrCorruption)
+	}
+	cmpLen := int(binary.LittleEndian.Uint16(data[keyStart-2:]))
+	start := keyStart - 2 - cmpLen
+	if start < 0 || f.indexOffset > start {
+		return fileFooter{}, 0, fmt.Errorf("%w: footer out of range", ErrCorruption)
+	}
+	f.keyID = string(data[keyStart : keyStart+keyLen])
+	f.comparator = string(data[start : start+cmpLen])
+	return f, start, nil
+}
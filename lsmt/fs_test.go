@@ -0,0 +1,209 @@
+package lsmt
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"LSM-Tree/config"
+	"LSM-Tree/vfs"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/* 磁盘文件写入内存中的文件系统，不支持映射时数据保存在堆中 */
+func TestDiskFilesOnMemFS(t *testing.T) {
+	fs := vfs.NewMem()
+	assert.Nil(t, fs.MkdirAll("/db"))
+	conf := testConfig(func(c *config.Config) {
+		c.FS = fs
+		c.MmapDir = "/db"
+	})
+	tree := NewLSMTreeWithConfig(10, conf)
+	for i := 0; i < 40; i++ {
+		assert.Nil(t, tree.Put([]byte(fmt.Sprintf("key%03d", i)), []byte("value")))
+		if i%10 == 9 {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	// 归并后只剩下level1的文件
+	names, err := fs.List("/db")
+	assert.Nil(t, err)
+	levels := tree.LevelSummary()
+	assert.Equal(t, 1, len(levels[1].Files))
+	assert.Equal(t, []string{fmt.Sprintf("%06d.sst", levels[1].Files[0].ID)}, names)
+	v := tree.CurrentVersion()
+	assert.False(t, v.levels[1][0].mmapped)
+	v.Release()
+	for i := 0; i < 40; i++ {
+		_, err := tree.Get([]byte(fmt.Sprintf("key%03d", i)))
+		assert.Nil(t, err)
+	}
+
+	assert.Nil(t, tree.Close())
+	names, err = fs.List("/db")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(names))
+}
+
+/* 写入失败时flush失败，数据保留在内存中，不会留下不完整的文件，恢复后重试成功 */
+func TestFlushWriteFailure(t *testing.T) {
+	fs := vfs.NewFaultFS(vfs.NewMem())
+	assert.Nil(t, fs.MkdirAll("/db"))
+	conf := testConfig(func(c *config.Config) {
+		c.FS = fs
+		c.MmapDir = "/db"
+	})
+	tree := NewLSMTreeWithConfig(2, conf)
+	tree.flushRetryDelay = 10 * time.Millisecond
+	r := &recordingListener{}
+	tree.AddEventListener(r)
+
+	fs.FailWrites(errors.New("disk full"))
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, tree.Put([]byte(fmt.Sprintf("%d", i)), []byte("value")))
+	}
+	assert.Eventually(t, func() bool {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return len(r.errors) >= 2
+	}, time.Second, 10*time.Millisecond)
+	r.mu.Lock()
+	for _, reason := range r.errors {
+		assert.Equal(t, BackgroundErrorFlush, reason)
+	}
+	r.mu.Unlock()
+	names, err := fs.List("/db")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(names))
+	for i := 0; i < 2; i++ {
+		v, err := tree.Get([]byte(fmt.Sprintf("%d", i)))
+		assert.Nil(t, err)
+		assert.Equal(t, "value", string(v))
+	}
+
+	// 恢复后失败的树重试成功，新的flush随后正常写入
+	fs.FailWrites(nil)
+	for i := 2; i < 4; i++ {
+		assert.Nil(t, tree.Put([]byte(fmt.Sprintf("%d", i)), []byte("value")))
+	}
+	assert.Eventually(t, func() bool {
+		return len(tree.LevelSummary()[0].Files) == 2
+	}, time.Second, 10*time.Millisecond)
+	names, err = fs.List("/db")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(names))
+	for i := 0; i < 4; i++ {
+		v, err := tree.Get([]byte(fmt.Sprintf("%d", i)))
+		assert.Nil(t, err)
+		assert.Equal(t, "value", string(v))
+	}
+	assert.Nil(t, tree.Close())
+}
+
+/* flush失败的旧树不能被更新的文件越过，否则读取时旧树中的值会遮住更新的值 */
+func TestFailedFlushDoesNotShadowNewerData(t *testing.T) {
+	fs := vfs.NewFaultFS(vfs.NewMem())
+	assert.Nil(t, fs.MkdirAll("/db"))
+	conf := testConfig(func(c *config.Config) {
+		c.FS = fs
+		c.MmapDir = "/db"
+	})
+	tree := NewLSMTreeWithConfig(1, conf)
+	tree.flushRetryDelay = 10 * time.Millisecond
+	r := &recordingListener{}
+	tree.AddEventListener(r)
+
+	fs.FailWrites(errors.New("disk full"))
+	assert.Nil(t, tree.Put([]byte("key"), []byte("old")))
+	assert.Eventually(t, func() bool {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return len(r.errors) > 0
+	}, time.Second, 10*time.Millisecond)
+	// 新的树可以写入文件，但在旧树写入之前不能发布
+	fs.FailWrites(nil)
+	assert.Nil(t, tree.Put([]byte("key"), []byte("new")))
+	v, err := tree.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, "new", string(v))
+
+	assert.Eventually(t, func() bool {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return len(r.flushes) == 2
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 2, len(tree.LevelSummary()[0].Files))
+	v, err = tree.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, "new", string(v))
+	assert.Nil(t, tree.Close())
+}
+
+/* flush一直失败时Close不会等待重试 */
+func TestCloseDuringFlushRetry(t *testing.T) {
+	fs := vfs.NewFaultFS(vfs.NewMem())
+	assert.Nil(t, fs.MkdirAll("/db"))
+	conf := testConfig(func(c *config.Config) {
+		c.FS = fs
+		c.MmapDir = "/db"
+	})
+	tree := NewLSMTreeWithConfig(1, conf)
+	tree.flushRetryDelay = 10 * time.Millisecond
+	r := &recordingListener{}
+	tree.AddEventListener(r)
+
+	fs.FailWrites(errors.New("disk full"))
+	assert.Nil(t, tree.Put([]byte("a"), []byte("value")))
+	assert.Nil(t, tree.Put([]byte("b"), []byte("value")))
+	assert.Eventually(t, func() bool {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return len(r.errors) >= 2
+	}, time.Second, 10*time.Millisecond)
+	assert.Nil(t, tree.Close())
+}
+
+/* 磁盘上的数据块损坏时读取返回ErrCorruption，索引块损坏时无法打开 */
+func TestCorruptDiskFile(t *testing.T) {
+	fs := vfs.NewFaultFS(vfs.NewMem())
+	conf := manifestConfig(fs)
+	tree, err := Open(10, conf)
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, tree.Put([]byte(fmt.Sprintf("key%03d", i)), []byte("value")))
+	}
+	assert.Eventually(t, func() bool {
+		return len(tree.LevelSummary()[0].Files) == 1
+	}, time.Second, 10*time.Millisecond)
+	path := tree.LevelSummary()[0].Files[0].Path
+	assert.Nil(t, tree.Close())
+
+	// 第一个数据块中的一个字节
+	assert.Nil(t, fs.Corrupt(path, 1))
+	tree, err = Open(10, conf)
+	assert.Nil(t, err)
+	_, err = tree.Get([]byte("key000"))
+	assert.True(t, errors.Is(err, ErrCorruption), "%v", err)
+	_, errs := tree.MultiGet([][]byte{[]byte("key000"), []byte("key001")})
+	assert.True(t, errors.Is(errs[0], ErrCorruption))
+	assert.True(t, errors.Is(errs[1], ErrCorruption))
+	v := tree.CurrentVersion()
+	_, err = v.levels[0][0].AllElements()
+	v.Release()
+	assert.True(t, errors.Is(err, ErrCorruption))
+	assert.Nil(t, tree.Close())
+
+	// 恢复数据块，改为损坏索引块
+	assert.Nil(t, fs.Corrupt(path, 1))
+	data, err := readFile(fs, path)
+	assert.Nil(t, err)
+	footer, _, err := decodeFooter(data)
+	assert.Nil(t, err)
+	assert.Nil(t, fs.Corrupt(path, int64(footer.indexOffset)))
+	_, err = Open(10, conf)
+	assert.True(t, errors.Is(err, ErrCorruption), "%v", err)
+}
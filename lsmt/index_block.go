@@ -0,0 +1,109 @@
+package lsmt
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"LSM-Tree/core"
+)
+
+/** 索引块中的一个索引项，指向磁盘文件中的一个块
+ * lastKey不小于该块中的最大key且小于下一个块中的最小key，offset和length是该块在文件中的位置和字节数
+ */
+type indexEntry struct {
+	lastKey []byte
+	offset  int
+	length  int
+}
+
+/** 扁平的有序索引块，可直接在字节数组上二分查找，无需反序列化
+ * 格式：依次存放每个索引项（uvarint(len(lastKey)), lastKey, uvarint(offset), uvarint(length)），然后是每个索引项起始位置的uint32数组，最后是索引项个数uint32，整数均为小端序
+ */
+type indexBlock []byte
+
+func buildIndexBlock(entries []indexEntry) indexBlock {
+	var b []byte
+	starts := make([]uint32, len(entries))
+	for i, e := range entries {
+		starts[i] = uint32(len(b))
+		b = binary.AppendUvarint(b, uint64(len(e.lastKey)))
+		b = append(b, e.lastKey...)
+		b = binary.AppendUvarint(b, uint64(e.offset))
+		b = binary.AppendUvarint(b, uint64(e.length))
+	}
+	for _, s := range starts {
+		b = binary.LittleEndian.AppendUint32(b, s)
+	}
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(entries)))
+	return b
+}
+
+/* 索引项个数 */
+func (b indexBlock) len() int {
+	if len(b) < 4 {
+		return 0
+	}
+	return int(binary.LittleEndian.Uint32(b[len(b)-4:]))
+}
+
+/** 检查块的格式，所有索引项都在块内时返回nil，否则返回包装了ErrCorruption的错误
+ * 从文件中读取的索引块需先检查，entry和search不再检查边界
+ */
+func (b indexBlock) check() error {
+	if len(b) < 4 {
+		return fmt.Errorf("%w: index block has %d bytes", ErrCorruption, len(b))
+	}
+	n := uint64(binary.LittleEndian.Uint32(b[len(b)-4:]))
+	if n*4+4 > uint64(len(b)) {
+		return fmt.Errorf("%w: index block with %d bytes cannot hold %d entries", ErrCorruption, len(b), n)
+	}
+	end := len(b) - 4 - 4*int(n)
+	for i := 0; i < int(n); i++ {
+		pos := int(binary.LittleEndian.Uint32(b[end+4*i:]))
+		if pos >= end {
+			return fmt.Errorf("%w: index entry %d starts at %d, past the entries", ErrCorruption, i, pos)
+		}
+		p := b[pos:end]
+		keyLen, k := binary.Uvarint(p)
+		if k <= 0 || keyLen > uint64(len(p)-k) {
+			return fmt.Errorf("%w: bad key of index entry %d", ErrCorruption, i)
+		}
+		p = p[k+int(keyLen):]
+		for j := 0; j < 2; j++ {
+			if _, k = binary.Uvarint(p); k <= 0 {
+				return fmt.Errorf("%w: bad block handle of index entry %d", ErrCorruption, i)
+			}
+			p = p[k:]
+		}
+	}
+	return nil
+}
+
+/* 返回第i个索引项，lastKey直接引用块中的字节 */
+func (b indexBlock) entry(i int) indexEntry {
+	n := b.len()
+	pos := binary.LittleEndian.Uint32(b[len(b)-4-4*(n-i):])
+	p := b[pos:]
+	keyLen, k := binary.Uvarint(p)
+	p = p[k:]
+	e := indexEntry{lastKey: p[:keyLen:keyLen]}
+	p = p[keyLen:]
+	offset, k := binary.Uvarint(p)
+	length, _ := binary.Uvarint(p[k:])
+	e.offset, e.length = int(offset), int(length)
+	return e
+}
+
+/* 二分查找第一个lastKey不小于key的索引项，所有lastKey都小于key时返回len() */
+func (b indexBlock) search(cmp core.Comparator, key []byte) int {
+	lo, hi := 0, b.len()
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		if cmp.Compare(b.entry(mid).lastKey, key) < 0 {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
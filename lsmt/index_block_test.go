@@ -0,0 +1,52 @@
+package lsmt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+
+	"LSM-Tree/core"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexBlock(t *testing.T) {
+	entries := make([]indexEntry, 100)
+	for i := range entries {
+		entries[i] = indexEntry{lastKey: []byte(fmt.Sprintf("%03d", i*2)), offset: i * 300, length: 300}
+	}
+	b := buildIndexBlock(entries)
+	assert.Equal(t, 100, b.len())
+	for i, e := range entries {
+		assert.Equal(t, e, b.entry(i))
+	}
+	cmp := core.BytewiseComparator
+	assert.Equal(t, 0, b.search(cmp, []byte("")))
+	assert.Equal(t, 0, b.search(cmp, []byte("000")))
+	assert.Equal(t, 1, b.search(cmp, []byte("001")))
+	assert.Equal(t, 50, b.search(cmp, []byte("100")))
+	assert.Equal(t, 99, b.search(cmp, []byte("198")))
+	assert.Equal(t, 100, b.search(cmp, []byte("199")))
+
+	empty := buildIndexBlock(nil)
+	assert.Equal(t, 0, empty.len())
+	assert.Equal(t, 0, empty.search(cmp, []byte("a")))
+	assert.Nil(t, b.check())
+	assert.Nil(t, empty.check())
+}
+
+/* 格式错误的索引块返回ErrCorruption，不会在读取索引项时越界 */
+func TestIndexBlockCheck(t *testing.T) {
+	b := buildIndexBlock([]indexEntry{{lastKey: []byte("a"), offset: 0, length: 10}, {lastKey: []byte("b"), offset: 10, length: 10}})
+	// 过短、索引项个数过大、索引项起始位置越界、key长度越界
+	tooMany := append(indexBlock{}, b...)
+	binary.LittleEndian.PutUint32(tooMany[len(tooMany)-4:], 1000)
+	badStart := append(indexBlock{}, b...)
+	binary.LittleEndian.PutUint32(badStart[len(badStart)-8:], 1000)
+	badKey := append(indexBlock{}, b...)
+	badKey[0] = 100
+	for _, bad := range []indexBlock{b[:3], tooMany, badStart, badKey} {
+		assert.True(t, errors.Is(bad.check(), ErrCorruption))
+	}
+}
@@ -0,0 +1,75 @@
+package lsmt
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"LSM-Tree/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/* 记录所有日志的Logger */
+type recordingLogger struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (l *recordingLogger) record(level, msg string, ctx []interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.msgs = append(l.msgs, level+" "+msg+" "+fmt.Sprintf("%s", ctx))
+}
+
+func (l *recordingLogger) Debug(msg string, ctx ...interface{}) { l.record("DEBUG", msg, ctx) }
+func (l *recordingLogger) Info(msg string, ctx ...interface{})  { l.record("INFO", msg, ctx) }
+func (l *recordingLogger) Warn(msg string, ctx ...interface{})  { l.record("WARN", msg, ctx) }
+func (l *recordingLogger) Error(msg string, ctx ...interface{}) { l.record("ERROR", msg, ctx) }
+
+func (l *recordingLogger) count(substr string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	cnt := 0
+	for _, m := range l.msgs {
+		if strings.Contains(m, substr) {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+/* 导入包时不再创建日志文件 */
+func TestNoLogFileByDefault(t *testing.T) {
+	_, err := os.Stat("logfile.log")
+	assert.True(t, os.IsNotExist(err))
+	tree := NewLSMTree(0)
+	assert.Nil(t, tree.Put([]byte("k"), []byte("v")))
+	_, err = os.Stat("logfile.log")
+	assert.True(t, os.IsNotExist(err))
+}
+
+/* 跟踪的key前缀可在运行时修改 */
+func TestTracePrefix(t *testing.T) {
+	logger := &recordingLogger{}
+	conf := testConfig(func(c *config.Config) {
+		c.Logger = logger
+		c.TraceKeyPrefix = []byte("user")
+	})
+	tree := NewLSMTreeWithConfig(0, conf)
+
+	assert.Nil(t, tree.Put([]byte("user1"), []byte("v")))
+	assert.Nil(t, tree.Put([]byte("order1"), []byte("v")))
+	assert.Equal(t, 1, logger.count("==Trace==Put [key user1"))
+	assert.Equal(t, 0, logger.count("==Trace==Put [key order1"))
+
+	tree.SetTracePrefix(nil)
+	assert.Nil(t, tree.Put([]byte("user2"), []byte("v")))
+	assert.Equal(t, 0, logger.count("==Trace==Put [key user2"))
+
+	tree.SetTracePrefix([]byte("order"))
+	assert.Nil(t, tree.Delete([]byte("order1")))
+	assert.Equal(t, 1, logger.count("==Trace==Delete [key order1"))
+}
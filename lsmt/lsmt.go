@@ -2,34 +2,93 @@ package lsmt
 
 import (
 	"container/list"
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
-	"LSM-Tree/avlTree"
 	"LSM-Tree/config"
 	"LSM-Tree/core"
 	log "LSM-Tree/log"
 )
 
 type LSMTree struct {
-	/* 控制内存中tree和treesInFlush的并发读写 */
+	/* 控制内存中tree和treesInFlush的并发读写，跳表模式下读者无需加锁 */
 	rwm  sync.RWMutex
-	tree *avlTree.AVLTree
-	/* 从tree写入到硬盘的中间缓冲区列表，每个元素的类型是 *avlTree.AVLTree，指向一个缓冲区 */
-	treesInFlush   *list.List
+	tree Memtable
+	/* 从tree写入到硬盘的中间缓冲区列表，每个元素的类型是 Memtable，指向一个缓冲区 */
+	treesInFlush *list.List
+	/* treesInFlush中有树被移除或开始关闭时通知，与rwm配合使用 */
+	flushDone *sync.Cond
+	/* flush失败后重试前等待的时间 */
+	flushRetryDelay time.Duration
+	/* Close时关闭，通知正在重试或等待的flush放弃 */
+	closing chan struct{}
+	/* 内存中的树的键值对个数上限，0表示不限制，只按config.WriteBufferSize判断是否flush */
 	flushThreshold int
+	/* tree和treesInFlush的只读视图，类型为 *memView，每次修改tree或treesInFlush后更新 */
+	view atomic.Value
 
-	/* 控制对磁盘文件的并发读写 */
+	/* 控制对磁盘文件链表的并发修改，读者通过version读取磁盘文件，无需持有该锁 */
 	drwm sync.RWMutex
 	/** 多级磁盘文件
 	 * key即磁盘level，最低层是0，value即该level的磁盘文件列表 */
 	diskFiles map[int]*list.List
+	/* diskFiles的最新快照，每次修改diskFiles后更新，由versionMu保护 */
+	versionMu sync.Mutex
+	version   *Version
 	/* 包括内存中的元素、正在flush到磁盘和已经在磁盘中的元素个数 */
 	TotalSize int
 
 	config *config.Config
 	/* 是否正在进行磁盘文件归并 */
 	isCompacting bool
+	/* 正在进行的flush和compact，Close时等待它们结束 */
+	bg sync.WaitGroup
+	/* 时钟，用于判断键值对和文件是否过期，测试中可替换以模拟时间流逝 */
+	clock func() time.Time
+	/* 用于合并Merge写入的操作数，来自config.MergeOperator，为nil时不支持Merge */
+	mergeOperator MergeOperator
+	/* 运行统计 */
+	stats *Statistics
+	/* flush和compact的事件回调 */
+	listeners []EventListener
+	/* 上次检查时已满的目录，由storageMu保护，只在目录由未满变为已满时报告 */
+	storageMu sync.Mutex
+	fullDirs  map[string]bool
+	/* 多个LSMTree共享的内存预算，为nil时只受config.WriteBufferSize限制 */
+	wbm *WriteBufferManager
+	/* key的排序方式，来自config.Comparator */
+	cmp core.Comparator
+	/* 日志，来自config.Logger，为nil时丢弃所有日志 */
+	logger log.Logger
+	/* 按key前缀过滤的跟踪日志，运行时可通过SetTracePrefix开关 */
+	tracer *log.Tracer
+
+	/* 预写日志，config.WALDir为空时为nil */
+	wal *logWriter
+	/* 每棵尚未flush的内存中的树中的数据所在的最早的日志编号，由rwm保护，flush后更早的日志可以删除 */
+	memLogs map[Memtable]int
+	/* 当前的树的数据将写入的日志编号，rotateLog为true时是切换后的新日志，二者都由rwm保护 */
+	nextLog int
+	/* toFlush后需要切换日志文件，由下一次写入日志的写者在rwm之外完成 */
+	rotateLog bool
+	/* 等待写入的写者队列，队首的写者合并提交整个队列，由writeMu保护 */
+	writeMu   sync.Mutex
+	writeCond *sync.Cond
+	writers   []*writer
+	/* 关闭时停止定期Sync日志的后台线程 */
+	syncerStop chan struct{}
+	/* flush发布新文件并将树移出treesInFlush期间持有，Checkpoint持有它时看到的磁盘文件和内存中的树不会包含相同的数据 */
+	installMu sync.Mutex
+	/* 清单所在的目录，为空时不写清单，磁盘文件只在本次打开期间有效 */
+	manifestDir string
+	/* 清单中记录的重放日志的起点，由drwm保护 */
+	logNum int
+	/* 只读实例拒绝所有写入，不flush也不归并；secondary实例还可以通过TryCatchUpWithPrimary跟上主实例 */
+	readOnly  bool
+	secondary bool
 }
 
 // debug
@@ -55,118 +114,226 @@ type LSMTree struct {
 // }
 
 func NewLSMTree(flushThreshold int) *LSMTree {
+	return NewLSMTreeWithConfig(flushThreshold, config.DefaultConfig())
+}
+
+/** 使用指定的配置创建LSMTree
+ * 内存中的树占用的字节数达到config.WriteBufferSize时flush；flushThreshold大于0时，键值对个数达到flushThreshold也会flush，0表示只按字节数flush
+ * config.WALDir非空时与Open相同，重放日志失败时panic
+ */
+func NewLSMTreeWithConfig(flushThreshold int, conf *config.Config) *LSMTree {
+	t, err := Open(flushThreshold, conf)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+/** 使用指定的配置打开LSMTree，config.WALDir非空时先重放其中的日志，恢复上次关闭或崩溃时尚未flush的数据
+ * 同时设置了磁盘文件的目录时，WALDir中还保存记录各层磁盘文件的清单，打开时重新加载其中的文件，并删除目录中不在清单里的磁盘文件，只重放尚未flush的日志
+ * 最后一个日志末尾不完整或损坏的记录视为崩溃时没有写完的记录，被丢弃；更早的日志中有损坏的记录时返回包装了ErrCorruption的错误
+ * 日志中有merge操作数而config.MergeOperator为nil时返回错误
+ */
+func Open(flushThreshold int, conf *config.Config) (*LSMTree, error) {
+	if err := checkLevelDirs(conf); err != nil {
+		return nil, err
+	}
+	t := newLSMTree(flushThreshold, conf)
+	dirs := conf.LevelDirs
+	if len(dirs) == 0 && conf.MmapDir != "" {
+		dirs = []string{conf.MmapDir}
+	}
+	for _, dir := range dirs {
+		if err := conf.FS.MkdirAll(dir); err != nil {
+			return nil, fmt.Errorf("create level directory %s: %w", dir, err)
+		}
+	}
+	if conf.WALDir != "" && conf.DirForLevel(0) != "" {
+		t.manifestDir = conf.WALDir
+		levels, logNum, err := t.openManifest(nil)
+		if err != nil {
+			return nil, fmt.Errorf("load manifest in %s: %w", conf.WALDir, err)
+		}
+		t.installManifest(levels, logNum)
+		if err := t.removeObsoleteFiles(); err != nil {
+			return nil, fmt.Errorf("remove obsolete disk files: %w", err)
+		}
+	}
+	if conf.WALDir != "" {
+		if err := t.openWAL(); err != nil {
+			return nil, fmt.Errorf("open log in %s: %w", conf.WALDir, err)
+		}
+	}
+	if conf.CompactionStyle == config.CompactionStyleFIFO && conf.FIFOTTL > 0 {
+		// 每个文件最多在过期后FIFOTTL/4内被删除，在此之前读取时已跳过
+		t.goBackground(func() { t.dropExpiredPeriodically(conf.FIFOTTL/4, t.closing) })
+	}
+	return t, nil
+}
+
+func newLSMTree(flushThreshold int, conf *config.Config) *LSMTree {
 	t := &LSMTree{
-		flushThreshold: flushThreshold,
-		tree:           &avlTree.AVLTree{},
-		treesInFlush:   list.New(),
-		diskFiles:      make(map[int]*list.List),
-		config:         config.DefaultConfig(),
-		isCompacting:   false,
+		flushThreshold:  flushThreshold,
+		treesInFlush:    list.New(),
+		flushRetryDelay: time.Second,
+		closing:         make(chan struct{}),
+		diskFiles:       make(map[int]*list.List),
+		config:          conf,
+		isCompacting:    false,
+		clock:           time.Now,
+		cmp:             conf.Comparator,
+		mergeOperator:   conf.MergeOperator,
+		stats:           newStatistics(conf.FileLevelCnt),
 	}
-	if t.flushThreshold == 0 {
-		t.flushThreshold = t.config.ElemCnt2Flush
+	if t.cmp == nil {
+		t.cmp = core.BytewiseComparator
 	}
+	t.logger = conf.Logger
+	if t.logger == nil {
+		t.logger = log.Discard
+	}
+	t.tracer = log.NewTracer(t.logger, conf.TraceKeyPrefix)
+	t.flushDone = sync.NewCond(&t.rwm)
+	t.writeCond = sync.NewCond(&t.writeMu)
+	t.tree = t.newMemtable()
+	t.publishView()
 
 	for i := 0; i < t.config.FileLevelCnt; i++ {
 		t.diskFiles[i] = list.New()
 	}
+	t.installVersion()
 	return t
 }
 
-func (t *LSMTree) Put(key, value string) {
-	if value == t.config.DeleteValue {
-		log.Logger.Error(fmt.Sprintf("Error occurs during Put(key:'%v',value:'%v'). This value is reserved as special delete value, try another value or use escape characters", key, value))
-		return
+/** 修改跟踪日志的key前缀，可在运行时调用
+ * prefix为nil时关闭跟踪，为空切片时跟踪所有key
+ */
+func (t *LSMTree) SetTracePrefix(prefix []byte) {
+	t.tracer.SetPrefix(prefix)
+}
+
+/* 替换LSMTree使用的时钟，需在读写之前调用 */
+func (t *LSMTree) SetClock(clock func() time.Time) {
+	t.clock = clock
+}
+
+func (t *LSMTree) Put(key, value []byte) error {
+	return t.put(key, value, 0, WriteOptions{})
+}
+
+/* 写入一个在ttl时长后过期的键值对，过期后Get读取不到该key，归并时该键值对会被删除 */
+func (t *LSMTree) PutWithTTL(key, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("%w: ttl must be positive, got %v", ErrInvalidArgument, ttl)
 	}
-	t.rwm.Lock()
-	defer t.rwm.Unlock()
-	log.Trace(fmt.Sprintf("Put(key: %v, value: %v)", key, value))
-	t.TotalSize += t.tree.Add(key, value)
-	// log.Logger.Debug("LSMTree Put or Update", "key", key, "value", value)
-	if t.tree.Size() >= t.flushThreshold {
-		// Trigger flush.
-		// log.Logger.Debug("LSMTree triggers flush", "Treesize", t.tree.Size())
-		t.toFlush()
+	return t.put(key, value, t.clock().Add(ttl).UnixNano(), WriteOptions{})
+}
+
+func (t *LSMTree) put(key, value []byte, expireAt int64, opts WriteOptions) error {
+	b := &WriteBatch{}
+	b.Put(key, value)
+	b.ops[0].expireAt = expireAt
+	return t.writeOne(b, opts)
+}
+
+func (t *LSMTree) Delete(key []byte) error {
+	return t.DeleteWithOptions(key, WriteOptions{})
+}
+
+/** 删除[start, end)内的所有key
+ * 内存中的树里已有的key直接写入删除标记，更旧的数据则由写入树中的范围删除标记覆盖，flush和compact时范围删除标记随数据一起写入磁盘文件
+ * 跳表模式下读者不加锁，DeleteRange返回前并发的读者可能看到范围内只有一部分key被删除
+ */
+func (t *LSMTree) DeleteRange(start, end []byte) error {
+	b := &WriteBatch{}
+	b.DeleteRange(start, end)
+	return t.Write(b, WriteOptions{})
+}
+
+/* 检查key的长度，空key是合法的 */
+func (t *LSMTree) validateKey(key []byte) error {
+	if t.config.MaxKeySize > 0 && len(key) > t.config.MaxKeySize {
+		return fmt.Errorf("%w: key size %d exceeds limit %d", ErrInvalidKey, len(key), t.config.MaxKeySize)
 	}
+	return nil
 }
 
-func (t *LSMTree) Delete(key string) {
-	t.rwm.Lock()
-	defer t.rwm.Unlock()
-	log.Trace(fmt.Sprintf("Delete(key: %v)", key))
-	t.TotalSize += t.tree.Add(key, t.config.DeleteValue)
-	if t.tree.Size() >= t.flushThreshold {
-		t.toFlush()
+func (t *LSMTree) validateValue(value []byte) error {
+	if t.config.MaxValueSize > 0 && len(value) > t.config.MaxValueSize {
+		return fmt.Errorf("%w: value size %d exceeds limit %d", ErrValueTooLarge, len(value), t.config.MaxValueSize)
 	}
+	return nil
 }
 
-func (t *LSMTree) Get(key string) (string, error) {
-	deleteVal := t.config.DeleteValue
-	t.rwm.RLock()
-	if node := t.tree.Search(key); node != nil {
-		if node.Value == deleteVal {
-			// 该key已被删除
-			t.rwm.RUnlock()
-			return "", fmt.Errorf("key %s was deleted", key)
-		}
-		t.rwm.RUnlock()
-		return node.Value, nil
+func (t *LSMTree) Get(key []byte) ([]byte, error) {
+	start := time.Now()
+	g := &getter{t: t, key: key, now: t.clock().UnixNano()}
+	t.get(g)
+	t.stats.recordGet(start, g.filesProbed, g.err == nil)
+	return g.val, g.err
+}
+
+/* 从新到旧依次在内存中的树和各层磁盘文件中查找，结果保存在g中 */
+func (t *LSMTree) get(g *getter) {
+	key := g.key
+	view, release := t.acquireView()
+	g.searchTree(view.mutable)
+	for i := 0; i < len(view.immutables) && !g.done; i++ {
+		g.searchTree(view.immutables[i])
 	}
-	for e := t.treesInFlush.Front(); e != nil; e = e.Next() {
-		treeInFlush := e.Value.(*avlTree.AVLTree)
-		if node := treeInFlush.Search(key); node != nil {
-			if node.Value == deleteVal {
-				// 该key已被删除
-				t.rwm.RUnlock()
-				return "", fmt.Errorf("key %s was deleted", key)
-			}
-			t.rwm.RUnlock()
-			return node.Value, nil
-		}
+	release()
+	if g.done {
+		return
 	}
-	t.rwm.RUnlock()
 	// The key is not in memory. Search in disk files.
-	t.drwm.RLock()
-	defer t.drwm.RUnlock()
+	v := t.CurrentVersion()
+	defer v.Release()
 
 	// 从最前面的最新磁盘文件开始往后搜，搜到的第一个即返回
-	log.Trace(fmt.Sprintf("get key %v, current file level: %d\n", key, 0))
-	for e := t.diskFiles[0].Front(); e != nil; e = e.Next() {
-		d := e.Value.(*DiskFile)
+	t.tracer.Trace(key, "Get searching disk files", "level", 0)
+	now := time.Unix(0, g.now)
+	for _, d := range v.levels[0] {
+		if t.fifoExpired(d, now) {
+			continue
+		}
+		g.filesProbed++
 		elem, err := d.Search(key)
 		if err == nil {
 			// found in disk
-			// found in disk
-			log.Trace("found key in level-0 file", "file start key", d.start_key, "file end key", d.end_key)
-			if elem.Value == deleteVal {
-				log.Trace("this key was deleted")
-				return "", fmt.Errorf("key %s was deleted", key)
-			}
-			return elem.Value, nil
+			t.tracer.Trace(key, "found key in level-0 file", "diskID", d.id, "fileStartKey", d.start_key, "fileEndKey", d.end_key)
+			g.found(&elem)
+		} else if errors.Is(err, ErrCorruption) {
+			g.fail(err)
+			return
+		}
+		if !g.done && IsCoveredByRangeTombstones(t.cmp, d.range_dels, key) {
+			t.tracer.Trace(key, "this key was deleted by range tombstone", "diskID", d.id)
+			g.covered()
+		}
+		if g.done {
+			return
 		}
 	}
 
 	// 从level1开始，每层文件都是有序的，只需找到该key所在的文件，在该文件内搜索即可
 	for i := 1; i < t.config.FileLevelCnt; i++ {
-		log.Trace(fmt.Sprintf("get key %v, current file level: %d\n", key, i))
-		files := t.diskFiles[i]
-		if files.Len() == 0 {
-			continue
-		}
-		for e := files.Front(); e != nil; e = e.Next() {
-			d := e.Value.(*DiskFile)
-			// log.Logger.Debug("file key range", "start", d.start_key, "end", d.end_key)
-			if d.start_key <= key && d.end_key >= key {
-				log.Trace("found file")
+		t.tracer.Trace(key, "Get searching disk files", "level", i)
+		for _, d := range v.levels[i] {
+			// t.logger.Debug("file key range", "start", d.start_key, "end", d.end_key)
+			if t.cmp.Compare(d.start_key, key) <= 0 && t.cmp.Compare(d.end_key, key) >= 0 {
+				t.tracer.Trace(key, "found file", "diskID", d.id)
+				g.filesProbed++
 				elem, err := d.Search(key)
 				if err == nil {
 					// found in disk
-					log.Trace("found key in level-1 file", "file start key", d.start_key, "file end key", d.end_key)
-					if elem.Value == deleteVal {
-						log.Trace("this key was deleted")
-						return "", fmt.Errorf("key %s was deleted", key)
+					t.tracer.Trace(key, "found key in level-1 file", "diskID", d.id, "fileStartKey", d.start_key, "fileEndKey", d.end_key)
+					g.found(&elem)
+					if g.done {
+						return
 					}
-					return elem.Value, nil
+				} else if errors.Is(err, ErrCorruption) {
+					g.fail(err)
+					return
 				}
 				// 不在此层级中，往下一层找
 				break
@@ -174,36 +341,276 @@ func (t *LSMTree) Get(key string) (string, error) {
 		}
 	}
 
-	return "", fmt.Errorf("key %s not found", key)
+	g.finish(nil, fmt.Errorf("key %s not found", key))
+}
+
+/** 一次Get的查找状态
+ * 从最新的数据往最旧的数据逐层查找，遇到merge操作数时记录下来并继续往更旧的数据查找，直到遇到完整的value、删除标记或查找完所有数据，再将记录的操作数与value合并得到结果
+ */
+type getter struct {
+	t   *LSMTree
+	key []byte
+	now int64
+	// 沿途收集的merge操作数，从新到旧
+	operands [][]byte
+	// 查找过的磁盘文件个数
+	filesProbed int
+
+	done bool
+	val  []byte
+	err  error
+}
+
+/* 在内存中的一棵树里查找key */
+func (g *getter) searchTree(tree Memtable) {
+	if elem := tree.Get(g.key); elem != nil {
+		g.found(elem)
+	}
+	if !g.done && IsCoveredByRangeTombstones(g.t.cmp, tree.RangeTombstones(), g.key) {
+		g.covered()
+	}
+}
+
+/* 读取磁盘文件失败，结束查找并返回err */
+func (g *getter) fail(err error) {
+	g.t.logger.Error("failed to read diskFile", "key", g.key, "err", err)
+	g.done, g.err = true, err
+}
+
+/* 处理在某一层中找到的key对应的元素 */
+func (g *getter) found(e *core.Element) {
+	switch {
+	case e.IsExpired(g.now):
+		// 已过期的键值对视为不存在，且不再往更旧的数据中查找
+		g.t.tracer.Trace(g.key, "this key was expired")
+		g.finish(nil, fmt.Errorf("key %s not found", g.key))
+	case string(e.Value) == g.t.config.DeleteValue:
+		g.t.tracer.Trace(g.key, "this key was deleted")
+		g.finish(nil, fmt.Errorf("key %s was deleted", g.key))
+	case e.IsMerge:
+		g.operands = append(g.operands, e.Value)
+	default:
+		// 空value经过编码后可能变为nil，需与不存在区分开
+		val := e.Value
+		if val == nil {
+			val = []byte{}
+		}
+		g.finish(val, nil)
+	}
+}
+
+/* 某一层的范围删除标记覆盖了key，更旧的数据均不可见 */
+func (g *getter) covered() {
+	g.finish(nil, fmt.Errorf("key %s was deleted", g.key))
+}
+
+/** 结束查找，base为最终找到的完整value，nil表示不存在
+ * 没有收集到merge操作数时，base为nil则返回missErr
+ */
+func (g *getter) finish(base []byte, missErr error) {
+	g.done = true
+	if len(g.operands) == 0 {
+		if base == nil {
+			g.err = missErr
+		} else {
+			g.val = base
+		}
+		return
+	}
+	if g.t.mergeOperator == nil {
+		g.err = fmt.Errorf("key %s has merge operands but no merge operator is set", g.key)
+		return
+	}
+	// 操作数按从旧到新的顺序作用在base上
+	operands := make([][]byte, len(g.operands))
+	for i, op := range g.operands {
+		operands[len(operands)-1-i] = op
+	}
+	g.val, g.err = g.t.mergeOperator.FullMerge(g.key, base, operands)
+}
+
+/* 写入内存中的树之前调用，超出共享的内存预算时flush或阻塞，调用者不能持有rwm */
+func (t *LSMTree) beforeWrite() {
+	if t.wbm != nil {
+		if stalled := t.wbm.beforeWrite(t); stalled > 0 {
+			t.stats.recordStall(stalled)
+		}
+	}
+}
+
+/* 写入内存中的树之后调用，更新内存用量并在树满时flush，调用者需持有rwm的写锁 */
+func (t *LSMTree) afterWrite() {
+	if t.wbm != nil {
+		t.wbm.setMutable(t, t.tree.ApproximateMemoryUsage())
+	}
+	if t.shouldFlush() {
+		// Trigger flush.
+		// t.logger.Debug("LSMTree triggers flush", "Treesize", t.tree.Size())
+		t.toFlush()
+	}
+}
+
+/* 判断内存中的树是否已满，调用者需持有rwm的写锁 */
+func (t *LSMTree) shouldFlush() bool {
+	if t.flushThreshold > 0 && t.tree.Size() >= t.flushThreshold {
+		return true
+	}
+	return t.tree.ApproximateMemoryUsage() >= t.config.WriteBufferSize
 }
 
 func (t *LSMTree) toFlush() {
+	if t.readOnly {
+		return
+	}
 	// 此函数包含对树的操作，需加锁或在调用本函数的其他函数上下文中加锁
+	if t.wbm != nil {
+		t.wbm.markImmutable(t, t.tree.ApproximateMemoryUsage())
+	}
 	e := t.treesInFlush.PushFront(t.tree) // 最新的树加在链表最前面
-	// log.Logger.Debug(fmt.Sprintf("now we have %d treeInFlush.", t.treesInFlush.Len()))
-	t.tree = &avlTree.AVLTree{}
-	go t.flush(e.Value.(*avlTree.AVLTree))
+	// t.logger.Debug(fmt.Sprintf("now we have %d treeInFlush.", t.treesInFlush.Len()))
+	t.tree = t.newMemtable()
+	if t.wal != nil {
+		// 新的树从新的日志文件开始，旧的树flush后它的日志文件可以删除；切换时需要Sync，不在rwm下进行
+		if !t.rotateLog {
+			t.rotateLog = true
+			t.nextLog++
+		}
+		t.memLogs[t.tree] = t.nextLog
+	}
+	t.publishView()
+	t.goBackground(func() { t.flush(e.Value.(Memtable)) })
 }
 
 /** 创建一个新的磁盘文件，将一个缓冲区的内容写入到磁盘文件
- * 写入完成后，将该缓冲区指针从链表中移除
+ * 写入完成后，将该缓冲区指针从链表中移除；写入失败时树保留在treesInFlush中，等待flushRetryDelay后重试，直到成功或关闭
  */
-func (t *LSMTree) flush(treeInFlush *avlTree.AVLTree) {
+func (t *LSMTree) flush(treeInFlush Memtable) {
+	info := FlushJobInfo{Entries: treeInFlush.Size(), MemoryUsage: treeInFlush.ApproximateMemoryUsage()}
+	t.notify(func(l EventListener) { l.OnFlushBegin(info) })
+	start := time.Now()
+	// 共享预算中该树占用的字节数只释放一次
+	released := false
+	release := func() {
+		if t.wbm != nil && !released {
+			released = true
+			t.wbm.freeImmutable(info.MemoryUsage)
+		}
+	}
 	// Create a new disk file.
-	d := NewDiskFile(treeInFlush.Inorder(), 0)
+	d, err := t.newFlushFile(treeInFlush)
+	for err != nil {
+		// 内存中的树中的数据仍可被读取，更新的树在它写入磁盘之前不会发布文件
+		t.backgroundError(BackgroundErrorFlush, err)
+		// 重试不一定能成功，不再让共享预算的写者等待这棵树
+		release()
+		select {
+		case <-t.closing:
+			return
+		case <-time.After(t.flushRetryDelay):
+		}
+		d, err = t.newFlushFile(treeInFlush)
+	}
+	t.stats.recordFlush(d.GetFileSize())
+	if !t.waitOlderFlushes(treeInFlush) {
+		// 关闭时更早的树仍未写入，放弃新文件，数据仍在日志中
+		d.unref()
+		release()
+		return
+	}
+	t.installMu.Lock()
+	// 该树的数据写入文件后，更早的日志只在清单更新后才能删除
+	t.rwm.Lock()
+	delete(t.memLogs, treeInFlush)
+	minLog := t.minMemLog()
+	t.rwm.Unlock()
 	// Put the disk file in the list.
 	t.drwm.Lock()
 	// 最新的文件放在最前面
 	t.diskFiles[0].PushFront(d)
-	// log.Logger.Debug(fmt.Sprintf("now we have %d diskFiles in level-0.", t.diskFiles[0].Len()))
-	if t.diskFiles[0].Len() >= t.config.MaxLevel0FileCnt {
-		go t.compact(0)
+	// t.logger.Debug(fmt.Sprintf("now we have %d diskFiles in level-0.", t.diskFiles[0].Len()))
+	var dropped []*DiskFile
+	if t.config.CompactionStyle == config.CompactionStyleFIFO {
+		// FIFO模式下不做归并，只删除超出体积上限或过期的旧文件
+		dropped = t.compactFIFO()
+	} else if t.diskFiles[0].Len() >= t.config.MaxLevel0FileCnt {
+		t.goBackground(func() { t.compact(0) })
+	}
+	manifestErr := t.saveManifest(minLog)
+	if manifestErr != nil {
+		// 清单中仍有被删除的文件，保留它们
+		for _, f := range dropped {
+			atomic.StoreInt32(&f.keep, 1)
+		}
 	}
+	t.stats.updateLevels(t.installVersion().LevelSummary())
 	t.drwm.Unlock()
+	// 新文件已被Version引用，释放创建时持有的引用
+	d.unref()
 	// Remove the tree in flush.
 	t.rwm.Lock()
 	ListRemove(t.treesInFlush, treeInFlush)
+	t.publishView()
+	t.flushDone.Broadcast()
 	t.rwm.Unlock()
+	t.installMu.Unlock()
+	if manifestErr != nil {
+		// 日志仍然保留，下次打开时重放
+		t.backgroundError(BackgroundErrorFlush, manifestErr)
+	} else if t.wal != nil {
+		if err := t.wal.removeBefore(minLog); err != nil {
+			t.logger.Error("failed to remove obsolete logs", "err", err)
+		}
+	}
+	release()
+
+	info.OutputFile = newTableFileInfo(d, FileReasonFlush)
+	info.Duration = time.Since(start)
+	t.notify(func(l EventListener) { l.OnFileCreated(info.OutputFile) })
+	for _, f := range newTableFileInfos(dropped, FileReasonFIFO) {
+		t.notify(func(l EventListener) { l.OnFileDeleted(f) })
+	}
+	t.checkStorage()
+	t.notify(func(l EventListener) { l.OnFlushCompleted(info) })
+}
+
+/** 等待比tree更早的树flush完成，关闭时仍有更早的树未完成则返回false
+ * 多棵树可以同时flush，但level0文件需按树的新旧顺序排列，否则较旧的数据会覆盖较新的数据；读取时treesInFlush中的树先于磁盘文件，flush失败的树也不能被更新的文件越过
+ */
+func (t *LSMTree) waitOlderFlushes(tree Memtable) bool {
+	t.rwm.Lock()
+	defer t.rwm.Unlock()
+	for t.hasOlderFlush(tree) {
+		if t.isClosing() {
+			return false
+		}
+		t.flushDone.Wait()
+	}
+	return true
+}
+
+/* 判断treesInFlush中是否有比tree更早的树，调用者需持有rwm的写锁 */
+func (t *LSMTree) hasOlderFlush(tree Memtable) bool {
+	return t.treesInFlush.Back() != nil && t.treesInFlush.Back().Value != tree
+}
+
+func (t *LSMTree) isClosing() bool {
+	select {
+	case <-t.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+/* 将内存中的树写入一个新的level0文件 */
+func (t *LSMTree) newFlushFile(tree Memtable) (*DiskFile, error) {
+	d, err := t.newDiskFile(tree.Inorder(), 0)
+	if err != nil {
+		return nil, err
+	}
+	d.create_time = t.clock()
+	d.setRangeTombstones(tree.RangeTombstones())
+	return d, nil
 }
 
 func (t *LSMTree) compact0isDone() bool {
@@ -231,21 +638,43 @@ func (t *LSMTree) compact(level int) {
 		files_1 := make([]*DiskFile, 0)
 		for e := t.diskFiles[1].Front(); e != nil; e = e.Next() {
 			d := e.Value.(*DiskFile)
-			if d.start_key > max_key {
+			if t.cmp.Compare(d.start_key, max_key) > 0 {
 				// level1及以上的文件是有序的，所以某个文件最小的key超过当前key的范围时可以结束遍历
 				break
 			}
-			if d.end_key < min_key {
+			if t.cmp.Compare(d.end_key, min_key) < 0 {
 				// 往后遍历直到找到有与level0的key范围重叠的文件
 				continue
 			}
 			files_1 = append(files_1, d)
 		}
+		// 归并期间持有输入文件的引用，其他线程删除这些文件时不会释放它们的数据
+		refFiles(files_0)
+		refFiles(files_1)
+		t.logger.Debug(fmt.Sprintf("Start compacting. Now we have %d files in level0, %d files in level1\n", t.diskFiles[0].Len(), t.diskFiles[1].Len()))
 		t.drwm.RUnlock()
-		log.Logger.Debug(fmt.Sprintf("Start compacting. Now we have %d files in level0, %d files in level1\n", t.diskFiles[0].Len(), t.diskFiles[1].Len()))
 		// t.Print_Files_1_Ranges()
+		info := CompactionJobInfo{
+			InputLevel:  0,
+			OutputLevel: 1,
+			InputFiles:  append(newTableFileInfos(files_0, FileReasonCompaction), newTableFileInfos(files_1, FileReasonCompaction)...),
+		}
+		t.notify(func(l EventListener) { l.OnCompactionBegin(info) })
+		start := time.Now()
 		// 根据得到的level0文件指针和level1文件指针进行合并
-		new_files1 := t.compact_0(files_0, files_1)
+		new_files1, err := t.compact_0(files_0, files_1)
+		if err != nil {
+			// 归并失败时保留输入文件，等待下一次flush再触发归并
+			t.drwm.Lock()
+			t.isCompacting = false
+			t.drwm.Unlock()
+			unrefFiles(files_0)
+			unrefFiles(files_1)
+			info.Duration, info.Err = time.Since(start), err
+			t.backgroundError(BackgroundErrorCompaction, err)
+			t.notify(func(l EventListener) { l.OnCompactionCompleted(info) })
+			return
+		}
 		t.drwm.Lock()
 		// 删除合并前的文件，插入合并后产生的新文件
 		for _, file0 := range files_0 {
@@ -256,11 +685,34 @@ func (t *LSMTree) compact(level int) {
 		}
 		// 根据前后文件的key，插入到合适的地方
 		ListInsert(t.diskFiles[1], new_files1)
+		t.stats.recordCompaction(diskFilesSize(files_0)+diskFilesSize(files_1), diskFilesSize(new_files1))
+		t.stats.updateLevels(t.installVersion().LevelSummary())
+		if err := t.saveManifest(0); err != nil {
+			// 清单仍指向输入文件，它们在本次打开期间不会被删除
+			for _, d := range append(files_0, files_1...) {
+				atomic.StoreInt32(&d.keep, 1)
+			}
+			t.backgroundError(BackgroundErrorCompaction, err)
+		}
 
-		log.Logger.Debug(fmt.Sprintf("Successfully compact. Now we have %d files in level0, %d files in level1\n", t.diskFiles[0].Len(), t.diskFiles[1].Len()))
+		t.logger.Debug(fmt.Sprintf("Successfully compact. Now we have %d files in level0, %d files in level1\n", t.diskFiles[0].Len(), t.diskFiles[1].Len()))
 		// t.Print_Files_1_Ranges()
 		t.isCompacting = false
 		t.drwm.Unlock()
+		unrefFiles(files_0)
+		unrefFiles(files_1)
+		unrefFiles(new_files1)
+
+		info.OutputFiles = newTableFileInfos(new_files1, FileReasonCompaction)
+		info.Duration = time.Since(start)
+		for _, f := range info.OutputFiles {
+			t.notify(func(l EventListener) { l.OnFileCreated(f) })
+		}
+		for _, f := range info.InputFiles {
+			t.notify(func(l EventListener) { l.OnFileDeleted(f) })
+		}
+		t.checkStorage()
+		t.notify(func(l EventListener) { l.OnCompactionCompleted(info) })
 
 		if !t.compact0isDone() {
 			t.compact(0)
@@ -271,37 +723,55 @@ func (t *LSMTree) compact(level int) {
 
 /** 接收level0的所有文件，以及level1的所有key与level0有重叠的文件，合并成新的level1文件并返回
  * 整体的合并的过程是：先将level0的所有文件合并成一个，再将合并后的文件与level1的文件逐个合并
+ * 读取输入文件、合并merge操作数或写入新文件失败时返回错误，已写入的新文件被删除，输入文件保持不变
  */
-func (t *LSMTree) compact_0(files_0 []*DiskFile, files_1 []*DiskFile) []*DiskFile {
-	log.Logger.Debug(fmt.Sprintf("compacting... files0_cnt_to_merge: %d, files1_cnt_to_merge: %d", len(files_0), len(files_1)))
+func (t *LSMTree) compact_0(files_0 []*DiskFile, files_1 []*DiskFile) (new_files1 []*DiskFile, err error) {
+	defer func() {
+		if err != nil {
+			unrefFiles(new_files1)
+			new_files1 = nil
+		}
+	}()
+	t.logger.Debug(fmt.Sprintf("compacting... files0_cnt_to_merge: %d, files1_cnt_to_merge: %d", len(files_0), len(files_1)))
 	// 先对files0进行排序
 	elems := make([][]*core.Element, len(files_0))
+	// 较新文件的范围删除标记会覆盖较旧文件中的key，files_0中index越小的文件越新
+	range_dels := make([]core.RangeTombstone, 0)
 	// file0_elem_cnt := 0
 	for i := 0; i < len(files_0); i++ {
-		elems[i] = files_0[i].AllElements()
+		file_elems, err := files_0[i].AllElements()
+		if err != nil {
+			return nil, fmt.Errorf("read level-0 file %d: %w", files_0[i].id, err)
+		}
+		elems[i] = DropCovered(t.cmp, file_elems, range_dels)
+		range_dels = append(range_dels, files_0[i].range_dels...)
 		// log.Trace(fmt.Sprintf("file0 size : %d, key range[%v,%v]", len(elems[i]), files_0[i].start_key, files_0[i].end_key))
 	}
 	// for i := 0; i < len(files_1); i++ {
 	// 	tmp := files_1[i].AllElements()
 	// 	log.Trace(fmt.Sprintf("file1 size : %d, key range[%v,%v]", len(tmp), files_1[i].start_key, files_1[i].end_key))
 	// }
-	sorted_files0_elems := MergeUpdate(elems)
-	log.Trace(fmt.Sprintf("sorted_files0_elems size : %d, key range[%v,%v]", len(sorted_files0_elems),
-		sorted_files0_elems[0].Key, sorted_files0_elems[len(sorted_files0_elems)-1].Key))
-	new_files1 := make([]*DiskFile, 0)
-
+	now := t.clock().UnixNano()
+	// 较新的merge操作数与较旧的记录部分合并
+	sorted_files0_elems, err := MergeUpdateWith(elems, t.cmp, func(newer, older *core.Element) (*core.Element, error) {
+		return t.combine(newer, older, now)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(sorted_files0_elems) > 0 {
+		t.logger.Debug(fmt.Sprintf("sorted_files0_elems size : %d, key range[%s,%s]", len(sorted_files0_elems),
+			sorted_files0_elems[0].Key, sorted_files0_elems[len(sorted_files0_elems)-1].Key))
+	}
 	index0 := 0
 	new_file_elems := make([]*core.Element, 0)
+	// new_file_elems的近似字节数
+	new_file_bytes := 0
 
 	if len(files_1) == 0 { // level-1没有key与level-0重叠的文件,直接写入新level-1文件
-		for index0 < len(sorted_files0_elems) {
-			upperbound := Min(index0+t.config.LevelLFileSize, len(sorted_files0_elems))
-			new_disk_file := NewDiskFile(sorted_files0_elems[index0:upperbound], 1)
-			log.Trace(fmt.Sprintf("new file1 size : %d, key range[%v,%v]", upperbound-index0, new_disk_file.start_key, new_disk_file.end_key))
-			new_files1 = append(new_files1, new_disk_file)
-			index0 = upperbound
-		}
-		return new_files1
+		// 没有更旧的记录需要被覆盖，可以直接丢弃过期的键值对
+		sorted_files0_elems = DropExpired(sorted_files0_elems, now)
+		return t.newLevel1Files(sorted_files0_elems)
 	}
 
 	var file1_idx int
@@ -310,42 +780,63 @@ func (t *LSMTree) compact_0(files_0 []*DiskFile, files_1 []*DiskFile) []*DiskFil
 	file1_elem_cnt := 0
 	merge_elem_cnt := 0
 	for file1_idx = 0; file1_idx < len(files_1); file1_idx++ {
-		old_file_elems = files_1[file1_idx].AllElements()
+		// level1中被level0的范围删除标记覆盖的key也一并删除
+		// 目前只有level0向level1的归并，level1即最底层，合并后范围删除标记本身可以丢弃
+		file_elems, err := files_1[file1_idx].AllElements()
+		if err != nil {
+			return new_files1, fmt.Errorf("read level-1 file %d: %w", files_1[file1_idx].id, err)
+		}
+		old_file_elems = DropCovered(t.cmp, DropExpired(file_elems, now), range_dels)
 		file1_elem_cnt += len(old_file_elems)
 		index1 = 0
 		for {
 			if index1 >= len(old_file_elems) {
-				// log.Logger.Debug(fmt.Sprintf("compact_0. break..index1..new_files_elems: %d", len(new_file_elems)))
+				// t.logger.Debug(fmt.Sprintf("compact_0. break..index1..new_files_elems: %d", len(new_file_elems)))
 				break
 			}
 			if index0 >= len(sorted_files0_elems) {
-				// log.Logger.Debug(fmt.Sprintf("compact_0. break..index0..new_files_elems: %d", len(new_file_elems)))
+				// t.logger.Debug(fmt.Sprintf("compact_0. break..index0..new_files_elems: %d", len(new_file_elems)))
 				// 将file1（可能大于1个文件）剩下的元素也加到new_file_elems中
-				new_file_elems = append(new_file_elems, old_file_elems[index1:]...)
+				for _, e := range old_file_elems[index1:] {
+					new_file_elems = append(new_file_elems, e)
+					new_file_bytes += e.ApproximateSize()
+				}
 				// index1 = len(old_file_elems)
 				break
 			}
 
-			if old_file_elems[index1].Key < sorted_files0_elems[index0].Key {
+			if t.cmp.Compare(old_file_elems[index1].Key, sorted_files0_elems[index0].Key) < 0 {
 				new_file_elems = append(new_file_elems, old_file_elems[index1])
+				new_file_bytes += old_file_elems[index1].ApproximateSize()
 				index1 += 1
 			} else {
-				key := sorted_files0_elems[index0].Key
-				new_file_elems = append(new_file_elems, sorted_files0_elems[index0])
+				elem := sorted_files0_elems[index0]
 				index0 += 1
-				// 若level1文件有相同key，要丢弃该key对应的较旧的记录
-				if old_file_elems[index1].Key == key {
+				// 若level1文件有相同key，要丢弃该key对应的较旧的记录，merge操作数则与较旧的记录合并
+				if t.cmp.Compare(old_file_elems[index1].Key, elem.Key) == 0 {
+					if elem, err = t.combine(elem, old_file_elems[index1], now); err != nil {
+						return new_files1, err
+					}
 					index1 += 1
 				}
+				// 过期的键值对不写入新文件，但仍需覆盖level1中该key的较旧记录
+				if !elem.IsExpired(now) {
+					new_file_elems = append(new_file_elems, elem)
+					new_file_bytes += elem.ApproximateSize()
+				}
 			}
 			// 文件满，写下一个新文件
-			if len(new_file_elems) >= t.config.LevelLFileSize {
-				new_disk_file := NewDiskFile(new_file_elems, 1)
+			if new_file_bytes >= t.config.LevelLFileSize {
+				new_disk_file, err := t.newDiskFile(new_file_elems, 1)
+				if err != nil {
+					return new_files1, err
+				}
 				new_files1 = append(new_files1, new_disk_file)
-				log.Trace(fmt.Sprintf("new file1 size : %d, key range[%v,%v]", len(new_file_elems), new_disk_file.start_key, new_disk_file.end_key))
-				// log.Logger.Debug(fmt.Sprintf("compact_0. write new file, new filw size: %d", len(new_file_elems)))
+				t.logger.Debug(fmt.Sprintf("new file1 size : %d, key range[%s,%s]", len(new_file_elems), new_disk_file.start_key, new_disk_file.end_key))
+				// t.logger.Debug(fmt.Sprintf("compact_0. write new file, new filw size: %d", len(new_file_elems)))
+				merge_elem_cnt += len(new_file_elems)
 				new_file_elems = make([]*core.Element, 0)
-				merge_elem_cnt += t.config.LevelLFileSize
+				new_file_bytes = 0
 
 			}
 		}
@@ -354,25 +845,99 @@ func (t *LSMTree) compact_0(files_0 []*DiskFile, files_1 []*DiskFile) []*DiskFil
 
 	// files_1 的最后一个文件可能有key大于maxkey的元素，需将这部分也写入文件
 	// new_file_elems = append(new_file_elems, old_file_elems[index1:]...)
-	// log.Logger.Debug(fmt.Sprintf("compact_0. new_files_elems: %d", len(new_file_elems)))
+	// t.logger.Debug(fmt.Sprintf("compact_0. new_files_elems: %d", len(new_file_elems)))
 
 	// sorted_files0_elems 也可能有剩余，这种情况发生在files0中出现比所有file1的key都大的key的情况下
-	new_file_elems = append(new_file_elems, sorted_files0_elems[index0:]...)
-	// log.Logger.Debug(fmt.Sprintf("compact_0. new_files_elems: %d", len(new_file_elems)))
+	new_file_elems = append(new_file_elems, DropExpired(sorted_files0_elems[index0:], now)...)
+	// t.logger.Debug(fmt.Sprintf("compact_0. new_files_elems: %d", len(new_file_elems)))
 
 	// new_file_elems 可能还有元素，写入到新文件中
-	for len(new_file_elems) > 0 {
-		upperbound := Min(t.config.LevelLFileSize, len(new_file_elems))
-		new_disk_file := NewDiskFile(new_file_elems[:upperbound], 1)
-		log.Trace(fmt.Sprintf("new file1 size : %d, key range[%v,%v]", upperbound, new_disk_file.start_key, new_disk_file.end_key))
-		new_files1 = append(new_files1, new_disk_file)
-		new_file_elems = new_file_elems[upperbound:]
-		merge_elem_cnt += upperbound
+	merge_elem_cnt += len(new_file_elems)
+	files, err := t.newLevel1Files(new_file_elems)
+	new_files1 = append(new_files1, files...)
+	if err != nil {
+		return new_files1, err
 	}
-	// log.Logger.Debug(fmt.Sprintf("compact_0. files0 elems cnt: %d, sorted_files0_elems cnt: %d", file0_elem_cnt, len(sorted_files0_elems)))
-	// log.Logger.Debug(fmt.Sprintf("compact_0. files1 elems cnt: %d, merge_elems cnt: %d", file1_elem_cnt_truly, merge_elem_cnt))
+	// t.logger.Debug(fmt.Sprintf("compact_0. files0 elems cnt: %d, sorted_files0_elems cnt: %d", file0_elem_cnt, len(sorted_files0_elems)))
+	// t.logger.Debug(fmt.Sprintf("compact_0. files1 elems cnt: %d, merge_elems cnt: %d", file1_elem_cnt_truly, merge_elem_cnt))
+
+	return new_files1, nil
+}
+
+/* 创建一个使用本树的配置和日志的磁盘文件，只在flush和compact中调用 */
+func (t *LSMTree) newDiskFile(elems []*core.Element, level int) (*DiskFile, error) {
+	return newDiskFile(elems, level, t.config, t.cmp, t.logger, t.tracer)
+}
 
-	return new_files1
+/* 在后台线程中执行f，Close时等待其结束 */
+func (t *LSMTree) goBackground(f func()) {
+	t.bg.Add(1)
+	go func() {
+		defer t.bg.Done()
+		f()
+	}()
+}
+
+/** 关闭LSMTree，等待正在进行的flush和compact结束，失败后等待重试的flush不再重试，然后释放所有磁盘文件
+ * 仍被读者持有的Version中的文件在该Version释放后才会释放，写了清单时文件只从内存中释放，仍保留在目录中
+ * 内存中的树里尚未flush的数据不会写入磁盘文件，写入了日志的部分在下次Open时重放，关闭后不能再读写
+ */
+func (t *LSMTree) Close() error {
+	if t.syncerStop != nil {
+		close(t.syncerStop)
+		t.syncerStop = nil
+	}
+	if !t.isClosing() {
+		close(t.closing)
+	}
+	// 唤醒等待更早的树的flush
+	t.rwm.Lock()
+	t.flushDone.Broadcast()
+	t.rwm.Unlock()
+	t.bg.Wait()
+	if t.wbm != nil {
+		t.wbm.unregister(t)
+	}
+	t.drwm.Lock()
+	if t.manifestDir != "" {
+		// 清单中的文件在下次打开时重新加载
+		v := t.CurrentVersion()
+		for _, files := range v.levels {
+			for _, d := range files {
+				atomic.StoreInt32(&d.keep, 1)
+			}
+		}
+		v.Release()
+	}
+	for i := 0; i < t.config.FileLevelCnt; i++ {
+		t.diskFiles[i].Init()
+	}
+	t.installVersion()
+	t.drwm.Unlock()
+	if t.wal != nil {
+		return t.wal.close()
+	}
+	return nil
+}
+
+/* 将有序的elems按LevelLFileSize切分，写入若干个新的level1文件，失败时返回已写入的文件和错误 */
+func (t *LSMTree) newLevel1Files(elems []*core.Element) ([]*DiskFile, error) {
+	files := make([]*DiskFile, 0)
+	for start := 0; start < len(elems); {
+		end, size := start, 0
+		for end < len(elems) && (end == start || size < t.config.LevelLFileSize) {
+			size += elems[end].ApproximateSize()
+			end++
+		}
+		d, err := t.newDiskFile(elems[start:end], 1)
+		if err != nil {
+			return files, err
+		}
+		t.logger.Debug(fmt.Sprintf("new file1 size : %d, key range[%s,%s]", end-start, d.start_key, d.end_key))
+		files = append(files, d)
+		start = end
+	}
+	return files, nil
 }
 
 /** 接收level0的所有文件，以及level1的所有key与level0有重叠的文件，合并成新的level1文件并返回
@@ -388,12 +953,12 @@ func (t *LSMTree) compact_0(files_0 []*DiskFile, files_1 []*DiskFile) []*DiskFil
 // 		elems_1[i] = files_1[i].AllElements()
 // 	}
 // 	sorted_files0_elems := MergeUpdate(elems_0)
-// 	log.Logger.Debug(fmt.Sprintf("sorted_files0_elems size : %d, key range[%v,%v]", len(sorted_files0_elems),
+// 	t.logger.Debug(fmt.Sprintf("sorted_files0_elems size : %d, key range[%v,%v]", len(sorted_files0_elems),
 // 		sorted_files0_elems[0].Key, sorted_files0_elems[len(sorted_files0_elems)-1].Key))
 
 // 	sorted_files1_elems := MergeUpdate(elems_1)
 // 	if len(sorted_files1_elems) > 0 {
-// 		log.Logger.Debug(fmt.Sprintf("sorted_files1_elems size : %d, key range[%v,%v]", len(sorted_files1_elems),
+// 		t.logger.Debug(fmt.Sprintf("sorted_files1_elems size : %d, key range[%v,%v]", len(sorted_files1_elems),
 // 			sorted_files1_elems[0].Key, sorted_files1_elems[len(sorted_files1_elems)-1].Key))
 // 	}
 
@@ -411,14 +976,14 @@ func (t *LSMTree) compact_0(files_0 []*DiskFile, files_1 []*DiskFile) []*DiskFil
 // 	}
 // 	merge_elems = append(merge_elems, sorted_files0_elems[index0:]...)
 // 	merge_elems = append(merge_elems, sorted_files1_elems[index1:]...)
-// 	log.Logger.Debug(fmt.Sprintf("merged_files1_elems size : %d, key range[%v,%v]", len(merge_elems),
+// 	t.logger.Debug(fmt.Sprintf("merged_files1_elems size : %d, key range[%v,%v]", len(merge_elems),
 // 		merge_elems[0].Key, merge_elems[len(merge_elems)-1].Key))
 // 	i := 0
 // 	new_files1 := make([]*DiskFile, 0)
 // 	for i < len(merge_elems) {
 // 		upperbound := Min(i+t.config.LevelLFileSize, len(merge_elems))
 // 		new_disk_file := NewDiskFile(merge_elems[i:upperbound], 1)
-// 		log.Logger.Debug(fmt.Sprintf("new file1 size : %d, key range[%v,%v]", upperbound-i, new_disk_file.start_key, new_disk_file.end_key))
+// 		t.logger.Debug(fmt.Sprintf("new file1 size : %d, key range[%s,%s]", upperbound-i, new_disk_file.start_key, new_disk_file.end_key))
 // 		new_files1 = append(new_files1, new_disk_file)
 // 		i = upperbound
 // 	}
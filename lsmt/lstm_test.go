@@ -3,7 +3,7 @@ package lsmt
 import (
 	"LSM-Tree/config"
 	"LSM-Tree/core"
-	log "LSM-Tree/log"
+	"bytes"
 	"fmt"
 	"math/rand"
 	"reflect"
@@ -14,6 +14,25 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+/* 返回默认配置的副本，tweak不为nil时用它修改配置，测试之间不共享配置 */
+func testConfig(tweak func(c *config.Config)) *config.Config {
+	conf := *config.DefaultConfig()
+	if tweak != nil {
+		tweak(&conf)
+	}
+	return &conf
+}
+
+/** 返回当前Version中第level层的文件，测试结束时释放该Version
+ * 后台flush和归并会修改diskFiles，测试通过Version读取文件，不直接访问diskFiles
+ */
+func levelFiles(t *testing.T, tree *LSMTree, level int) []*DiskFile {
+	t.Helper()
+	v := tree.CurrentVersion()
+	t.Cleanup(v.Release)
+	return v.levels[level]
+}
+
 ////////////////////////////////////////////////////
 //// logic test ////
 ///////////////////////////////////////////////////
@@ -25,7 +44,7 @@ func TestInMemoryOnly(t *testing.T) {
 	total := 10
 	tree := NewLSMTree(total + 1)
 	for i := 0; i < total; i++ {
-		e := &core.Element{Key: fmt.Sprintf("%d", i), Value: fmt.Sprintf("%d", i)}
+		e := &core.Element{Key: []byte(fmt.Sprintf("%d", i)), Value: []byte(fmt.Sprintf("%d", i))}
 		expected = append(expected, e)
 		wg.Add(1)
 		// 测试多线程写
@@ -43,11 +62,11 @@ func TestInMemoryOnly(t *testing.T) {
 		e := fmt.Sprintf("%d", i)
 		// 测试多线程读
 		go func() {
-			v, err := tree.Get(e)
+			v, err := tree.Get([]byte(e))
 			if err != nil {
 				t.Errorf("key %s not found", e)
 			}
-			if v != e {
+			if string(v) != e {
 				t.Errorf("got %s for key %s; want %s", v, e, e)
 			}
 			wg.Done()
@@ -64,49 +83,49 @@ func TestInMemoryOnly(t *testing.T) {
 func TestFlushedToDisk(t *testing.T) {
 	t.Parallel()
 	tree := NewLSMTree(2)
-	tree.Put("1", "One")
-	tree.Put("2", "Two")
+	tree.Put([]byte("1"), []byte("One"))
+	tree.Put([]byte("2"), []byte("Two"))
 	// 等待写入到磁盘
 	time.Sleep(1 * time.Second)
 	if tree.tree.Size() != 0 {
 		t.Errorf("got tree size %d; want 0", tree.tree.Size())
 	}
-	if tree.diskFiles[0].Len() != 1 {
-		t.Errorf("got disk level-0 files num %d; want 1", tree.diskFiles[0].Len())
+	if len(tree.LevelSummary()[0].Files) != 1 {
+		t.Errorf("got disk level-0 files num %d; want 1", len(tree.LevelSummary()[0].Files))
 	}
-	if _, err := tree.Get("1"); err != nil {
+	if _, err := tree.Get([]byte("1")); err != nil {
 		t.Error("key 1 not found")
 	}
-	if _, err := tree.Get("2"); err != nil {
+	if _, err := tree.Get([]byte("2")); err != nil {
 		t.Error("key 2 not found")
 	}
-	tree.Put("3", "Three")
-	if _, err := tree.Get("3"); err != nil {
+	tree.Put([]byte("3"), []byte("Three"))
+	if _, err := tree.Get([]byte("3")); err != nil {
 		t.Error("key 3 not found")
 	}
-	tree.Put("4", "Four")
-	tree.Put("5", "Five")
-	tree.Put("6", "Six")
-	tree.Put("7", "Seven")
-	tree.Put("8", "Eight")
+	tree.Put([]byte("4"), []byte("Four"))
+	tree.Put([]byte("5"), []byte("Five"))
+	tree.Put([]byte("6"), []byte("Six"))
+	tree.Put([]byte("7"), []byte("Seven"))
+	tree.Put([]byte("8"), []byte("Eight"))
 
 	// go func() {
 	// 	time.Sleep(1 * time.Millisecond)
-	// 	tree.Put("9", "Nine")
-	// 	tree.Put("91", "NineOne")
+	// 	tree.Put([]byte("9"), []byte("Nine"))
+	// 	tree.Put([]byte("91"), []byte("NineOne"))
 	// }()
 	// 等待写入到磁盘和compaction
 	time.Sleep(2 * time.Second)
-	if tree.diskFiles[0].Len() != 0 {
-		t.Errorf("got disk level-0 files num %d; want 0", tree.diskFiles[0].Len())
+	if len(tree.LevelSummary()[0].Files) != 0 {
+		t.Errorf("got disk level-0 files num %d; want 0", len(tree.LevelSummary()[0].Files))
 	}
-	if tree.diskFiles[1].Len() != 1 {
-		t.Errorf("got disk level-1 files num %d; want 1", tree.diskFiles[1].Len())
+	if len(tree.LevelSummary()[1].Files) != 1 {
+		t.Errorf("got disk level-1 files num %d; want 1", len(tree.LevelSummary()[1].Files))
 	}
-	if tree.diskFiles[1].Len() == 1 {
-		got := tree.diskFiles[1].Front().Value.(*DiskFile).AllElements()
-		want := []*core.Element{{Key: "1", Value: "One"}, {Key: "2", Value: "Two"}, {Key: "3", Value: "Three"}, {Key: "4", Value: "Four"},
-			{Key: "5", Value: "Five"}, {Key: "6", Value: "Six"}, {Key: "7", Value: "Seven"}, {Key: "8", Value: "Eight"}}
+	if len(tree.LevelSummary()[1].Files) == 1 {
+		got := allElements(t, levelFiles(t, tree, 1)[0])
+		want := []*core.Element{{Key: []byte("1"), Value: []byte("One")}, {Key: []byte("2"), Value: []byte("Two")}, {Key: []byte("3"), Value: []byte("Three")}, {Key: []byte("4"), Value: []byte("Four")},
+			{Key: []byte("5"), Value: []byte("Five")}, {Key: []byte("6"), Value: []byte("Six")}, {Key: []byte("7"), Value: []byte("Seven")}, {Key: []byte("8"), Value: []byte("Eight")}}
 		if !reflect.DeepEqual(want, got) {
 			t.Errorf("got result %v; want %v", got, want)
 		}
@@ -116,37 +135,287 @@ func TestFlushedToDisk(t *testing.T) {
 /* 测试删除操作 */
 func TestDelete(t *testing.T) {
 	tree := NewLSMTree(2)
-	tree.Put("1", "One")
-	tree.Put("2", "Two")
+	tree.Put([]byte("1"), []byte("One"))
+	tree.Put([]byte("2"), []byte("Two"))
 
 	// 写入到磁盘且能正确读取
 	time.Sleep(1 * time.Second)
-	assert.Equal(t, 1, tree.diskFiles[0].Len())
-	val, err := tree.Get("1")
+	assert.Equal(t, 1, len(tree.LevelSummary()[0].Files))
+	val, err := tree.Get([]byte("1"))
 	assert.Equal(t, true, err == nil)
-	assert.Equal(t, "One", val)
+	assert.Equal(t, "One", string(val))
 
 	// 删除，未写入到磁盘，从内存中读取不到
-	tree.Delete("1")
+	tree.Delete([]byte("1"))
 	assert.Equal(t, 1, tree.tree.Size())
-	_, err = tree.Get("1")
+	_, err = tree.Get([]byte("1"))
 	assert.Equal(t, true, err != nil)
 
 	// 随便插入一个新键值对
-	tree.Put("3", "Three")
+	tree.Put([]byte("3"), []byte("Three"))
 
 	// 删除操作被写入到磁盘，且进行了compact，仍然读取不到被删除的键
 	time.Sleep(1 * time.Second)
-	_, err = tree.Get("1")
+	_, err = tree.Get([]byte("1"))
 	assert.Equal(t, true, err != nil)
 	// 但可以正常读取没被删除的键
-	val, err = tree.Get("2")
+	val, err = tree.Get([]byte("2"))
 	assert.Equal(t, true, err == nil)
-	assert.Equal(t, "Two", val)
+	assert.Equal(t, "Two", string(val))
 
 	// 尝试插入特殊删除标记值，会失败
-	tree.Put("4", config.DefaultConfig().DeleteValue) // logfile.log中会打印错误
+	err = tree.Put([]byte("4"), []byte(config.DefaultConfig().DeleteValue))
+	assert.ErrorIs(t, err, ErrReservedValue)
+
+}
+
+/* 测试带过期时间的键值对 */
+func TestPutWithTTL(t *testing.T) {
+	now := time.Now()
+	var mu sync.Mutex
+	tree := NewLSMTree(2)
+	tree.SetClock(func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	})
+	advance := func(d time.Duration) {
+		mu.Lock()
+		now = now.Add(d)
+		mu.Unlock()
+	}
+
+	tree.Put([]byte("1"), []byte("One"))
+	tree.PutWithTTL([]byte("2"), []byte("Two"), time.Minute)
+	time.Sleep(500 * time.Millisecond)
+	// 已写入磁盘，未过期时可正常读取
+	val, err := tree.Get([]byte("2"))
+	assert.Nil(t, err)
+	assert.Equal(t, "Two", string(val))
+
+	// 内存中的键值对过期
+	tree.PutWithTTL([]byte("3"), []byte("Three"), time.Minute)
+	advance(30 * time.Second)
+	tree.PutWithTTL([]byte("1"), []byte("NewOne"), time.Minute)
+	advance(40 * time.Second)
+	_, err = tree.Get([]byte("2"))
+	assert.NotNil(t, err)
+	_, err = tree.Get([]byte("3"))
+	assert.NotNil(t, err)
+	val, err = tree.Get([]byte("1"))
+	assert.Nil(t, err)
+	assert.Equal(t, "NewOne", string(val))
+
+	// 过期的新记录覆盖未过期的旧记录
+	advance(time.Minute)
+	_, err = tree.Get([]byte("1"))
+	assert.NotNil(t, err)
+
+	// 触发flush和compact后，过期的键值对被物理删除
+	tree.Put([]byte("4"), []byte("Four"))
+	tree.Put([]byte("5"), []byte("Five"))
+	tree.Put([]byte("6"), []byte("Six"))
+	tree.Put([]byte("7"), []byte("Seven"))
+	time.Sleep(2 * time.Second)
+	assert.Equal(t, 0, len(tree.LevelSummary()[0].Files))
+	if assert.Equal(t, 1, len(tree.LevelSummary()[1].Files)) {
+		got := allElements(t, levelFiles(t, tree, 1)[0])
+		want := []*core.Element{{Key: []byte("4"), Value: []byte("Four")}, {Key: []byte("5"), Value: []byte("Five")}, {Key: []byte("6"), Value: []byte("Six")}, {Key: []byte("7"), Value: []byte("Seven")}}
+		assert.Equal(t, want, got)
+	}
+}
+
+/* 测试范围删除 */
+func TestDeleteRange(t *testing.T) {
+	tree := NewLSMTree(4)
+	for i := 0; i < 8; i++ {
+		tree.Put([]byte(fmt.Sprintf("k%d", i)), []byte(fmt.Sprintf("v%d", i)))
+	}
+	time.Sleep(500 * time.Millisecond)
+	assert.Equal(t, 2, len(tree.LevelSummary()[0].Files))
+
+	// 内存中的key和磁盘中的key都被删除
+	tree.Put([]byte("k2"), []byte("v2-mem"))
+	tree.DeleteRange([]byte("k2"), []byte("k6"))
+	for i := 2; i < 6; i++ {
+		_, err := tree.Get([]byte(fmt.Sprintf("k%d", i)))
+		assert.NotNil(t, err)
+	}
+	for _, key := range []string{"k0", "k1", "k6", "k7"} {
+		_, err := tree.Get([]byte(key))
+		assert.Nil(t, err)
+	}
+
+	// 范围删除之后写入的key不受影响
+	tree.Put([]byte("k3"), []byte("v3-new"))
+	val, err := tree.Get([]byte("k3"))
+	assert.Nil(t, err)
+	assert.Equal(t, "v3-new", string(val))
+
+	// flush之后范围删除标记仍然生效
+	tree.Put([]byte("x0"), []byte("x"))
+	tree.Put([]byte("x1"), []byte("x"))
+	time.Sleep(500 * time.Millisecond)
+	assert.Equal(t, 3, len(tree.LevelSummary()[0].Files))
+	_, err = tree.Get([]byte("k4"))
+	assert.NotNil(t, err)
+
+	// compact之后被覆盖的key被物理删除
+	for i := 2; i < 6; i++ {
+		tree.Put([]byte(fmt.Sprintf("x%d", i)), []byte("x"))
+	}
+	time.Sleep(2 * time.Second)
+	assert.Equal(t, 0, len(tree.LevelSummary()[0].Files))
+	keys := make([]string, 0)
+	for _, d := range levelFiles(t, tree, 1) {
+		for _, elem := range allElements(t, d) {
+			keys = append(keys, string(elem.Key))
+		}
+	}
+	assert.Equal(t, []string{"k0", "k1", "k2", "k3", "k6", "k7", "x0", "x1", "x2", "x3", "x4", "x5"}, keys)
+	val, err = tree.Get([]byte("k3"))
+	assert.Nil(t, err)
+	assert.Equal(t, "v3-new", string(val))
+	_, err = tree.Get([]byte("k2"))
+	assert.NotNil(t, err)
+}
+
+/* 只有范围删除标记的内存中的树也能flush，文件的key范围取自范围删除标记 */
+func TestFlushRangeTombstoneOnly(t *testing.T) {
+	conf := testConfig(func(c *config.Config) {
+		c.WriteBufferSize = 1
+	})
+	tree := NewLSMTreeWithConfig(0, conf)
+	for _, key := range []string{"k0", "k1"} {
+		assert.Nil(t, tree.Put([]byte(key), []byte("v")))
+	}
+	assert.Nil(t, tree.DeleteRange([]byte("k0"), []byte("k2")))
+	assert.Eventually(t, func() bool {
+		return len(tree.LevelSummary()[0].Files) == 3
+	}, time.Second, 10*time.Millisecond)
+	f := tree.LevelSummary()[0].Files[0]
+	assert.Equal(t, 0, f.Size)
+	assert.Equal(t, "k0", string(f.StartKey))
+	assert.Equal(t, "k2", string(f.EndKey))
+	for _, key := range []string{"k0", "k1"} {
+		_, err := tree.Get([]byte(key))
+		assert.NotNil(t, err)
+	}
+
+	// 归并到level1后范围删除标记覆盖的key仍然不存在
+	assert.Nil(t, tree.Put([]byte("k2"), []byte("v")))
+	assert.Eventually(t, func() bool {
+		levels := tree.LevelSummary()
+		return len(levels[0].Files) == 0 && len(levels[1].Files) > 0
+	}, time.Second, 10*time.Millisecond)
+	for _, key := range []string{"k0", "k1"} {
+		_, err := tree.Get([]byte(key))
+		assert.NotNil(t, err)
+	}
+	v, err := tree.Get([]byte("k2"))
+	assert.Nil(t, err)
+	assert.Equal(t, "v", string(v))
+}
+
+/* 测试key和value的长度限制 */
+func TestKeyValueValidation(t *testing.T) {
+	conf := testConfig(func(c *config.Config) {
+		c.MaxKeySize = 4
+		c.MaxValueSize = 8
+	})
+	tree := NewLSMTreeWithConfig(10, conf)
+
+	assert.Nil(t, tree.Put([]byte("1234"), []byte("12345678")))
+	assert.ErrorIs(t, tree.Put([]byte("12345"), []byte("v")), ErrInvalidKey)
+	assert.ErrorIs(t, tree.Put([]byte("k"), []byte("123456789")), ErrValueTooLarge)
+	assert.ErrorIs(t, tree.Delete([]byte("12345")), ErrInvalidKey)
+	assert.ErrorIs(t, tree.DeleteRange([]byte("a"), []byte("12345")), ErrInvalidKey)
+	assert.ErrorIs(t, tree.DeleteRange([]byte("b"), []byte("a")), ErrInvalidArgument)
+	assert.ErrorIs(t, tree.PutWithTTL([]byte("k"), []byte("v"), 0), ErrInvalidArgument)
+	// 失败的写入不影响树的大小
+	assert.Equal(t, 1, tree.TotalSize)
+
+	// 写入之后修改调用者的切片不影响已写入的数据
+	key, val := []byte("k"), []byte("v")
+	assert.Nil(t, tree.Put(key, val))
+	val[0] = 'x'
+	got, err := tree.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, "v", string(got))
+}
+
+/* 测试空key在内存、磁盘文件和compact之后都能正常读写 */
+func TestEmptyKey(t *testing.T) {
+	tree := NewLSMTree(2)
+	assert.Nil(t, tree.Put([]byte{}, []byte("empty")))
+	val, err := tree.Get(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "empty", string(val))
+	assert.Equal(t, 1, tree.TotalSize)
+
+	for i := 0; i < 7; i++ {
+		assert.Nil(t, tree.Put([]byte(fmt.Sprintf("%d", i)), []byte("v")))
+	}
+	time.Sleep(2 * time.Second)
+	assert.Equal(t, 0, len(tree.LevelSummary()[0].Files))
+	val, err = tree.Get([]byte{})
+	assert.Nil(t, err)
+	assert.Equal(t, "empty", string(val))
+	if assert.Equal(t, 1, len(tree.LevelSummary()[1].Files)) {
+		assert.Equal(t, 0, len(levelFiles(t, tree, 1)[0].start_key))
+	}
+
+	// 空key可以作为范围删除的起点
+	assert.Nil(t, tree.DeleteRange(nil, []byte("1")))
+	_, err = tree.Get([]byte{})
+	assert.NotNil(t, err)
+	_, err = tree.Get([]byte("0"))
+	assert.NotNil(t, err)
+	_, err = tree.Get([]byte("1"))
+	assert.Nil(t, err)
+}
+
+/* 按字节序逆序排列 */
+type reverseComparator struct{}
 
+func (reverseComparator) Compare(a, b []byte) int { return bytes.Compare(b, a) }
+func (reverseComparator) Name() string            { return "test.ReverseComparator" }
+func (reverseComparator) FindShortestSeparator(start, limit []byte) []byte {
+	return append([]byte{}, start...)
+}
+func (reverseComparator) FindShortSuccessor(key []byte) []byte { return append([]byte{}, key...) }
+
+/* 测试自定义排序方式在内存、磁盘文件和compact中都生效 */
+func TestCustomComparator(t *testing.T) {
+	conf := testConfig(func(c *config.Config) {
+		c.Comparator = reverseComparator{}
+	})
+	tree := NewLSMTreeWithConfig(2, conf)
+	for i := 0; i < 8; i++ {
+		tree.Put([]byte{byte(i)}, []byte(fmt.Sprintf("%d", i)))
+	}
+	time.Sleep(2 * time.Second)
+	assert.Equal(t, 0, len(tree.LevelSummary()[0].Files))
+	if assert.Equal(t, 1, len(tree.LevelSummary()[1].Files)) {
+		d := levelFiles(t, tree, 1)[0]
+		assert.Equal(t, "test.ReverseComparator", d.GetComparatorName())
+		keys := make([]byte, 0)
+		for _, e := range allElements(t, d) {
+			keys = append(keys, e.Key...)
+		}
+		assert.Equal(t, []byte{7, 6, 5, 4, 3, 2, 1, 0}, keys)
+	}
+	// 逆序下[5, 2)包含5、4、3
+	tree.DeleteRange([]byte{5}, []byte{2})
+	for i := 0; i < 8; i++ {
+		val, err := tree.Get([]byte{byte(i)})
+		if i > 2 && i <= 5 {
+			assert.NotNil(t, err)
+		} else {
+			assert.Nil(t, err)
+			assert.Equal(t, fmt.Sprintf("%d", i), string(val))
+		}
+	}
 }
 
 /** 测试100w个key-value规模下，put、update、get、delete等操作的正确性 */
@@ -157,7 +426,7 @@ func TestLargeScaleLogic(t *testing.T) {
 
 	block_size := 10000
 	index := 0
-	fmt.Printf("Adding %d key-value pairs...\n", len(elems))
+	t.Logf("Adding %d key-value pairs...", len(elems))
 	for {
 		var j int
 		for j = index; j < Min(index+block_size, len(elems)); j++ {
@@ -169,103 +438,100 @@ func TestLargeScaleLogic(t *testing.T) {
 		}
 		time.Sleep(20 * time.Millisecond)
 	}
-	fmt.Printf("The lsmTree now has %d nodes in total\n", lsmTree.TotalSize)
+	t.Logf("The lsmTree now has %d nodes in total", lsmTree.TotalSize)
 
 	time.Sleep(5 * time.Second)
 	lsmTree.Log_file_info()
 
-	fmt.Printf("Get==1\n")
-	log.Logger.Debug("Get==1")
+	t.Log("Get==1")
+	lsmTree.logger.Debug("Get==1")
 	keys := make([]string, 0)
 	for i := 0; i < 10; i++ {
 		key := fmt.Sprintf("key%d", rand.Intn(1000))
 		keys = append(keys, key)
-		val, err := lsmTree.Get(key)
-		if err != nil {
-			panic(err)
-		} else {
-			fmt.Printf("search key %v, got value %v\n", key, val)
-		}
+		val, err := lsmTree.Get([]byte(key))
+		assert.Nil(t, err)
+		t.Logf("search key %v, got value %s", key, val)
 		time.Sleep(500 * time.Millisecond)
 	}
 
-	fmt.Printf("delete all keys with postfix '0'\n")
+	t.Log("delete all keys with postfix '0'")
 
 	for i := 0; i < 100000; i++ {
 		key := fmt.Sprintf("key%d", i*10)
-		lsmTree.Delete(key)
+		lsmTree.Delete([]byte(key))
 	}
 	lsmTree.Log_file_info()
 
-	fmt.Printf("Get==2\n")
-	log.Logger.Debug("Get==2")
+	t.Log("Get==2")
+	lsmTree.logger.Debug("Get==2")
 	for i := 0; i < 10; i++ {
 		key := keys[i]
-		val, err := lsmTree.Get(key)
+		val, err := lsmTree.Get([]byte(key))
 		if err != nil {
-			fmt.Printf("%v\n", err)
+			t.Log(err)
 		} else {
-			fmt.Printf("search key %v, got value %v\n", key, val)
+			t.Logf("search key %v, got value %s", key, val)
 		}
 		// time.Sleep(500 * time.Millisecond)
 	}
 
 	time.Sleep(7 * time.Second)
 	lsmTree.Log_file_info()
-	fmt.Printf("Get==3\n")
-	log.Logger.Debug("Get==3")
+	t.Log("Get==3")
+	lsmTree.logger.Debug("Get==3")
 	for i := 0; i < 10; i++ {
 		key := keys[i]
-		val, err := lsmTree.Get(key)
+		val, err := lsmTree.Get([]byte(key))
 		if err != nil {
-			fmt.Printf("%v\n", err)
+			t.Log(err)
 		} else {
-			fmt.Printf("search key %v, got value %v\n", key, val)
+			t.Logf("search key %v, got value %s", key, val)
 		}
 		time.Sleep(500 * time.Millisecond)
 	}
 
-	fmt.Printf("updates all keys with postfix '7'\n")
+	t.Log("updates all keys with postfix '7'")
 
 	for i := 0; i < 100000; i++ {
 		key := fmt.Sprintf("key%d", i*10+7)
-		lsmTree.Put(key, "updated-"+fmt.Sprintf("value%d", i*10+7))
+		lsmTree.Put([]byte(key), []byte("updated-"+fmt.Sprintf("value%d", i*10+7)))
 	}
 	lsmTree.Log_file_info()
 
-	fmt.Printf("Get==4\n")
-	log.Logger.Debug("Get==4")
+	t.Log("Get==4")
+	lsmTree.logger.Debug("Get==4")
 	for i := 0; i < 10; i++ {
 		key := keys[i]
-		val, err := lsmTree.Get(key)
+		val, err := lsmTree.Get([]byte(key))
 		if err != nil {
-			fmt.Printf("%v\n", err)
+			t.Log(err)
 		} else {
-			fmt.Printf("search key %v, got value %v\n", key, val)
+			t.Logf("search key %v, got value %s", key, val)
 		}
 		// time.Sleep(500 * time.Millisecond)
 	}
 
 	time.Sleep(7 * time.Second)
 	lsmTree.Log_file_info()
-	fmt.Printf("Get==5\n")
-	log.Logger.Debug("Get==5")
+	t.Log("Get==5")
+	lsmTree.logger.Debug("Get==5")
 	for i := 0; i < 10; i++ {
 		key := keys[i]
-		val, err := lsmTree.Get(key)
+		val, err := lsmTree.Get([]byte(key))
 		if err != nil {
-			fmt.Printf("%v\n", err)
+			t.Log(err)
 		} else {
-			fmt.Printf("search key %v, got value %v\n", key, val)
+			t.Logf("search key %v, got value %s", key, val)
 		}
 		time.Sleep(500 * time.Millisecond)
 	}
 
-	val, err := lsmTree.Get("key1000001")
+	val, err := lsmTree.Get([]byte("key1000001"))
 	if err != nil {
-		fmt.Printf("%v\n", err)
+		t.Log(err)
 	} else {
-		fmt.Printf("search key %v, got value %v\n", "key1000001", val)
+		t.Logf("search key %v, got value %s", "key1000001", val)
 	}
 
 }
@@ -298,8 +564,7 @@ func BenchmarkGetData(b *testing.B) {
 			r := rand.Intn(1000000)
 			_, err := lsmTree.Get(elems[r].Key)
 			if err != nil {
-				fmt.Printf("getData wrong! %v\n", err)
-				panic(err)
+				b.Fatalf("getData wrong! %v", err)
 			}
 		}
 
@@ -0,0 +1,297 @@
+package lsmt
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"LSM-Tree/core"
+	"LSM-Tree/vfs"
+)
+
+const manifestName = "MANIFEST"
+
+/** 清单，记录某一时刻各层的磁盘文件以及重放日志的起点，打开时由它重新加载磁盘文件
+ * 同时设置了config.WALDir和磁盘文件的目录时，每次flush或compact发布新的Version后在WALDir中整体重写，先写入临时文件再改名替换，因此磁盘上总是一份完整的清单
+ * 起止key、键值对个数和范围删除标记等不在磁盘文件内容中的信息也记录在清单中，整个清单以gob编码
+ */
+type manifest struct {
+	Comparator string
+	// 编号小于LogNum的日志中的数据都已写入磁盘文件，打开时从该编号开始重放
+	LogNum int
+	// 下标即层级，每层文件的顺序与Version相同
+	Levels [][]manifestFile
+}
+
+/* 清单中的一个磁盘文件 */
+type manifestFile struct {
+	ID           int32
+	Path         string
+	Size         int
+	FileBytes    int
+	DataBytes    int
+	RawDataBytes int
+	StartKey     []byte
+	EndKey       []byte
+	RangeDels    []core.RangeTombstone
+	CreateTime   time.Time
+}
+
+/* 读取dir中的清单，清单不存在时返回包装了fs.ErrNotExist的错误 */
+func readManifest(fs vfs.FS, dir string) (*manifest, error) {
+	f, err := fs.Open(filepath.Join(dir, manifestName))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	m := &manifest{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(m); err != nil {
+		return nil, fmt.Errorf("decode manifest: %w", err)
+	}
+	return m, nil
+}
+
+/** 由各层的文件链表重写清单，logNum非0时更新重放日志的起点
+ * 调用者需持有drwm的写锁，从而清单中的文件与logNum总是一致的；未启用清单时直接返回
+ */
+func (t *LSMTree) saveManifest(logNum int) error {
+	if t.manifestDir == "" {
+		return nil
+	}
+	t.logNum = max(t.logNum, logNum)
+	m := manifest{Comparator: t.cmp.Name(), LogNum: t.logNum}
+	for i := 0; i < t.config.FileLevelCnt; i++ {
+		files := DiskList2Slice(t.diskFiles[i])
+		level := make([]manifestFile, 0, len(files))
+		for _, d := range files {
+			level = append(level, newManifestFile(d, d.path))
+		}
+		m.Levels = append(m.Levels, level)
+	}
+	return writeManifest(t.config.FS, t.manifestDir, &m)
+}
+
+/* 清单中记录的d的信息，path为d所在的路径 */
+func newManifestFile(d *DiskFile, path string) manifestFile {
+	return manifestFile{
+		ID:           d.id,
+		Path:         path,
+		Size:         d.size,
+		FileBytes:    d.file_size,
+		DataBytes:    d.data_size,
+		RawDataBytes: d.raw_size,
+		StartKey:     d.start_key,
+		EndKey:       d.end_key,
+		RangeDels:    d.range_dels,
+		CreateTime:   d.create_time,
+	}
+}
+
+/* 将m写入dir中的临时文件，Sync后改名替换原有的清单 */
+func writeManifest(fs vfs.FS, dir string, m *manifest) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(m); err != nil {
+		return fmt.Errorf("encode manifest: %w", err)
+	}
+	name := filepath.Join(dir, manifestName)
+	f, err := fs.Create(name + ".tmp")
+	if err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	_, err = f.Write(buf.Bytes())
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = fs.Rename(name+".tmp", name)
+	}
+	if err == nil {
+		err = fs.SyncDir(dir)
+	}
+	if err != nil {
+		fs.Remove(name + ".tmp")
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	return nil
+}
+
+/** 读取清单并打开其中的磁盘文件，返回各层的文件和清单中重放日志的起点，返回的每个文件都持有一个引用
+ * 清单不存在时视为没有磁盘文件；loaded中与清单路径和ID相同的文件直接复用，不再重新读取
+ */
+func (t *LSMTree) openManifest(loaded map[string]*DiskFile) ([][]*DiskFile, int, error) {
+	m, err := readManifest(t.config.FS, t.manifestDir)
+	if errors.Is(err, iofs.ErrNotExist) {
+		m = &manifest{Comparator: t.cmp.Name()}
+	} else if err != nil {
+		return nil, 0, err
+	}
+	if m.Comparator != t.cmp.Name() {
+		return nil, 0, fmt.Errorf("%w: manifest was written with comparator %q, but %q is configured", ErrInvalidArgument, m.Comparator, t.cmp.Name())
+	}
+	if len(m.Levels) > t.config.FileLevelCnt {
+		return nil, 0, fmt.Errorf("%w: manifest has %d levels, but FileLevelCnt is %d", ErrInvalidArgument, len(m.Levels), t.config.FileLevelCnt)
+	}
+
+	levels := make([][]*DiskFile, t.config.FileLevelCnt)
+	for level, mfiles := range m.Levels {
+		for _, mf := range mfiles {
+			d := loaded[mf.Path]
+			if d != nil && d.id == mf.ID {
+				d.ref()
+			} else if d, err = t.openDiskFile(mf, level); err != nil {
+				releaseLevels(levels)
+				return nil, 0, fmt.Errorf("load disk file %s: %w", mf.Path, err)
+			}
+			levels[level] = append(levels[level], d)
+		}
+	}
+	return levels, m.LogNum, nil
+}
+
+/* 用openManifest返回的文件替换当前的各层文件，并释放openManifest持有的引用 */
+func (t *LSMTree) installManifest(levels [][]*DiskFile, logNum int) {
+	if !t.readOnly {
+		// 主实例拥有清单中的文件，之后被归并掉的文件在释放时删除；只读实例从不删除文件
+		for _, files := range levels {
+			for _, d := range files {
+				atomic.StoreInt32(&d.keep, 0)
+			}
+		}
+	}
+	t.drwm.Lock()
+	for level, l := range t.diskFiles {
+		l.Init()
+		for _, d := range levels[level] {
+			l.PushBack(d)
+		}
+	}
+	t.stats.updateLevels(t.installVersion().LevelSummary())
+	t.logNum = logNum
+	t.drwm.Unlock()
+	releaseLevels(levels)
+}
+
+func releaseLevels(levels [][]*DiskFile) {
+	for _, files := range levels {
+		unrefFiles(files)
+	}
+}
+
+/* 按清单中记录的信息打开一个磁盘文件，返回的文件持有一个引用 */
+func (t *LSMTree) openDiskFile(mf manifestFile, level int) (*DiskFile, error) {
+	d := &DiskFile{
+		level:      level,
+		id:         mf.ID,
+		start_key:  mf.StartKey,
+		end_key:    mf.EndKey,
+		size:       mf.Size,
+		data_size:  mf.DataBytes,
+		raw_size:   mf.RawDataBytes,
+		file_size:  mf.FileBytes,
+		fs:         t.config.FS,
+		path:       mf.Path,
+		refs:       1,
+		range_dels: mf.RangeDels,
+
+		create_time:     mf.CreateTime,
+		cmp:             t.cmp,
+		comparator_name: t.cmp.Name(),
+		logger:          t.logger,
+		tracer:          t.tracer,
+		// 加载完成之前释放时不删除文件，加载失败时文件仍在清单中
+		keep: 1,
+	}
+	data, err := mmapFile(d.fs, d.path, d.file_size)
+	if errors.Is(err, errMmapUnsupported) {
+		data, err = readFile(d.fs, d.path)
+	} else if err == nil {
+		d.mmapped = true
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != d.file_size {
+		if d.mmapped {
+			munmapFile(data)
+		}
+		return nil, fmt.Errorf("file has %d bytes, manifest says %d", len(data), d.file_size)
+	}
+	d.data = data
+	if err := d.loadIndex(t.config.KeyProvider); err != nil {
+		if d.mmapped {
+			munmapFile(data)
+		}
+		return nil, err
+	}
+	// 新创建的文件的ID需大于所有已有文件，否则可能覆盖它们
+	for {
+		id := atomic.LoadInt32(&globalID)
+		if id >= d.id || atomic.CompareAndSwapInt32(&globalID, id, d.id) {
+			break
+		}
+	}
+	t.logger.Info("Load diskFile", "diskID", d.id, "level", level, "path", d.path)
+	return d, nil
+}
+
+func readFile(fs vfs.FS, path string) ([]byte, error) {
+	f, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+/** 删除各层目录中不在当前Version中的磁盘文件
+ * 写入磁盘文件后、重写清单前崩溃时会留下这样的文件，只有拥有这些目录的主实例在打开时调用
+ */
+func (t *LSMTree) removeObsoleteFiles() error {
+	live := make(map[string]bool)
+	v := t.CurrentVersion()
+	for _, files := range v.levels {
+		for _, d := range files {
+			live[d.path] = true
+		}
+	}
+	v.Release()
+	dirs := make(map[string]bool)
+	for level := 0; level < t.config.FileLevelCnt; level++ {
+		dir := t.config.DirForLevel(level)
+		if dirs[dir] {
+			continue
+		}
+		dirs[dir] = true
+		names, err := t.config.FS.List(dir)
+		if errors.Is(err, iofs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		for _, name := range names {
+			path := filepath.Join(dir, name)
+			if !strings.HasSuffix(name, ".sst") || live[path] {
+				continue
+			}
+			t.logger.Info("Remove obsolete diskFile", "path", path)
+			if err := t.config.FS.Remove(path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package lsmt
+
+import (
+	"LSM-Tree/avlTree"
+	"LSM-Tree/config"
+	"LSM-Tree/core"
+	"LSM-Tree/skiplist"
+)
+
+/** 内存中的树，写入的键值对先存放在这里，写满后flush到level-0文件
+ * avlTree.AVLTree和skiplist.SkipList都实现了该接口
+ */
+type Memtable interface {
+	/* 插入或更新一个元素，插入成功返回1，更新成功返回0 */
+	AddElement(e *core.Element) int
+	/* 查找key对应的元素，查找不到时返回nil */
+	Get(key []byte) *core.Element
+	/* 按顺序返回key在[start, end)内的所有元素 */
+	Range(start, end []byte) []*core.Element
+	/* 按顺序返回所有元素 */
+	Inorder() []*core.Element
+	/* 记录一个范围删除标记，只作用于比本树更旧的数据 */
+	AddRangeTombstone(start, end []byte)
+	RangeTombstones() []core.RangeTombstone
+	Size() int
+	/* 近似占用的字节数，包括key、value和数据结构本身的开销，用于判断是否需要flush */
+	ApproximateMemoryUsage() int
+}
+
+/** 内存中所有树的只读视图
+ * 视图只会被整体替换，不会被原地修改，读者取得视图后无需加锁即可遍历
+ */
+type memView struct {
+	mutable Memtable
+	// 正在flush的树，从新到旧
+	immutables []Memtable
+}
+
+/* 按配置创建一棵新的内存中的树 */
+func (t *LSMTree) newMemtable() Memtable {
+	if t.config.MemtableType == config.MemtableSkipList {
+		return skiplist.NewSkipList(t.cmp)
+	}
+	return avlTree.NewAVLTree(t.cmp)
+}
+
+/* 根据tree和treesInFlush重新生成视图，调用者需持有rwm的写锁 */
+func (t *LSMTree) publishView() {
+	v := &memView{mutable: t.tree, immutables: make([]Memtable, 0, t.treesInFlush.Len())}
+	for e := t.treesInFlush.Front(); e != nil; e = e.Next() {
+		v.immutables = append(v.immutables, e.Value.(Memtable))
+	}
+	t.view.Store(v)
+}
+
+/** 取得内存中所有树的视图
+ * 跳表允许读者与写者并发访问，直接返回视图；AVL树需要加读锁，使用完毕后需调用返回的release
+ */
+func (t *LSMTree) acquireView() (v *memView, release func()) {
+	if t.config.MemtableType == config.MemtableSkipList {
+		return t.view.Load().(*memView), func() {}
+	}
+	t.rwm.RLock()
+	return t.view.Load().(*memView), t.rwm.RUnlock
+}
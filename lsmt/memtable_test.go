@@ -0,0 +1,150 @@
+package lsmt
+
+import (
+	"LSM-Tree/config"
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/* 使用跳表作为内存中的树时，读写、flush和compaction的结果与AVL树一致 */
+func TestSkipListMemtable(t *testing.T) {
+	conf := testConfig(func(c *config.Config) {
+		c.MemtableType = config.MemtableSkipList
+	})
+	tree := NewLSMTreeWithConfig(100, conf)
+	total := 1000
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		// 读者与写者并发访问
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				tree.Get([]byte(fmt.Sprintf("%d", rand.Intn(total))))
+			}
+		}()
+	}
+	for i := 0; i < total; i++ {
+		assert.Nil(t, tree.Put([]byte(fmt.Sprintf("%d", i)), []byte(fmt.Sprintf("v%d", i))))
+	}
+	wg.Wait()
+	assert.Nil(t, tree.Delete([]byte("7")))
+	assert.Nil(t, tree.DeleteRange([]byte("8"), []byte("9")))
+	// 等待写入到磁盘和compaction
+	time.Sleep(1 * time.Second)
+	assert.Less(t, 0, len(tree.LevelSummary()[1].Files))
+
+	for i := 0; i < total; i++ {
+		k := fmt.Sprintf("%d", i)
+		v, err := tree.Get([]byte(k))
+		if k == "7" || (k >= "8" && k < "9") {
+			assert.Error(t, err, k)
+			continue
+		}
+		if assert.Nil(t, err, k) {
+			assert.Equal(t, "v"+k, string(v))
+		}
+	}
+}
+
+/* 一个写者与多个读者并发访问时，比较AVL树与跳表的性能 */
+func benchmarkMemtableMixed(b *testing.B, typ config.MemtableType) {
+	conf := testConfig(func(c *config.Config) {
+		c.MemtableType = typ
+	})
+	elems := GenerateData(100000)
+	tree := NewLSMTreeWithConfig(0, conf)
+	for _, e := range elems {
+		tree.Put(e.Key, e.Value)
+	}
+	stop := make(chan struct{})
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			e := elems[i%len(elems)]
+			tree.Put(e.Key, e.Value)
+		}
+	}()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			tree.Get(elems[rand.Intn(len(elems))].Key)
+		}
+	})
+	b.StopTimer()
+	close(stop)
+}
+
+func BenchmarkMemtableMixedAVLTree(b *testing.B) {
+	benchmarkMemtableMixed(b, config.MemtableAVLTree)
+}
+
+func BenchmarkMemtableMixedSkipList(b *testing.B) {
+	benchmarkMemtableMixed(b, config.MemtableSkipList)
+}
+
+/* 内存中的树按字节数flush，value越大flush越频繁 */
+func TestFlushByWriteBufferSize(t *testing.T) {
+	for _, typ := range []config.MemtableType{config.MemtableAVLTree, config.MemtableSkipList} {
+		conf := testConfig(func(c *config.Config) {
+			c.MemtableType = typ
+			c.WriteBufferSize = 64 << 10
+		})
+		tree := NewLSMTreeWithConfig(0, conf)
+		big := make([]byte, 16<<10)
+		for i := 0; i < 3; i++ {
+			assert.Nil(t, tree.Put([]byte(fmt.Sprintf("big%d", i)), big))
+		}
+		// 3个16KB的value未达到上限
+		assert.Equal(t, 3, tree.tree.Size())
+		assert.Less(t, 3*len(big), tree.tree.ApproximateMemoryUsage())
+		assert.Nil(t, tree.Put([]byte("big3"), big))
+		assert.Equal(t, 0, tree.tree.Size())
+
+		// 小value需要写入更多的键值对才会flush
+		for i := 0; i < 100; i++ {
+			assert.Nil(t, tree.Put([]byte(fmt.Sprintf("small%d", i)), []byte("v")))
+		}
+		assert.Equal(t, 100, tree.tree.Size())
+		time.Sleep(200 * time.Millisecond)
+		assert.Equal(t, 1, len(tree.LevelSummary()[0].Files))
+	}
+}
+
+/* 归并产生的level1文件按LevelLFileSize切分 */
+func TestLevel1FileSize(t *testing.T) {
+	conf := testConfig(func(c *config.Config) {
+		c.LevelLFileSize = 1 << 10
+	})
+	tree := NewLSMTreeWithConfig(2, conf)
+	elems := GenerateData(1000)
+	sort.Slice(elems, func(i, j int) bool { return bytes.Compare(elems[i].Key, elems[j].Key) < 0 })
+	files, err := tree.newLevel1Files(elems)
+	assert.Nil(t, err)
+	cnt := 0
+	for i, d := range files {
+		size := 0
+		for _, e := range allElements(t, d) {
+			size += e.ApproximateSize()
+		}
+		// 除最后一个文件外，每个文件都刚好写满
+		if i < len(files)-1 {
+			assert.GreaterOrEqual(t, size, conf.LevelLFileSize)
+			assert.Less(t, size-allElements(t, d)[d.GetSize()-1].ApproximateSize(), conf.LevelLFileSize)
+		}
+		cnt += d.GetSize()
+	}
+	assert.Less(t, 1, len(files))
+	assert.Equal(t, len(elems), cnt)
+}
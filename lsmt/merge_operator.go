@@ -0,0 +1,136 @@
+package lsmt
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"LSM-Tree/core"
+)
+
+/* 用户自定义的合并操作，定义见core.MergeOperator */
+type MergeOperator = core.MergeOperator
+
+/** 设置合并操作，需在调用Merge之前设置，且之后不能更换
+ * 日志中有merge操作数时需在打开前通过config.MergeOperator设置，否则无法重放
+ */
+func (t *LSMTree) SetMergeOperator(op MergeOperator) {
+	t.mergeOperator = op
+}
+
+/** 写入一个merge操作数，该操作数会与key已有的value合并
+ * 操作数与内存中的树里已有的value合并失败时返回该错误，不写入操作数
+ */
+func (t *LSMTree) Merge(key, operand []byte) error {
+	b := &WriteBatch{}
+	b.Merge(key, operand)
+	return t.Write(b, WriteOptions{})
+}
+
+/** 将同一个key的较新记录newer与较旧记录older合并成一条记录
+ * newer不是merge操作数时直接返回newer；older是操作数时部分合并，结果仍为操作数；older是value、删除标记或已过期时完全合并，结果为value
+ * 合并操作失败时返回错误，调用者需保留两条记录，不能只保留newer
+ */
+func (t *LSMTree) combine(newer, older *core.Element, now int64) (*core.Element, error) {
+	if !newer.IsMerge || t.mergeOperator == nil {
+		return newer, nil
+	}
+	res := &core.Element{Key: newer.Key}
+	var err error
+	switch {
+	case older.IsExpired(now) || string(older.Value) == t.config.DeleteValue:
+		res.Value, err = t.mergeOperator.FullMerge(newer.Key, nil, [][]byte{newer.Value})
+	case older.IsMerge:
+		res.Value, err = t.mergeOperator.PartialMerge(newer.Key, older.Value, newer.Value)
+		res.IsMerge = true
+	default:
+		existing := older.Value
+		if existing == nil {
+			existing = []byte{}
+		}
+		res.Value, err = t.mergeOperator.FullMerge(newer.Key, existing, [][]byte{newer.Value})
+		res.ExpireAt = older.ExpireAt
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s failed to merge key %q: %w", t.mergeOperator.Name(), newer.Key, err)
+	}
+	return res, nil
+}
+
+/* 将value视为十进制int64，操作数累加到value上 */
+type Int64AddOperator struct{}
+
+func (Int64AddOperator) FullMerge(key []byte, existing []byte, operands [][]byte) ([]byte, error) {
+	var sum int64
+	if existing != nil {
+		v, err := strconv.ParseInt(string(existing), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		sum = v
+	}
+	for _, op := range operands {
+		v, err := strconv.ParseInt(string(op), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		sum += v
+	}
+	return []byte(strconv.FormatInt(sum, 10)), nil
+}
+
+func (o Int64AddOperator) PartialMerge(key []byte, left, right []byte) ([]byte, error) {
+	return o.FullMerge(key, left, [][]byte{right})
+}
+
+func (Int64AddOperator) Name() string {
+	return "Int64AddOperator"
+}
+
+/* 将操作数用Delimiter依次追加到value的末尾 */
+type StringAppendOperator struct {
+	Delimiter string
+}
+
+func (o StringAppendOperator) FullMerge(key []byte, existing []byte, operands [][]byte) ([]byte, error) {
+	res := make([]byte, 0)
+	if existing != nil {
+		res = append(res, existing...)
+	}
+	for i, op := range operands {
+		if existing != nil || i > 0 {
+			res = append(res, o.Delimiter...)
+		}
+		res = append(res, op...)
+	}
+	return res, nil
+}
+
+func (o StringAppendOperator) PartialMerge(key []byte, left, right []byte) ([]byte, error) {
+	return o.FullMerge(key, left, [][]byte{right})
+}
+
+func (StringAppendOperator) Name() string {
+	return "StringAppendOperator"
+}
+
+/* 保留value与所有操作数中按字节序最大的一个 */
+type MaxOperator struct{}
+
+func (MaxOperator) FullMerge(key []byte, existing []byte, operands [][]byte) ([]byte, error) {
+	res := existing
+	for _, op := range operands {
+		if res == nil || bytes.Compare(op, res) > 0 {
+			res = op
+		}
+	}
+	return append([]byte{}, res...), nil
+}
+
+func (o MaxOperator) PartialMerge(key []byte, left, right []byte) ([]byte, error) {
+	return o.FullMerge(key, left, [][]byte{right})
+}
+
+func (MaxOperator) Name() string {
+	return "MaxOperator"
+}
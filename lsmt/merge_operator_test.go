@@ -0,0 +1,182 @@
+package lsmt
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"LSM-Tree/core"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuiltinMergeOperators(t *testing.T) {
+	key := []byte("k")
+	ops := func(vals ...string) [][]byte {
+		res := make([][]byte, len(vals))
+		for i, v := range vals {
+			res[i] = []byte(v)
+		}
+		return res
+	}
+	add := Int64AddOperator{}
+	v, err := add.FullMerge(key, []byte("10"), ops("1", "-3"))
+	assert.Nil(t, err)
+	assert.Equal(t, "8", string(v))
+	v, err = add.FullMerge(key, nil, ops("5"))
+	assert.Nil(t, err)
+	assert.Equal(t, "5", string(v))
+	v, err = add.PartialMerge(key, []byte("2"), []byte("3"))
+	assert.Nil(t, err)
+	assert.Equal(t, "5", string(v))
+	_, err = add.FullMerge(key, nil, ops("abc"))
+	assert.NotNil(t, err)
+
+	appendOp := StringAppendOperator{Delimiter: ","}
+	v, _ = appendOp.FullMerge(key, []byte("a"), ops("b", "c"))
+	assert.Equal(t, "a,b,c", string(v))
+	v, _ = appendOp.FullMerge(key, nil, ops("b", "c"))
+	assert.Equal(t, "b,c", string(v))
+	v, _ = appendOp.FullMerge(key, []byte{}, ops("b"))
+	assert.Equal(t, ",b", string(v))
+	v, _ = appendOp.PartialMerge(key, []byte("b"), []byte("c"))
+	assert.Equal(t, "b,c", string(v))
+
+	maxOp := MaxOperator{}
+	v, _ = maxOp.FullMerge(key, []byte("m"), ops("a", "z", "b"))
+	assert.Equal(t, "z", string(v))
+	v, _ = maxOp.PartialMerge(key, []byte("b"), []byte("a"))
+	assert.Equal(t, "b", string(v))
+}
+
+/* 测试计数器在内存、磁盘以及compact之后都能得到正确的累加结果 */
+func TestMergeCounter(t *testing.T) {
+	tree := NewLSMTree(2)
+	tree.SetMergeOperator(Int64AddOperator{})
+	tree.Put([]byte("counter"), []byte("100"))
+	tree.Put([]byte("other"), []byte("x"))
+	time.Sleep(500 * time.Millisecond)
+
+	for i := 0; i < 10; i++ {
+		tree.Merge([]byte("counter"), []byte("1"))
+		tree.Merge([]byte(fmt.Sprintf("new%d", i)), []byte("1"))
+		val, err := tree.Get([]byte("counter"))
+		assert.Nil(t, err)
+		assert.Equal(t, fmt.Sprintf("%d", 101+i), string(val))
+	}
+	// 不合法的操作数被拒绝
+	assert.ErrorIs(t, tree.Merge([]byte("counter"), []byte("abc")), ErrInvalidArgument)
+	time.Sleep(2 * time.Second)
+	assert.Less(t, 0, len(tree.LevelSummary()[1].Files))
+
+	val, err := tree.Get([]byte("counter"))
+	assert.Nil(t, err)
+	assert.Equal(t, "110", string(val))
+	val, err = tree.Get([]byte("new3"))
+	assert.Nil(t, err)
+	assert.Equal(t, "1", string(val))
+
+	// 删除之后的操作数作用在空值上
+	tree.Delete([]byte("counter"))
+	tree.Merge([]byte("counter"), []byte("5"))
+	val, err = tree.Get([]byte("counter"))
+	assert.Nil(t, err)
+	assert.Equal(t, "5", string(val))
+}
+
+/* 测试操作数分布在多个磁盘文件中时，Get和compact都能按顺序合并 */
+func TestMergeAppendAcrossFiles(t *testing.T) {
+	tree := NewLSMTree(2)
+	tree.SetMergeOperator(StringAppendOperator{Delimiter: ","})
+	tree.Put([]byte("list"), []byte("a"))
+	for i, op := range []string{"b", "c", "d"} {
+		tree.Merge([]byte("list"), []byte(op))
+		tree.Put([]byte(fmt.Sprintf("filler%d", i)), []byte("x"))
+		time.Sleep(200 * time.Millisecond)
+	}
+	val, err := tree.Get([]byte("list"))
+	assert.Nil(t, err)
+	assert.Equal(t, "a,b,c,d", string(val))
+
+	// 没有设置合并操作时Merge不生效
+	other := NewLSMTree(2)
+	assert.ErrorIs(t, other.Merge([]byte("list"), []byte("a")), ErrInvalidArgument)
+	_, err = other.Get([]byte("list"))
+	assert.NotNil(t, err)
+
+	tree.Merge([]byte("list"), []byte("e"))
+	tree.Put([]byte("filler3"), []byte("x"))
+	time.Sleep(2 * time.Second)
+	assert.Equal(t, 0, len(tree.LevelSummary()[0].Files))
+	val, err = tree.Get([]byte("list"))
+	assert.Nil(t, err)
+	assert.Equal(t, "a,b,c,d,e", string(val))
+	// compact之后操作数已与value完全合并
+	for _, d := range levelFiles(t, tree, 1) {
+		if elem, err := d.Search([]byte("list")); err == nil {
+			assert.Equal(t, core.Element{Key: []byte("list"), Value: []byte("a,b,c,d,e")}, elem)
+		}
+	}
+}
+
+/* 操作数无法与已有的value合并时写入被拒绝，归并时遇到这样的记录则归并失败，较旧的value都不会被丢弃 */
+func TestMergeUnparsableBase(t *testing.T) {
+	tree := NewLSMTree(0)
+	tree.SetMergeOperator(Int64AddOperator{})
+	assert.Nil(t, tree.Put([]byte("k"), []byte("abc")))
+	assert.NotNil(t, tree.Merge([]byte("k"), []byte("1")))
+	val, err := tree.Get([]byte("k"))
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", string(val))
+
+	// 同一个WriteBatch中的其他操作也不写入，包括batch内先写入的无法合并的value
+	b := &WriteBatch{}
+	b.Put([]byte("other"), []byte("1"))
+	b.Put([]byte("k2"), []byte("x"))
+	b.Merge([]byte("k2"), []byte("1"))
+	assert.NotNil(t, tree.Write(b, WriteOptions{}))
+	_, err = tree.Get([]byte("other"))
+	assert.NotNil(t, err)
+	_, err = tree.Get([]byte("k2"))
+	assert.NotNil(t, err)
+
+	// 被范围删除的value不再参与合并
+	b = &WriteBatch{}
+	b.Put([]byte("k3"), []byte("x"))
+	b.DeleteRange([]byte("k3"), []byte("k4"))
+	b.Merge([]byte("k3"), []byte("2"))
+	assert.Nil(t, tree.Write(b, WriteOptions{}))
+	val, err = tree.Get([]byte("k3"))
+	assert.Nil(t, err)
+	assert.Equal(t, "2", string(val))
+	assert.Nil(t, tree.Close())
+
+	// value已经flush时写入操作数不检查，归并时合并失败，保留所有输入文件
+	tree = NewLSMTree(1)
+	tree.SetMergeOperator(Int64AddOperator{})
+	r := &recordingListener{}
+	tree.AddEventListener(r)
+	assert.Nil(t, tree.Put([]byte("k"), []byte("abc")))
+	r.waitFlushes(t, 1)
+	assert.Nil(t, tree.Merge([]byte("k"), []byte("1")))
+	r.waitFlushes(t, 2)
+	for i := 2; i < tree.config.MaxLevel0FileCnt; i++ {
+		assert.Nil(t, tree.Put([]byte(fmt.Sprintf("filler%d", i)), []byte("x")))
+		r.waitFlushes(t, i+1)
+	}
+	r.waitFor(t, func() bool { return len(r.compactions) == 1 })
+	r.mu.Lock()
+	assert.NotNil(t, r.compactions[0].Err)
+	assert.Equal(t, []BackgroundErrorReason{BackgroundErrorCompaction}, r.errors)
+	assert.Equal(t, 0, len(r.deleted))
+	r.mu.Unlock()
+	files := levelFiles(t, tree, 0)
+	assert.Equal(t, tree.config.MaxLevel0FileCnt, len(files))
+	assert.Equal(t, 0, len(levelFiles(t, tree, 1)))
+	elem, err := files[len(files)-1].Search([]byte("k"))
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", string(elem.Value))
+	_, err = tree.Get([]byte("k"))
+	assert.NotNil(t, err)
+	assert.Nil(t, tree.Close())
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package lsmt
+
+import (
+	"LSM-Tree/vfs"
+)
+
+func mmapFile(fs vfs.FS, path string, size int) ([]byte, error) {
+	return nil, errMmapUnsupported
+}
+
+func munmapFile(data []byte) error {
+	return nil
+}
@@ -0,0 +1,85 @@
+//go:build unix
+
+package lsmt
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"LSM-Tree/config"
+	"LSM-Tree/core"
+	log "LSM-Tree/log"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mmapConfig(t *testing.T) *config.Config {
+	return testConfig(func(c *config.Config) {
+		c.MmapDir = t.TempDir()
+	})
+}
+
+func countFiles(t *testing.T, dir string) int {
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	return len(entries)
+}
+
+/* 映射的文件在最后一个引用释放后才解除映射并删除 */
+func TestMmapDiskFileRefs(t *testing.T) {
+	conf := mmapConfig(t)
+	elems := []*core.Element{{Key: []byte("a"), Value: []byte("1")}, {Key: []byte("b"), Value: []byte("2")}}
+	d, err := newDiskFile(elems, 0, conf, core.BytewiseComparator, log.Discard, nil)
+	assert.Nil(t, err)
+	assert.True(t, d.mmapped)
+	info, err := os.Stat(d.path)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(d.GetFileSize()), info.Size())
+
+	// 模拟读者持有引用时文件被删除
+	d.ref()
+	d.unref()
+	e, err := d.Search([]byte("b"))
+	assert.Nil(t, err)
+	assert.Equal(t, "2", string(e.Value))
+	assert.Equal(t, 2, len(allElements(t, d)))
+
+	d.unref()
+	_, err = os.Stat(d.path)
+	assert.True(t, os.IsNotExist(err))
+	assert.Nil(t, d.data)
+}
+
+func TestMmapDiskFileError(t *testing.T) {
+	conf := mmapConfig(t)
+	conf.MmapDir = conf.MmapDir + "/missing"
+	_, err := newDiskFile([]*core.Element{{Key: []byte("a"), Value: []byte("1")}}, 0, conf, core.BytewiseComparator, log.Discard, nil)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+/* 归并删除的文件从目录中移除，Close释放剩余的文件 */
+func TestMmapTree(t *testing.T) {
+	conf := mmapConfig(t)
+	tree := NewLSMTreeWithConfig(100, conf)
+	for i := 0; i < 1000; i++ {
+		assert.Nil(t, tree.Put([]byte(fmt.Sprintf("key%04d", i)), []byte(fmt.Sprintf("value%d", i))))
+	}
+	time.Sleep(1 * time.Second)
+
+	files := 0
+	for _, l := range tree.LevelSummary() {
+		files += len(l.Files)
+	}
+	assert.Less(t, int64(0), tree.Statistics().Snapshot().CompactionCount)
+	assert.Equal(t, files, countFiles(t, conf.MmapDir))
+	for i := 0; i < 1000; i += 7 {
+		val, err := tree.Get([]byte(fmt.Sprintf("key%04d", i)))
+		assert.Nil(t, err)
+		assert.Equal(t, fmt.Sprintf("value%d", i), string(val))
+	}
+
+	assert.Nil(t, tree.Close())
+	assert.Equal(t, 0, countFiles(t, conf.MmapDir))
+}
@@ -0,0 +1,28 @@
+//go:build unix
+
+package lsmt
+
+import (
+	"syscall"
+
+	"LSM-Tree/vfs"
+)
+
+/* 以只读方式映射文件的前size个字节，只有操作系统的文件可以映射 */
+func mmapFile(fs vfs.FS, path string, size int) ([]byte, error) {
+	f, err := fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	// 映射建立后关闭文件不影响映射
+	defer f.Close()
+	fd, ok := f.(interface{ Fd() uintptr })
+	if !ok {
+		return nil, errMmapUnsupported
+	}
+	return syscall.Mmap(int(fd.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+func munmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
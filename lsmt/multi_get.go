@@ -0,0 +1,128 @@
+package lsmt
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"LSM-Tree/core"
+)
+
+/** 批量查找多个key，返回与keys一一对应的value和错误，每个key的结果与Get相同
+ * 返回之前不能修改keys中的切片；先将key排序，只取一次内存中的树的视图和磁盘文件的Version，每个磁盘文件只遍历一次，查找该文件key范围内所有尚未找到的key
+ */
+func (t *LSMTree) MultiGet(keys [][]byte) ([][]byte, []error) {
+	start := time.Now()
+	now := t.clock().UnixNano()
+	gs := make([]*getter, len(keys))
+	for i, key := range keys {
+		gs[i] = &getter{t: t, key: key, now: now}
+	}
+	sorted := append([]*getter{}, gs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return t.cmp.Compare(sorted[i].key, sorted[j].key) < 0
+	})
+	t.multiGet(sorted)
+	t.stats.recordMultiGet(start, gs)
+
+	vals := make([][]byte, len(gs))
+	errs := make([]error, len(gs))
+	for i, g := range gs {
+		vals[i], errs[i] = g.val, g.err
+	}
+	return vals, errs
+}
+
+/* 与get相同的查找顺序，gs需已按key排好序 */
+func (t *LSMTree) multiGet(gs []*getter) {
+	view, release := t.acquireView()
+	for _, g := range gs {
+		g.searchTree(view.mutable)
+		for i := 0; i < len(view.immutables) && !g.done; i++ {
+			g.searchTree(view.immutables[i])
+		}
+	}
+	release()
+	pending := pendingGetters(gs)
+	if len(pending) == 0 {
+		return
+	}
+	v := t.CurrentVersion()
+	defer v.Release()
+
+	// level0的文件之间key范围可能重叠，从最新的文件开始，每个文件都查找所有尚未找到的key
+	now := t.clock()
+	for _, d := range v.levels[0] {
+		if len(pending) == 0 {
+			break
+		}
+		if t.fifoExpired(d, now) {
+			continue
+		}
+		t.searchFile(d, pending)
+		for _, g := range pending {
+			if !g.done && IsCoveredByRangeTombstones(t.cmp, d.range_dels, g.key) {
+				t.tracer.Trace(g.key, "this key was deleted by range tombstone", "diskID", d.id)
+				g.covered()
+			}
+		}
+		pending = pendingGetters(pending)
+	}
+
+	// 从level1开始，每层文件都是有序的，按顺序把key分配给包含它的文件
+	for i := 1; i < len(v.levels) && len(pending) > 0; i++ {
+		j := 0
+		for _, d := range v.levels[i] {
+			if j == len(pending) {
+				break
+			}
+			for j < len(pending) && t.cmp.Compare(pending[j].key, d.start_key) < 0 {
+				j++
+			}
+			k := j
+			for k < len(pending) && t.cmp.Compare(pending[k].key, d.end_key) <= 0 {
+				k++
+			}
+			if k > j {
+				t.searchFile(d, pending[j:k])
+			}
+			j = k
+		}
+		pending = pendingGetters(pending)
+	}
+
+	for _, g := range pending {
+		g.finish(nil, fmt.Errorf("key %s not found", g.key))
+	}
+}
+
+/* 在一个磁盘文件中查找gs中的所有key，gs需已按key排好序 */
+func (t *LSMTree) searchFile(d *DiskFile, gs []*getter) {
+	keys := make([][]byte, len(gs))
+	for i, g := range gs {
+		g.filesProbed++
+		keys[i] = g.key
+	}
+	err := d.searchSorted(keys, func(i int, e *core.Element) {
+		gs[i].found(e)
+	})
+	if err != nil {
+		// 无法确定损坏的块中有哪些key，尚未结束的查找都返回该错误
+		for _, g := range gs {
+			if !g.done {
+				g.fail(err)
+			}
+		}
+	}
+}
+
+/* 返回尚未结束查找的getter，保持原有顺序 */
+func pendingGetters(gs []*getter) []*getter {
+	pending := make([]*getter, 0, len(gs))
+	for _, g := range gs {
+		if !g.done {
+			pending = append(pending, g)
+		}
+	}
+	return pending
+}
@@ -0,0 +1,70 @@
+package lsmt
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"LSM-Tree/core"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiskFileSearchSorted(t *testing.T) {
+	elems := make([]*core.Element, 100)
+	for i := range elems {
+		elems[i] = &core.Element{Key: []byte(fmt.Sprintf("%03d", i*2)), Value: []byte(fmt.Sprintf("v%d", i*2))}
+	}
+	d := newTestDiskFile(t, elems, 1)
+	keys := [][]byte{[]byte("-"), []byte("000"), []byte("001"), []byte("050"), []byte("050"), []byte("051"), []byte("100"), []byte("198"), []byte("199")}
+	found := make(map[int]string)
+	d.searchSorted(keys, func(i int, e *core.Element) {
+		assert.Equal(t, string(keys[i]), string(e.Key))
+		found[i] = string(e.Value)
+	})
+	assert.Equal(t, map[int]string{1: "v0", 3: "v50", 4: "v50", 6: "v100", 7: "v198"}, found)
+}
+
+/* MultiGet的每个结果都与Get相同 */
+func TestMultiGet(t *testing.T) {
+	tree := NewLSMTree(100)
+	tree.SetMergeOperator(Int64AddOperator{})
+	for _, i := range rand.Perm(2000) {
+		assert.Nil(t, tree.Put([]byte(fmt.Sprintf("key%04d", i)), []byte(fmt.Sprintf("value%d", i))))
+	}
+	for i := 0; i < 2000; i += 7 {
+		assert.Nil(t, tree.Delete([]byte(fmt.Sprintf("key%04d", i))))
+	}
+	assert.Nil(t, tree.DeleteRange([]byte("key0500"), []byte("key0600")))
+	for i := 0; i < 50; i++ {
+		assert.Nil(t, tree.Merge([]byte(fmt.Sprintf("counter%d", i%5)), []byte("1")))
+	}
+	time.Sleep(1 * time.Second)
+	// 部分数据仍在内存中的树里
+	for i := 0; i < 2000; i += 11 {
+		assert.Nil(t, tree.Put([]byte(fmt.Sprintf("key%04d", i)), []byte("updated")))
+	}
+
+	keys := [][]byte{[]byte("missing"), []byte("counter3"), []byte("key0000"), []byte("key0000"), []byte("key0551")}
+	for i := 0; i < 300; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("key%04d", rand.Intn(2100))))
+	}
+	vals, errs := tree.MultiGet(keys)
+	assert.Equal(t, len(keys), len(vals))
+	assert.Equal(t, len(keys), len(errs))
+	for i, key := range keys {
+		val, err := tree.Get(key)
+		assert.Equal(t, val, vals[i], string(key))
+		// 两次查找之间的归并可能消耗掉删除标记，只比较是否找到
+		assert.Equal(t, err == nil, errs[i] == nil, string(key))
+	}
+	assert.Equal(t, "10", string(vals[1]))
+	assert.Equal(t, "updated", string(vals[2]))
+	assert.NotNil(t, errs[4])
+
+	vals, errs = tree.MultiGet(nil)
+	assert.Empty(t, vals)
+	assert.Empty(t, errs)
+	assert.Equal(t, uint64(2), tree.Statistics().Snapshot().MultiGetLatency.Count)
+}
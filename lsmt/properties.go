@@ -0,0 +1,208 @@
+package lsmt
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"LSM-Tree/config"
+)
+
+/* GetProperty支持的属性名 */
+const (
+	// 后接层级，例如"lsmt.num-files-at-level0"，该层的文件个数
+	PropNumFilesAtLevelPrefix = "lsmt.num-files-at-level"
+	// 内存中的树和磁盘文件中的键值对总数，同一个key的多个版本、删除标记和merge操作数分别计数
+	PropNumEntries = "lsmt.num-entries"
+	// 有效数据的估算字节数，即最深的非空层的文件体积，所有数据最终都会归并到该层
+	PropEstimateLiveDataSize = "lsmt.estimate-live-data-size"
+	// 所有磁盘文件的字节数
+	PropTotalFileSize = "lsmt.total-file-size"
+	// 可变的内存中的树占用的字节数
+	PropCurSizeActiveMemTable = "lsmt.cur-size-active-mem-table"
+	// 所有内存中的树（包括正在flush的树）占用的字节数
+	PropCurSizeAllMemTables = "lsmt.cur-size-all-mem-tables"
+	// 可变的内存中的树中的键值对个数
+	PropNumEntriesActiveMemTable = "lsmt.num-entries-active-mem-table"
+	// 正在flush的树的个数
+	PropNumImmutableMemTable = "lsmt.num-immutable-mem-table"
+	// 下一次归并需要读取的字节数，level0文件数未达到上限时为0
+	PropEstimatePendingCompactionBytes = "lsmt.estimate-pending-compaction-bytes"
+	// 是否需要归并，即level0文件数达到上限，1表示是，0表示否
+	PropCompactionPending = "lsmt.compaction-pending"
+	// 正在进行的归并个数，最多有一个后台线程进行归并，因此只会是0或1
+	PropNumRunningCompactions = "lsmt.num-running-compactions"
+	// 各层文件个数和字节数的文本表格
+	PropLevelStats = "lsmt.levelstats"
+)
+
+/* 一个磁盘文件的信息 */
+type FileSummary struct {
+	ID int
+	// 文件中的键值对个数
+	Size int
+	// 文件占用的字节数
+	Bytes int
+	// 数据块压缩后和压缩前的字节数，不包括索引块
+	DataBytes    int
+	RawDataBytes int
+	StartKey     []byte
+	EndKey       []byte
+	// 加密文件使用的密钥ID，未加密时为空
+	KeyID string
+	// 文件在config.FS中的路径，文件只保存在内存中时为空
+	Path string
+}
+
+/* 一层磁盘文件的信息，level0的文件从新到旧排列，其他层的文件按key排列 */
+type LevelSummary struct {
+	Level int
+	Files []FileSummary
+	// 该层所有文件的键值对个数和字节数
+	Size  int
+	Bytes int
+	// 该层所有文件的数据块压缩后和压缩前的字节数
+	DataBytes    int
+	RawDataBytes int
+}
+
+/* 该层数据块的压缩比，即压缩前的字节数 / 压缩后的字节数，没有文件时为0 */
+func (l LevelSummary) CompressionRatio() float64 {
+	if l.DataBytes == 0 {
+		return 0
+	}
+	return float64(l.RawDataBytes) / float64(l.DataBytes)
+}
+
+func (d *DiskFile) summary() FileSummary {
+	return FileSummary{
+		ID:           d.GetID(),
+		Size:         d.GetSize(),
+		Bytes:        d.GetFileSize(),
+		DataBytes:    d.data_size,
+		RawDataBytes: d.raw_size,
+		StartKey:     d.start_key,
+		EndKey:       d.end_key,
+		KeyID:        d.key_id,
+		Path:         d.path,
+	}
+}
+
+/* 返回当前各层磁盘文件的信息，下标即层级 */
+func (t *LSMTree) LevelSummary() []LevelSummary {
+	v := t.CurrentVersion()
+	defer v.Release()
+	return v.LevelSummary()
+}
+
+/** 查询树的内部状态，name为上面定义的属性名
+ * 属性名不存在时返回false
+ */
+func (t *LSMTree) GetProperty(name string) (string, bool) {
+	if name == PropLevelStats {
+		var b strings.Builder
+		b.WriteString("Level Files Entries Bytes\n")
+		for _, l := range t.LevelSummary() {
+			fmt.Fprintf(&b, "%5d %5d %7d %d\n", l.Level, len(l.Files), l.Size, l.Bytes)
+		}
+		return b.String(), true
+	}
+	v, ok := t.GetIntProperty(name)
+	if !ok {
+		return "", false
+	}
+	return strconv.Itoa(v), true
+}
+
+/* 与GetProperty相同，只支持值为整数的属性 */
+func (t *LSMTree) GetIntProperty(name string) (int, bool) {
+	if strings.HasPrefix(name, PropNumFilesAtLevelPrefix) {
+		level, err := strconv.Atoi(strings.TrimPrefix(name, PropNumFilesAtLevelPrefix))
+		if err != nil || level < 0 || level >= t.config.FileLevelCnt {
+			return 0, false
+		}
+		v := t.CurrentVersion()
+		defer v.Release()
+		return len(v.levels[level]), true
+	}
+
+	switch name {
+	case PropCurSizeActiveMemTable, PropNumEntriesActiveMemTable, PropCurSizeAllMemTables, PropNumImmutableMemTable:
+		view, release := t.acquireView()
+		defer release()
+		switch name {
+		case PropCurSizeActiveMemTable:
+			return view.mutable.ApproximateMemoryUsage(), true
+		case PropNumEntriesActiveMemTable:
+			return view.mutable.Size(), true
+		case PropCurSizeAllMemTables:
+			size := view.mutable.ApproximateMemoryUsage()
+			for _, m := range view.immutables {
+				size += m.ApproximateMemoryUsage()
+			}
+			return size, true
+		default:
+			return len(view.immutables), true
+		}
+	case PropNumEntries:
+		view, release := t.acquireView()
+		cnt := view.mutable.Size()
+		for _, m := range view.immutables {
+			cnt += m.Size()
+		}
+		release()
+		for _, l := range t.LevelSummary() {
+			cnt += l.Size
+		}
+		return cnt, true
+	case PropEstimateLiveDataSize:
+		levels := t.LevelSummary()
+		for i := len(levels) - 1; i >= 0; i-- {
+			if len(levels[i].Files) > 0 {
+				return levels[i].Bytes, true
+			}
+		}
+		return 0, true
+	case PropTotalFileSize:
+		size := 0
+		for _, l := range t.LevelSummary() {
+			size += l.Bytes
+		}
+		return size, true
+	case PropEstimatePendingCompactionBytes:
+		return t.pendingCompactionBytes(), true
+	case PropCompactionPending:
+		if t.pendingCompactionBytes() > 0 {
+			return 1, true
+		}
+		return 0, true
+	case PropNumRunningCompactions:
+		t.drwm.RLock()
+		defer t.drwm.RUnlock()
+		if t.isCompacting {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+/** 估算下一次归并需要读取的字节数
+ * level0文件数达到上限时，需读取所有level0文件以及level1中与其key范围重叠的文件
+ */
+func (t *LSMTree) pendingCompactionBytes() int {
+	v := t.CurrentVersion()
+	defer v.Release()
+	files_0 := v.levels[0]
+	if t.config.CompactionStyle == config.CompactionStyleFIFO || len(files_0) < t.config.MaxLevel0FileCnt {
+		return 0
+	}
+	min_key, max_key := MinKeyOfDiskSlice(files_0), MaxKeyOfDiskSlice(files_0)
+	size := diskFilesSize(files_0)
+	for _, d := range v.levels[1] {
+		if t.cmp.Compare(d.start_key, max_key) <= 0 && t.cmp.Compare(d.end_key, min_key) >= 0 {
+			size += d.GetFileSize()
+		}
+	}
+	return size
+}
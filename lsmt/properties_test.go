@@ -0,0 +1,79 @@
+package lsmt
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetProperty(t *testing.T) {
+	tree := NewLSMTree(2)
+	for i := 0; i < 7; i++ {
+		assert.Nil(t, tree.Put([]byte(fmt.Sprintf("%d", i)), []byte("value")))
+	}
+	// 等待flush：3个level0文件，未达到归并的上限
+	time.Sleep(500 * time.Millisecond)
+
+	get := func(name string) int {
+		v, ok := tree.GetIntProperty(name)
+		assert.True(t, ok, name)
+		return v
+	}
+	assert.Equal(t, 3, get(PropNumFilesAtLevelPrefix+"0"))
+	assert.Equal(t, 0, get(PropNumFilesAtLevelPrefix+"1"))
+	assert.Equal(t, 7, get(PropNumEntries))
+	assert.Equal(t, 1, get(PropNumEntriesActiveMemTable))
+	assert.Equal(t, 0, get(PropNumImmutableMemTable))
+	assert.Less(t, 0, get(PropCurSizeActiveMemTable))
+	assert.Equal(t, get(PropCurSizeActiveMemTable), get(PropCurSizeAllMemTables))
+	assert.Equal(t, get(PropTotalFileSize), get(PropEstimateLiveDataSize))
+	assert.Equal(t, 0, get(PropEstimatePendingCompactionBytes))
+	assert.Equal(t, 0, get(PropCompactionPending))
+	assert.Equal(t, 0, get(PropNumRunningCompactions))
+
+	v, ok := tree.GetProperty(PropNumFilesAtLevelPrefix + "0")
+	assert.True(t, ok)
+	assert.Equal(t, "3", v)
+	stats, ok := tree.GetProperty(PropLevelStats)
+	assert.True(t, ok)
+	assert.Equal(t, 1+tree.config.FileLevelCnt, strings.Count(stats, "\n"))
+
+	for _, name := range []string{"lsmt.unknown", PropNumFilesAtLevelPrefix + "x", PropNumFilesAtLevelPrefix + "99"} {
+		_, ok := tree.GetProperty(name)
+		assert.False(t, ok, name)
+	}
+
+	// 归并后所有数据都在level1
+	assert.Nil(t, tree.Put([]byte("7"), []byte("value")))
+	time.Sleep(1 * time.Second)
+	assert.Equal(t, 0, get(PropNumFilesAtLevelPrefix+"0"))
+	assert.Equal(t, 1, get(PropNumFilesAtLevelPrefix+"1"))
+	assert.Equal(t, 8, get(PropNumEntries))
+	assert.Equal(t, get(PropTotalFileSize), get(PropEstimateLiveDataSize))
+}
+
+func TestLevelSummary(t *testing.T) {
+	tree := NewLSMTree(2)
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, tree.Put([]byte(fmt.Sprintf("%d", i)), []byte("value")))
+		// 保证每个文件按顺序flush
+		time.Sleep(100 * time.Millisecond)
+	}
+	time.Sleep(300 * time.Millisecond)
+
+	levels := tree.LevelSummary()
+	assert.Equal(t, tree.config.FileLevelCnt, len(levels))
+	assert.Equal(t, 2, len(levels[0].Files))
+	assert.Equal(t, 4, levels[0].Size)
+	// level0的文件从新到旧排列
+	newest := levels[0].Files[0]
+	assert.Equal(t, "2", string(newest.StartKey))
+	assert.Equal(t, "3", string(newest.EndKey))
+	assert.Equal(t, 2, newest.Size)
+	assert.Greater(t, newest.ID, levels[0].Files[1].ID)
+	assert.Equal(t, newest.Bytes+levels[0].Files[1].Bytes, levels[0].Bytes)
+	assert.Equal(t, 0, len(levels[1].Files))
+}
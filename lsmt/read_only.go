@@ -0,0 +1,96 @@
+package lsmt
+
+import (
+	"fmt"
+
+	"LSM-Tree/config"
+)
+
+/** 以只读方式打开主实例保存在config.WALDir中的树，磁盘文件的目录等配置需与主实例相同
+ * 加载清单中的磁盘文件，并将尚未flush的日志重放到内存中，之后不再读取目录中的任何变化
+ * 所有写入都返回ErrReadOnly，不会flush或归并，也不会修改或删除目录中的任何文件，可以与主实例同时打开
+ */
+func OpenReadOnly(conf *config.Config) (*LSMTree, error) {
+	return openReadOnly(conf, false)
+}
+
+/** 以secondary方式打开主实例保存在config.WALDir中的树，与OpenReadOnly相同，但之后可以定期调用TryCatchUpWithPrimary读取主实例最新的清单和日志
+ */
+func OpenAsSecondary(conf *config.Config) (*LSMTree, error) {
+	return openReadOnly(conf, true)
+}
+
+func openReadOnly(conf *config.Config, secondary bool) (*LSMTree, error) {
+	if conf.WALDir == "" || conf.DirForLevel(0) == "" {
+		return nil, fmt.Errorf("%w: read-only open needs WALDir and the directories of disk files", ErrInvalidArgument)
+	}
+	if err := checkLevelDirs(conf); err != nil {
+		return nil, err
+	}
+	t := newLSMTree(0, conf)
+	t.readOnly, t.secondary = true, secondary
+	t.manifestDir = conf.WALDir
+	if err := t.catchUp(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+/** 读取主实例最新的清单和日志，使secondary实例看到主实例此时已写入日志的数据
+ * 读取期间主实例可能归并掉清单中的文件或删除日志，此时返回错误并保持之前的状态，稍后重试即可
+ * 日志中有merge操作数时需在打开时设置config.MergeOperator；不能与其他TryCatchUpWithPrimary并发调用
+ */
+func (t *LSMTree) TryCatchUpWithPrimary() error {
+	if !t.secondary {
+		return fmt.Errorf("%w: not a secondary instance", ErrInvalidArgument)
+	}
+	return t.catchUp()
+}
+
+/** 加载清单中的磁盘文件，然后用清单中的起点之后的日志重建内存中的树，已加载的文件直接复用
+ * 新的文件和内存中的树在rwm的写锁下一起替换，任何一步失败时保持之前的状态
+ */
+func (t *LSMTree) catchUp() error {
+	loaded := make(map[string]*DiskFile)
+	v := t.CurrentVersion()
+	defer v.Release()
+	for _, files := range v.levels {
+		for _, d := range files {
+			loaded[d.path] = d
+		}
+	}
+	levels, logNum, err := t.openManifest(loaded)
+	if err != nil {
+		return fmt.Errorf("load manifest in %s: %w", t.manifestDir, err)
+	}
+	all, err := listLogs(t.config.FS, t.config.WALDir)
+	if err != nil {
+		releaseLevels(levels)
+		return fmt.Errorf("list logs in %s: %w", t.config.WALDir, err)
+	}
+	// 主实例只在更新清单后删除日志，清单的起点不变说明需要的日志都在all中
+	if m, err := readManifest(t.config.FS, t.manifestDir); err == nil && m.LogNum != logNum {
+		releaseLevels(levels)
+		return fmt.Errorf("manifest changed during catch-up, retry later")
+	}
+	var logs []int
+	for _, num := range all {
+		if num >= logNum {
+			logs = append(logs, num)
+		}
+	}
+
+	t.rwm.Lock()
+	defer t.rwm.Unlock()
+	old, oldSize := t.tree, t.TotalSize
+	t.tree = t.newMemtable()
+	if err := t.replayLogs(logs); err != nil {
+		t.tree, t.TotalSize = old, oldSize
+		releaseLevels(levels)
+		return fmt.Errorf("replay logs in %s: %w", t.config.WALDir, err)
+	}
+	t.TotalSize -= old.Size()
+	t.installManifest(levels, logNum)
+	t.publishView()
+	return nil
+}
@@ -0,0 +1,172 @@
+package lsmt
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"LSM-Tree/config"
+	"LSM-Tree/vfs"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/* 日志和磁盘文件都在fs中的配置，打开时由清单重新加载磁盘文件 */
+func manifestConfig(fs vfs.FS) *config.Config {
+	conf := walConfig(fs)
+	conf.MmapDir = "/db"
+	return conf
+}
+
+/* 写入[from, to)的key，每10个等待一次flush */
+func putKeys(t *testing.T, tree *LSMTree, from, to int) {
+	for i := from; i < to; i++ {
+		assert.Nil(t, tree.Put([]byte(fmt.Sprintf("key%03d", i)), []byte(fmt.Sprintf("value%d", i))))
+		if i%10 == 9 {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	time.Sleep(300 * time.Millisecond)
+}
+
+/* 重新打开时加载清单中的磁盘文件，只重放尚未flush的日志，并删除不在清单中的文件 */
+func TestReopenLoadsDiskFiles(t *testing.T) {
+	fs := vfs.NewMem()
+	assert.Nil(t, fs.MkdirAll("/db"))
+	conf := manifestConfig(fs)
+	tree, err := Open(10, conf)
+	assert.Nil(t, err)
+	putKeys(t, tree, 0, 45)
+	assert.Nil(t, tree.Delete([]byte("key001")))
+	levels := tree.LevelSummary()
+	assert.Equal(t, 1, len(levels[1].Files))
+	assert.Nil(t, tree.Close())
+
+	// 写入文件后、更新清单前崩溃时留下的文件
+	f, err := fs.Create("/db/999999.sst")
+	assert.Nil(t, err)
+	assert.Nil(t, f.Close())
+
+	tree, err = Open(10, conf)
+	assert.Nil(t, err)
+	assert.Equal(t, levels, tree.LevelSummary())
+	assertMissing(t, tree, "key001")
+	for i := 2; i < 45; i++ {
+		assertValue(t, tree, fmt.Sprintf("key%03d", i), fmt.Sprintf("value%d", i))
+	}
+	names, err := fs.List("/db")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{fmt.Sprintf("%06d.sst", levels[1].Files[0].ID)}, names)
+
+	// 新的文件不会覆盖已有的文件
+	putKeys(t, tree, 45, 50)
+	putKeys(t, tree, 0, 10)
+	assert.True(t, tree.LevelSummary()[0].Files[0].ID > levels[1].Files[0].ID)
+	assertValue(t, tree, "key001", "value1")
+	assertValue(t, tree, "key030", "value30")
+	assert.Nil(t, tree.Close())
+}
+
+/* 只读实例加载主实例的文件和日志，拒绝写入，关闭时不删除任何文件 */
+func TestOpenReadOnly(t *testing.T) {
+	fs := vfs.NewMem()
+	assert.Nil(t, fs.MkdirAll("/db"))
+	conf := manifestConfig(fs)
+	primary, err := Open(10, conf)
+	assert.Nil(t, err)
+	putKeys(t, primary, 0, 25)
+
+	ro, err := OpenReadOnly(conf)
+	assert.Nil(t, err)
+	for i := 0; i < 25; i++ {
+		assertValue(t, ro, fmt.Sprintf("key%03d", i), fmt.Sprintf("value%d", i))
+	}
+	assert.True(t, errors.Is(ro.Put([]byte("a"), []byte("b")), ErrReadOnly))
+	assert.True(t, errors.Is(ro.Delete([]byte("key000")), ErrReadOnly))
+	assert.True(t, errors.Is(ro.TryCatchUpWithPrimary(), ErrInvalidArgument))
+	assertMissing(t, ro, "a")
+
+	// 主实例之后的写入对只读实例不可见
+	putKeys(t, primary, 25, 30)
+	assertMissing(t, ro, "key027")
+
+	files, err := fs.List("/db")
+	assert.Nil(t, err)
+	logs, err := fs.List("/wal")
+	assert.Nil(t, err)
+	assert.Nil(t, ro.Close())
+	names, err := fs.List("/db")
+	assert.Nil(t, err)
+	assert.Equal(t, files, names)
+	names, err = fs.List("/wal")
+	assert.Nil(t, err)
+	assert.Equal(t, logs, names)
+	assert.Nil(t, primary.Close())
+}
+
+/* 只读实例通过config.MergeOperator重放主实例日志中的merge操作数 */
+func TestOpenReadOnlyWithMerge(t *testing.T) {
+	fs := vfs.NewMem()
+	assert.Nil(t, fs.MkdirAll("/db"))
+	conf := manifestConfig(fs)
+	conf.MergeOperator = Int64AddOperator{}
+	primary, err := Open(0, conf)
+	assert.Nil(t, err)
+	assert.Nil(t, primary.Merge([]byte("a"), []byte("1")))
+	assert.Nil(t, primary.Merge([]byte("a"), []byte("2")))
+
+	ro, err := OpenReadOnly(conf)
+	assert.Nil(t, err)
+	assertValue(t, ro, "a", "3")
+	assert.Nil(t, ro.Close())
+	assert.Nil(t, primary.Close())
+}
+
+/* secondary实例在主实例flush和归并之后仍能跟上主实例 */
+func TestSecondaryCatchUp(t *testing.T) {
+	fs := vfs.NewMem()
+	assert.Nil(t, fs.MkdirAll("/db"))
+	conf := manifestConfig(fs)
+	primary, err := Open(10, conf)
+	assert.Nil(t, err)
+	putKeys(t, primary, 0, 5)
+
+	secondary, err := OpenAsSecondary(conf)
+	assert.Nil(t, err)
+	assertValue(t, secondary, "key004", "value4")
+
+	putKeys(t, primary, 5, 45)
+	assert.Nil(t, primary.DeleteRange([]byte("key010"), []byte("key020")))
+	assertMissing(t, secondary, "key030")
+
+	assert.Nil(t, secondary.TryCatchUpWithPrimary())
+	assert.Equal(t, primary.LevelSummary(), secondary.LevelSummary())
+	for i := 0; i < 45; i++ {
+		key := fmt.Sprintf("key%03d", i)
+		if i >= 10 && i < 20 {
+			assertMissing(t, secondary, key)
+		} else {
+			assertValue(t, secondary, key, fmt.Sprintf("value%d", i))
+		}
+	}
+	assert.Nil(t, secondary.Close())
+	assert.Nil(t, primary.Close())
+}
+
+/* 清单记录了排序方式，使用不同的排序方式打开时返回错误 */
+func TestManifestComparatorMismatch(t *testing.T) {
+	fs := vfs.NewMem()
+	assert.Nil(t, fs.MkdirAll("/db"))
+	conf := manifestConfig(fs)
+	tree, err := Open(10, conf)
+	assert.Nil(t, err)
+	putKeys(t, tree, 0, 10)
+	assert.Nil(t, tree.Close())
+
+	conf.Comparator = reverseComparator{}
+	_, err = Open(10, conf)
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+	_, err = OpenReadOnly(conf)
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+}
@@ -0,0 +1,381 @@
+package lsmt
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/** 直方图，记录一组非负整数样本的分布
+ * 样本按上界递增的桶计数，所有操作都是原子的，可被多个线程并发调用
+ */
+type Histogram struct {
+	// 每个桶的上界（包含），最后一个桶的上界为正无穷
+	bounds []int64
+	counts []uint64
+	count  uint64
+	sum    int64
+	min    int64
+	max    int64
+}
+
+/* 创建一个以bounds为各桶上界的直方图，bounds需递增 */
+func NewHistogram(bounds []int64) *Histogram {
+	return &Histogram{
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)+1),
+		min:    math.MaxInt64,
+		max:    math.MinInt64,
+	}
+}
+
+/* 从start开始，每个上界是前一个的factor倍，共n个桶 */
+func ExponentialBounds(start int64, factor float64, n int) []int64 {
+	bounds := make([]int64, 0, n)
+	b := float64(start)
+	for i := 0; i < n; i++ {
+		bounds = append(bounds, int64(b))
+		b *= factor
+	}
+	return bounds
+}
+
+/* 记录一个样本 */
+func (h *Histogram) Observe(v int64) {
+	i := 0
+	for i < len(h.bounds) && v > h.bounds[i] {
+		i++
+	}
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddUint64(&h.count, 1)
+	atomic.AddInt64(&h.sum, v)
+	for old := atomic.LoadInt64(&h.min); v < old && !atomic.CompareAndSwapInt64(&h.min, old, v); old = atomic.LoadInt64(&h.min) {
+	}
+	for old := atomic.LoadInt64(&h.max); v > old && !atomic.CompareAndSwapInt64(&h.max, old, v); old = atomic.LoadInt64(&h.max) {
+	}
+}
+
+/* 返回直方图的快照，各值都乘以scale，例如纳秒乘以1e-9得到秒 */
+func (h *Histogram) Snapshot(scale float64) HistogramSnapshot {
+	s := HistogramSnapshot{
+		Count:   atomic.LoadUint64(&h.count),
+		Sum:     float64(atomic.LoadInt64(&h.sum)) * scale,
+		Buckets: make([]HistogramBucket, 0, len(h.counts)),
+	}
+	if s.Count > 0 {
+		s.Min = float64(atomic.LoadInt64(&h.min)) * scale
+		s.Max = float64(atomic.LoadInt64(&h.max)) * scale
+	}
+	var cumulative uint64
+	for i := range h.counts {
+		cumulative += atomic.LoadUint64(&h.counts[i])
+		bound := math.Inf(1)
+		if i < len(h.bounds) {
+			bound = float64(h.bounds[i]) * scale
+		}
+		s.Buckets = append(s.Buckets, HistogramBucket{UpperBound: bound, Count: cumulative})
+	}
+	return s
+}
+
+/* 直方图的快照 */
+type HistogramSnapshot struct {
+	Count    uint64
+	Sum      float64
+	Min, Max float64
+	// 各桶按上界递增，Count为小于等于该上界的样本数（累积计数）
+	Buckets []HistogramBucket
+}
+
+type HistogramBucket struct {
+	UpperBound float64
+	Count      uint64
+}
+
+func (s HistogramSnapshot) Mean() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Sum / float64(s.Count)
+}
+
+/* 估算第p百分位的样本值，0 <= p <= 100，在样本所在的桶内线性插值 */
+func (s HistogramSnapshot) Percentile(p float64) float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	rank := p / 100 * float64(s.Count)
+	lower, prev := s.Min, uint64(0)
+	for _, b := range s.Buckets {
+		if float64(b.Count) >= rank && b.Count > prev {
+			upper := math.Min(b.UpperBound, s.Max)
+			lower = math.Max(lower, s.Min)
+			return lower + (upper-lower)*(rank-float64(prev))/float64(b.Count-prev)
+		}
+		lower, prev = b.UpperBound, b.Count
+	}
+	return s.Max
+}
+
+/** LSMTree的运行统计
+ * 计数器和直方图在读写、flush和compact时更新，各层文件数和体积在文件变化时更新
+ * 所有方法都可被多个线程并发调用
+ */
+type Statistics struct {
+	// 延迟，单位是纳秒
+	getLatency    *Histogram
+	putLatency    *Histogram
+	deleteLatency *Histogram
+	// 每次MultiGet的延迟，其中每个key的命中情况和查找的文件个数计入Get的统计
+	multiGetLatency *Histogram
+	// 每次Get查找的磁盘文件个数
+	getFilesProbed *Histogram
+
+	getHits   int64
+	getMisses int64
+	// 写入的key和value的总字节数
+	bytesWritten int64
+
+	flushCount             int64
+	flushBytesWritten      int64
+	compactionCount        int64
+	compactionBytesRead    int64
+	compactionBytesWritten int64
+	// 写者被WriteBufferManager阻塞的总时长，单位是纳秒
+	stallNanos int64
+	// 写入预写日志的字节数和Sync次数，合并提交时多个写者共用一次Sync
+	walBytesWritten int64
+	walSyncs        int64
+
+	mu sync.Mutex
+	// 每层的文件个数和字节数
+	levelFiles []int
+	levelBytes []int
+	// 每层数据块的压缩比
+	levelCompressionRatios []float64
+}
+
+func newStatistics(levelCnt int) *Statistics {
+	latency := ExponentialBounds(1000, 2, 24) // 1us ~ 8s
+	return &Statistics{
+		getLatency:      NewHistogram(latency),
+		putLatency:      NewHistogram(latency),
+		deleteLatency:   NewHistogram(latency),
+		multiGetLatency: NewHistogram(latency),
+		getFilesProbed:  NewHistogram([]int64{0, 1, 2, 3, 4, 5, 6, 8, 10, 15, 20, 30, 50}),
+		levelFiles:      make([]int, levelCnt),
+		levelBytes:      make([]int, levelCnt),
+
+		levelCompressionRatios: make([]float64, levelCnt),
+	}
+}
+
+/* 返回LSMTree的运行统计 */
+func (t *LSMTree) Statistics() *Statistics {
+	return t.stats
+}
+
+/* 记录一次从start开始的Get */
+func (s *Statistics) recordGet(start time.Time, filesProbed int, hit bool) {
+	s.getLatency.Observe(int64(time.Since(start)))
+	s.getFilesProbed.Observe(int64(filesProbed))
+	if hit {
+		atomic.AddInt64(&s.getHits, 1)
+	} else {
+		atomic.AddInt64(&s.getMisses, 1)
+	}
+}
+
+/* 记录一次从start开始的MultiGet，每个key按一次Get计入命中数和查找的文件个数 */
+func (s *Statistics) recordMultiGet(start time.Time, gs []*getter) {
+	s.multiGetLatency.Observe(int64(time.Since(start)))
+	for _, g := range gs {
+		s.getFilesProbed.Observe(int64(g.filesProbed))
+		if g.err == nil {
+			atomic.AddInt64(&s.getHits, 1)
+		} else {
+			atomic.AddInt64(&s.getMisses, 1)
+		}
+	}
+}
+
+/* 记录一次从start开始的写入，可直接用于defer */
+func (s *Statistics) recordPut(start time.Time) {
+	s.putLatency.Observe(int64(time.Since(start)))
+}
+
+func (s *Statistics) recordDelete(start time.Time) {
+	s.deleteLatency.Observe(int64(time.Since(start)))
+}
+
+func (s *Statistics) recordBytesWritten(n int) {
+	atomic.AddInt64(&s.bytesWritten, int64(n))
+}
+
+func (s *Statistics) recordFlush(bytes int) {
+	atomic.AddInt64(&s.flushCount, 1)
+	atomic.AddInt64(&s.flushBytesWritten, int64(bytes))
+}
+
+func (s *Statistics) recordCompaction(bytesRead, bytesWritten int) {
+	atomic.AddInt64(&s.compactionCount, 1)
+	atomic.AddInt64(&s.compactionBytesRead, int64(bytesRead))
+	atomic.AddInt64(&s.compactionBytesWritten, int64(bytesWritten))
+}
+
+func (s *Statistics) recordStall(d time.Duration) {
+	atomic.AddInt64(&s.stallNanos, int64(d))
+}
+
+func (s *Statistics) recordWALWrite(bytes int) {
+	atomic.AddInt64(&s.walBytesWritten, int64(bytes))
+}
+
+func (s *Statistics) recordWALSync() {
+	atomic.AddInt64(&s.walSyncs, 1)
+}
+
+/* 根据各层磁盘文件的信息更新各层的文件个数、字节数和压缩比 */
+func (s *Statistics) updateLevels(levels []LevelSummary) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, l := range levels {
+		if i < len(s.levelFiles) {
+			s.levelFiles[i], s.levelBytes[i] = len(l.Files), l.Bytes
+			s.levelCompressionRatios[i] = l.CompressionRatio()
+		}
+	}
+}
+
+/* 统计信息的快照 */
+type StatisticsSnapshot struct {
+	// 延迟，单位是秒
+	GetLatency      HistogramSnapshot
+	PutLatency      HistogramSnapshot
+	DeleteLatency   HistogramSnapshot
+	MultiGetLatency HistogramSnapshot
+	// 每次Get查找的磁盘文件个数
+	GetFilesProbed HistogramSnapshot
+	GetHits        int64
+	GetMisses      int64
+
+	BytesWritten           int64
+	FlushCount             int64
+	FlushBytesWritten      int64
+	CompactionCount        int64
+	CompactionBytesRead    int64
+	CompactionBytesWritten int64
+	// 写放大：flush和compact写入磁盘的总字节数 / flush写入的字节数
+	WriteAmplification float64
+	// 读放大：平均每次Get查找的磁盘文件个数
+	ReadAmplification float64
+	StallTime         time.Duration
+	WALBytesWritten   int64
+	WALSyncs          int64
+
+	Level0FileCount int
+	// 每层的文件个数和字节数，下标即层级
+	LevelFileCounts []int
+	LevelSizes      []int
+	// 每层数据块的压缩比，即压缩前的字节数 / 压缩后的字节数，没有文件的层为0
+	LevelCompressionRatios []float64
+}
+
+func (s *Statistics) Snapshot() StatisticsSnapshot {
+	snap := StatisticsSnapshot{
+		GetLatency:             s.getLatency.Snapshot(1e-9),
+		PutLatency:             s.putLatency.Snapshot(1e-9),
+		DeleteLatency:          s.deleteLatency.Snapshot(1e-9),
+		MultiGetLatency:        s.multiGetLatency.Snapshot(1e-9),
+		GetFilesProbed:         s.getFilesProbed.Snapshot(1),
+		GetHits:                atomic.LoadInt64(&s.getHits),
+		GetMisses:              atomic.LoadInt64(&s.getMisses),
+		BytesWritten:           atomic.LoadInt64(&s.bytesWritten),
+		FlushCount:             atomic.LoadInt64(&s.flushCount),
+		FlushBytesWritten:      atomic.LoadInt64(&s.flushBytesWritten),
+		CompactionCount:        atomic.LoadInt64(&s.compactionCount),
+		CompactionBytesRead:    atomic.LoadInt64(&s.compactionBytesRead),
+		CompactionBytesWritten: atomic.LoadInt64(&s.compactionBytesWritten),
+		StallTime:              time.Duration(atomic.LoadInt64(&s.stallNanos)),
+		WALBytesWritten:        atomic.LoadInt64(&s.walBytesWritten),
+		WALSyncs:               atomic.LoadInt64(&s.walSyncs),
+	}
+	if snap.FlushBytesWritten > 0 {
+		snap.WriteAmplification = float64(snap.FlushBytesWritten+snap.CompactionBytesWritten) / float64(snap.FlushBytesWritten)
+	}
+	snap.ReadAmplification = snap.GetFilesProbed.Mean()
+	s.mu.Lock()
+	snap.LevelFileCounts = append([]int{}, s.levelFiles...)
+	snap.LevelSizes = append([]int{}, s.levelBytes...)
+	snap.LevelCompressionRatios = append([]float64{}, s.levelCompressionRatios...)
+	s.mu.Unlock()
+	if len(snap.LevelFileCounts) > 0 {
+		snap.Level0FileCount = snap.LevelFileCounts[0]
+	}
+	return snap
+}
+
+/* 以Prometheus文本格式输出统计信息，指标名以lsmt_开头 */
+func (s *Statistics) WritePrometheus(w io.Writer) error {
+	snap := s.Snapshot()
+	bw := bufio.NewWriter(w)
+	writeHistogram(bw, "lsmt_get_latency_seconds", "Latency of Get.", snap.GetLatency)
+	writeHistogram(bw, "lsmt_put_latency_seconds", "Latency of Put.", snap.PutLatency)
+	writeHistogram(bw, "lsmt_delete_latency_seconds", "Latency of Delete.", snap.DeleteLatency)
+	writeHistogram(bw, "lsmt_multi_get_latency_seconds", "Latency of MultiGet.", snap.MultiGetLatency)
+	writeHistogram(bw, "lsmt_get_files_probed", "Number of disk files probed per Get.", snap.GetFilesProbed)
+	writeMetric(bw, "lsmt_get_hits_total", "Number of Get calls that found the key.", "counter", float64(snap.GetHits))
+	writeMetric(bw, "lsmt_get_misses_total", "Number of Get calls that did not find the key.", "counter", float64(snap.GetMisses))
+	writeMetric(bw, "lsmt_bytes_written_total", "Bytes of keys and values written by users.", "counter", float64(snap.BytesWritten))
+	writeMetric(bw, "lsmt_flush_total", "Number of memtable flushes.", "counter", float64(snap.FlushCount))
+	writeMetric(bw, "lsmt_flush_bytes_written_total", "Bytes written to disk files by flush.", "counter", float64(snap.FlushBytesWritten))
+	writeMetric(bw, "lsmt_compaction_total", "Number of compactions.", "counter", float64(snap.CompactionCount))
+	writeMetric(bw, "lsmt_compaction_bytes_read_total", "Bytes read from disk files by compaction.", "counter", float64(snap.CompactionBytesRead))
+	writeMetric(bw, "lsmt_compaction_bytes_written_total", "Bytes written to disk files by compaction.", "counter", float64(snap.CompactionBytesWritten))
+	writeMetric(bw, "lsmt_write_amplification", "Bytes written by flush and compaction divided by bytes written by flush.", "gauge", snap.WriteAmplification)
+	writeMetric(bw, "lsmt_read_amplification", "Average number of disk files probed per Get.", "gauge", snap.ReadAmplification)
+	writeMetric(bw, "lsmt_stall_seconds_total", "Time writers were stalled by the write buffer manager.", "counter", snap.StallTime.Seconds())
+	writeMetric(bw, "lsmt_wal_bytes_written_total", "Bytes written to the write-ahead log.", "counter", float64(snap.WALBytesWritten))
+	writeMetric(bw, "lsmt_wal_syncs_total", "Number of write-ahead log syncs.", "counter", float64(snap.WALSyncs))
+	writeLevelMetric(bw, "lsmt_level_files", "Number of disk files per level.", snap.LevelFileCounts)
+	writeLevelMetric(bw, "lsmt_level_bytes", "Bytes of disk files per level.", snap.LevelSizes)
+	writeLevelRatioMetric(bw, "lsmt_level_compression_ratio", "Uncompressed bytes of data blocks divided by compressed bytes per level.", snap.LevelCompressionRatios)
+	return bw.Flush()
+}
+
+func writeMetric(w *bufio.Writer, name, help, typ string, v float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %s\n", name, help, name, typ, name, formatFloat(v))
+}
+
+func writeLevelMetric(w *bufio.Writer, name, help string, values []int) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	for level, v := range values {
+		fmt.Fprintf(w, "%s{level=\"%d\"} %d\n", name, level, v)
+	}
+}
+
+func writeLevelRatioMetric(w *bufio.Writer, name, help string, values []float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	for level, v := range values {
+		fmt.Fprintf(w, "%s{level=\"%d\"} %s\n", name, level, formatFloat(v))
+	}
+}
+
+func writeHistogram(w *bufio.Writer, name, help string, h HistogramSnapshot) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for _, b := range h.Buckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", name, formatFloat(b.UpperBound), b.Count)
+	}
+	fmt.Fprintf(w, "%s_sum %s\n%s_count %d\n", name, formatFloat(h.Sum), name, h.Count)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return fmt.Sprintf("%g", v)
+}
@@ -0,0 +1,85 @@
+package lsmt
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram([]int64{1, 2, 4, 8})
+	for _, v := range []int64{1, 2, 3, 3, 5, 100} {
+		h.Observe(v)
+	}
+	s := h.Snapshot(1)
+	assert.Equal(t, uint64(6), s.Count)
+	assert.Equal(t, float64(114), s.Sum)
+	assert.Equal(t, float64(1), s.Min)
+	assert.Equal(t, float64(100), s.Max)
+	assert.Equal(t, 19.0, s.Mean())
+	// 累积计数，最后一个桶的上界为+Inf
+	counts := make([]uint64, 0)
+	for _, b := range s.Buckets {
+		counts = append(counts, b.Count)
+	}
+	assert.Equal(t, []uint64{1, 2, 4, 5, 6}, counts)
+	assert.InDelta(t, 3, s.Percentile(50), 1)
+	assert.Equal(t, float64(100), s.Percentile(100))
+
+	assert.Equal(t, []int64{1000, 2000, 4000}, ExponentialBounds(1000, 2, 3))
+	assert.Equal(t, 0.0, NewHistogram(nil).Snapshot(1).Percentile(99))
+}
+
+func TestStatistics(t *testing.T) {
+	tree := NewLSMTree(2)
+	for i := 0; i < 8; i++ {
+		assert.Nil(t, tree.Put([]byte(fmt.Sprintf("%d", i)), []byte("value")))
+	}
+	assert.Nil(t, tree.Delete([]byte("0")))
+	// 等待flush和compaction
+	time.Sleep(1 * time.Second)
+	for i := 0; i < 8; i++ {
+		tree.Get([]byte(fmt.Sprintf("%d", i)))
+	}
+	tree.Get([]byte("not exist"))
+
+	s := tree.Statistics().Snapshot()
+	assert.Equal(t, uint64(8), s.PutLatency.Count)
+	assert.Equal(t, uint64(1), s.DeleteLatency.Count)
+	assert.Equal(t, uint64(9), s.GetLatency.Count)
+	assert.Equal(t, int64(7), s.GetHits)
+	assert.Equal(t, int64(2), s.GetMisses)
+	assert.Equal(t, int64(8*6+1), s.BytesWritten)
+	assert.Equal(t, int64(4), s.FlushCount)
+	assert.Equal(t, int64(1), s.CompactionCount)
+	assert.Less(t, int64(0), s.CompactionBytesWritten)
+	assert.Equal(t, s.FlushBytesWritten, s.CompactionBytesRead)
+	assert.Less(t, 1.0, s.WriteAmplification)
+	// 所有数据都已归并到level1的一个文件中
+	assert.Equal(t, 0, s.Level0FileCount)
+	assert.Equal(t, 1, s.LevelFileCounts[1])
+	assert.Equal(t, int(s.CompactionBytesWritten), s.LevelSizes[1])
+	// "0"的删除标记还在内存中，"not exist"不在level1文件的key范围内，都无需查找磁盘文件
+	assert.Equal(t, 7.0/9, s.ReadAmplification)
+
+	var buf bytes.Buffer
+	assert.Nil(t, tree.Statistics().WritePrometheus(&buf))
+	out := buf.String()
+	for _, line := range []string{
+		"# TYPE lsmt_get_latency_seconds histogram\n",
+		"lsmt_get_latency_seconds_bucket{le=\"+Inf\"} 9\n",
+		"lsmt_get_latency_seconds_count 9\n",
+		"lsmt_get_files_probed_bucket{le=\"0\"} 2\n",
+		"# TYPE lsmt_flush_total counter\nlsmt_flush_total 4\n",
+		"lsmt_get_misses_total 2\n",
+		"lsmt_level_files{level=\"0\"} 0\n",
+		"lsmt_level_files{level=\"1\"} 1\n",
+		"lsmt_level_compression_ratio{level=\"0\"} 0\n",
+		"lsmt_stall_seconds_total 0\n",
+	} {
+		assert.Contains(t, out, line)
+	}
+}
@@ -0,0 +1,85 @@
+package lsmt
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"LSM-Tree/config"
+)
+
+/* flush只写入level0，归并只写入level1，更深的层不会有文件 */
+const writtenLevels = 2
+
+/* 检查config.LevelDirs，只为会写入文件的层配置目录，更深层的目录永远不会被使用 */
+func checkLevelDirs(conf *config.Config) error {
+	if len(conf.LevelDirs) > writtenLevels {
+		return fmt.Errorf("%w: LevelDirs has %d entries, but only levels 0 and 1 hold disk files", ErrInvalidArgument, len(conf.LevelDirs))
+	}
+	return nil
+}
+
+/* 一个存放磁盘文件的目录的使用情况 */
+type DirUsage struct {
+	Dir string
+	// 当前Version中位于该目录的磁盘文件的字节数，已被删除但仍被旧Version引用的文件不计入
+	Bytes int64
+	// 来自config.DirCapacity，0表示不限制
+	Capacity int64
+}
+
+/* 目录中的文件是否超过了容量上限 */
+func (u DirUsage) Full() bool {
+	return u.Capacity > 0 && u.Bytes > u.Capacity
+}
+
+/* 返回各层使用的目录的使用情况，按层级从低到高的顺序排列，每个目录只出现一次 */
+func (t *LSMTree) StorageUsage() []DirUsage {
+	var usage []DirUsage
+	// 按清理后的路径比较目录，"/slow"与"/slow/"是同一个目录
+	capacity := make(map[string]int64, len(t.config.DirCapacity))
+	for dir, c := range t.config.DirCapacity {
+		capacity[filepath.Clean(dir)] = c
+	}
+	index := make(map[string]int)
+	for level := 0; level < t.config.FileLevelCnt; level++ {
+		dir := t.config.DirForLevel(level)
+		if _, ok := index[filepath.Clean(dir)]; ok || dir == "" {
+			continue
+		}
+		index[filepath.Clean(dir)] = len(usage)
+		usage = append(usage, DirUsage{Dir: dir, Capacity: capacity[filepath.Clean(dir)]})
+	}
+	v := t.CurrentVersion()
+	defer v.Release()
+	for _, files := range v.levels {
+		for _, d := range files {
+			if i, ok := index[filepath.Dir(d.path)]; ok && d.path != "" {
+				usage[i].Bytes += int64(d.GetFileSize())
+			}
+		}
+	}
+	return usage
+}
+
+/* 检查各目录是否超过容量上限，对新变满的目录输出警告并通知EventListener，调用时不能持有树的锁 */
+func (t *LSMTree) checkStorage() {
+	if len(t.config.DirCapacity) == 0 {
+		return
+	}
+	var full []DirUsage
+	t.storageMu.Lock()
+	if t.fullDirs == nil {
+		t.fullDirs = make(map[string]bool)
+	}
+	for _, u := range t.StorageUsage() {
+		if u.Full() && !t.fullDirs[u.Dir] {
+			full = append(full, u)
+		}
+		t.fullDirs[u.Dir] = u.Full()
+	}
+	t.storageMu.Unlock()
+	for _, u := range full {
+		t.logger.Warn("storage directory is full", "dir", u.Dir, "bytes", u.Bytes, "capacity", u.Capacity)
+		t.notify(func(l EventListener) { l.OnStorageFull(u) })
+	}
+}
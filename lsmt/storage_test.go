@@ -0,0 +1,113 @@
+package lsmt
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"LSM-Tree/config"
+	"LSM-Tree/vfs"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/* level0的文件写入快速的目录，归并产生的level1文件写入另一个目录，超过容量时报告该目录已满 */
+func TestLevelDirs(t *testing.T) {
+	fs := vfs.NewMem()
+	conf := testConfig(func(c *config.Config) {
+		c.FS = fs
+		c.LevelDirs = []string{"/fast", "/slow"}
+		c.DirCapacity = map[string]int64{"/slow": 1}
+	})
+	tree := NewLSMTreeWithConfig(10, conf)
+	r := &recordingListener{}
+	tree.AddEventListener(r)
+
+	assert.Equal(t, "/fast", conf.DirForLevel(0))
+	assert.Equal(t, "/slow", conf.DirForLevel(1))
+	assert.Equal(t, "/slow", conf.DirForLevel(4))
+
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, tree.Put([]byte(fmt.Sprintf("key%03d", i)), []byte("value")))
+	}
+	time.Sleep(100 * time.Millisecond)
+	levels := tree.LevelSummary()
+	assert.Equal(t, 1, len(levels[0].Files))
+	assert.Equal(t, "/fast", filepath.Dir(levels[0].Files[0].Path))
+	r.mu.Lock()
+	assert.Equal(t, 0, len(r.full))
+	r.mu.Unlock()
+
+	for i := 10; i < 40; i++ {
+		assert.Nil(t, tree.Put([]byte(fmt.Sprintf("key%03d", i)), []byte("value")))
+		if i%10 == 9 {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	levels = tree.LevelSummary()
+	assert.Equal(t, 0, len(levels[0].Files))
+	assert.Equal(t, 1, len(levels[1].Files))
+	assert.Equal(t, "/slow", filepath.Dir(levels[1].Files[0].Path))
+	names, err := fs.List("/fast")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(names))
+	names, err = fs.List("/slow")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{fmt.Sprintf("%06d.sst", levels[1].Files[0].ID)}, names)
+
+	usage := tree.StorageUsage()
+	assert.Equal(t, 2, len(usage))
+	assert.Equal(t, DirUsage{Dir: "/fast"}, usage[0])
+	assert.Equal(t, "/slow", usage[1].Dir)
+	assert.Equal(t, int64(levels[1].Files[0].Bytes), usage[1].Bytes)
+	assert.True(t, usage[1].Full())
+	// 只在目录变满时报告一次
+	r.mu.Lock()
+	assert.Equal(t, []DirUsage{usage[1]}, r.full)
+	r.mu.Unlock()
+
+	assert.Nil(t, tree.Close())
+}
+
+/* 只有level0和level1有文件，为更深的层配置目录时拒绝打开 */
+func TestLevelDirsTooDeep(t *testing.T) {
+	conf := testConfig(func(c *config.Config) {
+		c.FS = vfs.NewMem()
+		c.LevelDirs = []string{"/l0", "/l1", "/l2"}
+	})
+	_, err := Open(0, conf)
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+}
+
+/* 打开时创建MmapDir，目录容量按清理后的路径查找 */
+func TestOpenCreatesMmapDir(t *testing.T) {
+	fs := vfs.NewMem()
+	conf := testConfig(func(c *config.Config) {
+		c.FS = fs
+		c.MmapDir = "/db/sst"
+		c.DirCapacity = map[string]int64{"/db/sst/": 1}
+	})
+	tree, err := Open(2, conf)
+	assert.Nil(t, err)
+	r := &recordingListener{}
+	tree.AddEventListener(r)
+	assert.Nil(t, tree.Put([]byte("a"), []byte("value")))
+	assert.Nil(t, tree.Put([]byte("b"), []byte("value")))
+	assert.Eventually(t, func() bool {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return len(r.full) == 1
+	}, time.Second, 10*time.Millisecond)
+	names, err := fs.List("/db/sst")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(names))
+	usage := tree.StorageUsage()
+	assert.Equal(t, 1, len(usage))
+	assert.Equal(t, int64(1), usage[0].Capacity)
+	assert.True(t, usage[0].Full())
+	assert.Nil(t, tree.Close())
+}
@@ -34,7 +34,7 @@ func TestMergeUpdate(t *testing.T) {
 		sort.Strings(keys)
 		for i := 0; i < len(disk_elems); i++ {
 			disk_elems[i] = &core.Element{
-				Key: keys[i],
+				Key: []byte(keys[i]),
 			}
 		}
 		// fmt.Printf("disk %d, keys = %v\n", j, keys)
@@ -46,7 +46,7 @@ func TestMergeUpdate(t *testing.T) {
 	mergeElems := MergeUpdate(elems)
 	keys := make([]string, len(mergeElems))
 	for i, e := range mergeElems {
-		keys[i] = e.Key
+		keys[i] = string(e.Key)
 	}
 	sort.Strings(all_keys)
 	assert.Equal(t, all_keys, keys)
@@ -56,21 +56,21 @@ func TestMergeUpdate(t *testing.T) {
 
 func TestListInsert(t *testing.T) {
 	elems := []*core.Element{
-		{Key: "1", Value: "One"},
-		{Key: "2", Value: "Two"},
-		{Key: "3", Value: "Three"},
-		{Key: "4", Value: "Four"},
-		{Key: "5", Value: "Five"},
-		{Key: "6", Value: "Six"},
-		{Key: "7", Value: "Seven"},
-		// {Key: "8", Value: "Eight"},
-		// {Key: "9", Value: "Nine"},
+		{Key: []byte("1"), Value: []byte("One")},
+		{Key: []byte("2"), Value: []byte("Two")},
+		{Key: []byte("3"), Value: []byte("Three")},
+		{Key: []byte("4"), Value: []byte("Four")},
+		{Key: []byte("5"), Value: []byte("Five")},
+		{Key: []byte("6"), Value: []byte("Six")},
+		{Key: []byte("7"), Value: []byte("Seven")},
+		// {Key: []byte("8"), Value: []byte("Eight")},
+		// {Key: []byte("9"), Value: []byte("Nine")},
 	}
 
-	d1 := NewDiskFile(elems[0:2], 1)
-	d2 := NewDiskFile(elems[2:4], 1)
-	d3 := NewDiskFile(elems[4:6], 1)
-	d4 := NewDiskFile(elems[6:], 1)
+	d1 := newTestDiskFile(t, elems[0:2], 1)
+	d2 := newTestDiskFile(t, elems[2:4], 1)
+	d3 := newTestDiskFile(t, elems[4:6], 1)
+	d4 := newTestDiskFile(t, elems[6:], 1)
 
 	// 在链表中插入一些初始值
 	myList := list.New()
@@ -80,14 +80,40 @@ func TestListInsert(t *testing.T) {
 	files1 := []*DiskFile{d2, d3}
 
 	for e := myList.Front(); e != nil; e = e.Next() {
-		fmt.Printf("before listInsert, start_key: %v end_key: %v\n", e.Value.(*DiskFile).start_key, e.Value.(*DiskFile).end_key)
+		t.Logf("before listInsert, start_key: %v end_key: %v", e.Value.(*DiskFile).start_key, e.Value.(*DiskFile).end_key)
 	}
 
 	ListInsert(myList, files1)
 
 	// 打印链表中的所有值
 	for e := myList.Front(); e != nil; e = e.Next() {
-		fmt.Printf("after listInsert, start_key: %v end_key: %v\n", e.Value.(*DiskFile).start_key, e.Value.(*DiskFile).end_key)
+		t.Logf("after listInsert, start_key: %v end_key: %v", e.Value.(*DiskFile).start_key, e.Value.(*DiskFile).end_key)
 	}
-	// assert.Equal(t, false, true)
+	var got []*DiskFile
+	for e := myList.Front(); e != nil; e = e.Next() {
+		got = append(got, e.Value.(*DiskFile))
+	}
+	assert.Equal(t, []*DiskFile{d1, d2, d3, d4}, got)
+}
+
+func TestDropExpired(t *testing.T) {
+	elems := []*core.Element{
+		{Key: []byte("1"), Value: []byte("One")},
+		{Key: []byte("2"), Value: []byte("Two"), ExpireAt: 100},
+		{Key: []byte("3"), Value: []byte("Three"), ExpireAt: 200},
+	}
+	assert.Equal(t, elems, DropExpired(elems, 50))
+	assert.Equal(t, []*core.Element{elems[0], elems[2]}, DropExpired(elems, 100))
+	assert.Equal(t, []*core.Element{elems[0]}, DropExpired(elems, 300))
+	assert.Equal(t, 3, len(elems))
+}
+
+func TestDropCovered(t *testing.T) {
+	elems := []*core.Element{{Key: []byte("a")}, {Key: []byte("b")}, {Key: []byte("c")}, {Key: []byte("d")}}
+	tombstones := []core.RangeTombstone{{Start: []byte("b"), End: []byte("c")}, {Start: []byte("d"), End: []byte("e")}}
+	cmp := core.BytewiseComparator
+	assert.Equal(t, []*core.Element{elems[0], elems[2]}, DropCovered(cmp, elems, tombstones))
+	assert.Equal(t, elems, DropCovered(cmp, elems, nil))
+	assert.Equal(t, true, IsCoveredByRangeTombstones(cmp, tombstones, []byte("b")))
+	assert.Equal(t, false, IsCoveredByRangeTombstones(cmp, tombstones, []byte("c")))
 }
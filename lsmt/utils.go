@@ -2,7 +2,6 @@ package lsmt
 
 import (
 	"LSM-Tree/core"
-	log "LSM-Tree/log"
 	"container/list"
 	"fmt"
 	"reflect"
@@ -12,8 +11,8 @@ func GenerateData(elemCnt int) []*core.Element {
 	elems := make([]*core.Element, elemCnt)
 	for i := 0; i < elemCnt; i++ {
 		elem := &core.Element{
-			Key:   fmt.Sprintf("key%d", i),
-			Value: fmt.Sprintf("val%d", i),
+			Key:   []byte(fmt.Sprintf("key%d", i)),
+			Value: []byte(fmt.Sprintf("val%d", i)),
 		}
 		elems[i] = elem
 	}
@@ -21,6 +20,11 @@ func GenerateData(elemCnt int) []*core.Element {
 	return elems
 }
 
+/* 复制一个字节切片，nil复制后为空切片 */
+func clone(b []byte) []byte {
+	return append([]byte{}, b...)
+}
+
 func Max(i, j int) int {
 	if i > j {
 		return i
@@ -47,15 +51,18 @@ func ListRemove(list *list.List, val interface{}) {
 }
 
 /** 将compact得到的level1文件插入到level1文件列表中
-* 由于compact线程只有一个，且level1中的文件一直保持有序，可以保证遍历到
-的第一个start_key大于maxkey的文件之前的位置即为插入点
-*/
+* 由于compact线程只有一个，且level1中的文件一直保持有序，可以保证遍历到的第一个start_key大于maxkey的文件之前的位置即为插入点
+ */
 func ListInsert(l *list.List, files1 []*DiskFile) {
+	if len(files1) == 0 {
+		return
+	}
 	// 获取files1的key范围
 	max_key := MaxKeyOfDiskSlice(files1)
+	cmp := files1[0].cmp
 
 	// 寻找插入的位置
-	if l.Len() == 0 || l.Front().Value.(*DiskFile).start_key > max_key {
+	if l.Len() == 0 || cmp.Compare(l.Front().Value.(*DiskFile).start_key, max_key) > 0 {
 		for i := len(files1) - 1; i >= 0; i-- {
 			l.PushFront(files1[i])
 		}
@@ -70,7 +77,7 @@ func ListInsert(l *list.List, files1 []*DiskFile) {
 			break
 		}
 		d_next := next.Value.(*DiskFile)
-		if d_next.start_key > max_key {
+		if cmp.Compare(d_next.start_key, max_key) > 0 {
 			break
 		}
 		e = next
@@ -81,28 +88,41 @@ func ListInsert(l *list.List, files1 []*DiskFile) {
 	}
 }
 
-func MinKeyOfDiskSlice(files []*DiskFile) string {
+func MinKeyOfDiskSlice(files []*DiskFile) []byte {
 	if len(files) == 0 {
-		return ""
+		return nil
 	}
+	cmp := files[0].cmp
 	min_key := files[0].start_key
 	for i := 0; i < len(files); i++ {
-		if files[i].start_key < min_key {
+		if cmp.Compare(files[i].start_key, min_key) < 0 {
 			min_key = files[i].start_key
 		}
+		// 范围删除标记覆盖的key也属于文件的key范围
+		for _, r := range files[i].range_dels {
+			if cmp.Compare(r.Start, min_key) < 0 {
+				min_key = r.Start
+			}
+		}
 	}
 	return min_key
 }
 
-func MaxKeyOfDiskSlice(files []*DiskFile) string {
+func MaxKeyOfDiskSlice(files []*DiskFile) []byte {
 	if len(files) == 0 {
-		return ""
+		return nil
 	}
+	cmp := files[0].cmp
 	max_key := files[0].end_key
 	for i := 0; i < len(files); i++ {
-		if files[i].end_key > max_key {
+		if cmp.Compare(files[i].end_key, max_key) > 0 {
 			max_key = files[i].end_key
 		}
+		for _, r := range files[i].range_dels {
+			if cmp.Compare(r.End, max_key) > 0 {
+				max_key = r.End
+			}
+		}
 	}
 	return max_key
 }
@@ -115,11 +135,28 @@ func DiskList2Slice(l *list.List) []*DiskFile {
 	return diskFiles
 }
 
+/* 一组磁盘文件的总字节数 */
+func diskFilesSize(files []*DiskFile) int {
+	size := 0
+	for _, d := range files {
+		size += d.GetFileSize()
+	}
+	return size
+}
+
 /** 对几个level0文件的元素进行合并和更新
  * 当出现相同key时，要注意新旧关系
  * 参数elems默认从level0的链表按顺序转换过来，index越小的文件越新
  */
 func MergeUpdate(elems [][]*core.Element) []*core.Element {
+	res, _ := MergeUpdateWith(elems, core.BytewiseComparator, nil)
+	return res
+}
+
+/** 与MergeUpdate相同，但出现相同key时用combine将较新和较旧的记录合并成一条，而不是直接丢弃较旧的记录
+ * combine为nil时只保留最新的记录；combine返回错误时停止合并并返回该错误
+ */
+func MergeUpdateWith(elems [][]*core.Element, cmp core.Comparator, combine func(newer, older *core.Element) (*core.Element, error)) ([]*core.Element, error) {
 	total_num := 0
 	n := len(elems)
 	for _, disk_elems := range elems {
@@ -132,12 +169,12 @@ func MergeUpdate(elems [][]*core.Element) []*core.Element {
 	}
 	for {
 		min_key_disk_index := -1
-		min_key := ""
+		var min_key []byte
 		remain := 0
 		for i := 0; i < n; i++ {
 			if indices[i] < len(elems[i]) {
 				remain += 1
-				if min_key == "" || elems[i][indices[i]].Key < min_key {
+				if min_key_disk_index == -1 || cmp.Compare(elems[i][indices[i]].Key, min_key) < 0 {
 					min_key_disk_index = i
 					min_key = elems[i][indices[i]].Key
 				}
@@ -146,17 +183,59 @@ func MergeUpdate(elems [][]*core.Element) []*core.Element {
 		if remain <= 1 { // 只剩最多一个数组
 			break
 		}
-		res = append(res, elems[min_key_disk_index][indices[min_key_disk_index]])
+		elem := elems[min_key_disk_index][indices[min_key_disk_index]]
 		// 更新min_key_disk_index对应的数组的下标，同时也去除其他文件中的重复key的较旧记录
 		for i := 0; i < n; i++ {
-			if indices[i] < len(elems[i]) && elems[i][indices[i]].Key == min_key {
+			if indices[i] < len(elems[i]) && cmp.Compare(elems[i][indices[i]].Key, min_key) == 0 {
+				if combine != nil && i != min_key_disk_index {
+					var err error
+					if elem, err = combine(elem, elems[i][indices[i]]); err != nil {
+						return nil, err
+					}
+				}
 				indices[i] += 1
 			}
 		}
+		res = append(res, elem)
 	}
 	for i := 0; i < n; i++ {
 		res = append(res, elems[i][indices[i]:]...)
 	}
+	return res, nil
+}
+
+/* 返回elems中未在给定时间（UnixNano）过期的元素，elems本身不会被修改 */
+func DropExpired(elems []*core.Element, now int64) []*core.Element {
+	res := make([]*core.Element, 0, len(elems))
+	for _, e := range elems {
+		if !e.IsExpired(now) {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+/* 判断key是否被任意一个范围删除标记覆盖 */
+func IsCoveredByRangeTombstones(cmp core.Comparator, tombstones []core.RangeTombstone, key []byte) bool {
+	for i := range tombstones {
+		if tombstones[i].Covers(cmp, key) {
+			return true
+		}
+	}
+	return false
+}
+
+/* 返回elems中未被范围删除标记覆盖的元素，elems本身不会被修改 */
+func DropCovered(cmp core.Comparator, elems []*core.Element, tombstones []core.RangeTombstone) []*core.Element {
+	if len(tombstones) == 0 {
+		return elems
+	}
+	res := make([]*core.Element, 0, len(elems))
+	for _, e := range elems {
+		if !IsCoveredByRangeTombstones(cmp, tombstones, e.Key) {
+			res = append(res, e)
+		}
+	}
 	return res
 }
 
@@ -172,24 +251,20 @@ func (t *LSMTree) Print_Files_0_1_Ranges() {
 		for e := files.Front(); e != nil; e = e.Next() {
 			d := e.Value.(*DiskFile)
 			ids = append(ids, int(d.id))
-			ranges = append(ranges, d.GetKeyRange())
+			ranges = append(ranges, [2]string{string(d.start_key), string(d.end_key)})
 		}
-		log.Logger.Debug("files info", "level", i, "file_cnt", files.Len(), "ids", ids, "ranges", ranges)
+		t.logger.Debug("files info", "level", i, "file_cnt", files.Len(), "ids", ids, "ranges", ranges)
 	}
 
 }
 
 func (t *LSMTree) Log_file_info() {
 	t.Print_Files_0_1_Ranges()
-	files := t.GetDiskFiles()
-	cnt := 0
-	log.Logger.Debug("final file1 info:")
-	for e := files[1].Front(); e != nil; e = e.Next() {
-		d := e.Value.(*DiskFile)
-		key_range := d.GetKeyRange()
-		log.Logger.Debug(fmt.Sprintf("file %d, size = %d, key_range=[%v,%v]", d.GetID(), d.GetSize(), key_range[0], key_range[1]))
-		cnt += d.GetSize()
-	}
-	log.Logger.Debug(fmt.Sprintf("total sizes: %d", cnt))
+	level1 := t.LevelSummary()[1]
+	t.logger.Debug("final file1 info:")
+	for _, f := range level1.Files {
+		t.logger.Debug(fmt.Sprintf("file %d, size = %d, key_range=[%s,%s]", f.ID, f.Size, f.StartKey, f.EndKey))
+	}
+	t.logger.Debug(fmt.Sprintf("total sizes: %d", level1.Size))
 
 }
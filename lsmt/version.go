@@ -0,0 +1,83 @@
+package lsmt
+
+import (
+	"sync/atomic"
+)
+
+/** 某一时刻所有层级的磁盘文件的只读快照
+ * 每次flush或compact修改磁盘文件后发布一个新的Version，已发布的Version不会再被修改
+ * Version持有其中每个文件的引用，读者取得Version后无需加锁即可读取其中的文件，被删除的文件在所有引用它的Version都被释放后才会释放数据
+ */
+type Version struct {
+	// 下标即层级，level0的文件从新到旧排列，其他层的文件按key排列
+	levels [][]*DiskFile
+	refs   int32
+}
+
+/* 由各层的文件创建一个Version，调用者持有返回的Version的一个引用 */
+func newVersion(levels [][]*DiskFile) *Version {
+	v := &Version{levels: levels, refs: 1}
+	for _, files := range v.levels {
+		refFiles(files)
+	}
+	return v
+}
+
+func (v *Version) ref() {
+	atomic.AddInt32(&v.refs, 1)
+}
+
+/* 释放一个引用，之后不能再读取该Version，引用计数归零时释放其中所有文件的引用 */
+func (v *Version) Release() {
+	if atomic.AddInt32(&v.refs, -1) != 0 {
+		return
+	}
+	for _, files := range v.levels {
+		unrefFiles(files)
+	}
+}
+
+/* 返回各层磁盘文件的信息，下标即层级 */
+func (v *Version) LevelSummary() []LevelSummary {
+	levels := make([]LevelSummary, len(v.levels))
+	for i, files := range v.levels {
+		levels[i].Level = i
+		levels[i].Files = make([]FileSummary, 0, len(files))
+		for _, d := range files {
+			f := d.summary()
+			levels[i].Files = append(levels[i].Files, f)
+			levels[i].Size += f.Size
+			levels[i].Bytes += f.Bytes
+			levels[i].DataBytes += f.DataBytes
+			levels[i].RawDataBytes += f.RawDataBytes
+		}
+	}
+	return levels
+}
+
+/* 取得当前的Version，使用完毕后需调用Release */
+func (t *LSMTree) CurrentVersion() *Version {
+	t.versionMu.Lock()
+	defer t.versionMu.Unlock()
+	t.version.ref()
+	return t.version
+}
+
+/** 由各层的文件链表发布一个新的Version，替换并释放旧的Version
+ * 调用者需持有drwm的写锁，返回的Version在drwm释放之前一直有效
+ */
+func (t *LSMTree) installVersion() *Version {
+	levels := make([][]*DiskFile, t.config.FileLevelCnt)
+	for i := range levels {
+		levels[i] = DiskList2Slice(t.diskFiles[i])
+	}
+	v := newVersion(levels)
+	t.versionMu.Lock()
+	old := t.version
+	t.version = v
+	t.versionMu.Unlock()
+	if old != nil {
+		old.Release()
+	}
+	return v
+}
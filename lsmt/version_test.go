@@ -0,0 +1,71 @@
+//go:build unix
+
+package lsmt
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/* 被Version引用的文件在归并删除后仍可读取，Version释放后才删除 */
+func TestVersionPinsFiles(t *testing.T) {
+	conf := mmapConfig(t)
+	tree := NewLSMTreeWithConfig(10, conf)
+	put := func(from, to int) {
+		for i := from; i < to; i++ {
+			assert.Nil(t, tree.Put([]byte(fmt.Sprintf("key%03d", i)), []byte(fmt.Sprintf("value%d", i))))
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	for i := 0; i < 3; i++ {
+		put(i*10, i*10+10)
+	}
+	v := tree.CurrentVersion()
+	assert.Equal(t, 3, len(v.LevelSummary()[0].Files))
+
+	// 第4个level0文件触发归并
+	put(30, 40)
+	time.Sleep(500 * time.Millisecond)
+	levels := tree.LevelSummary()
+	assert.Equal(t, 0, len(levels[0].Files))
+	assert.Equal(t, 1, len(levels[1].Files))
+	assert.Equal(t, 3+1, countFiles(t, conf.MmapDir))
+	for i, d := range v.levels[0] {
+		// level0从新到旧排列
+		key := fmt.Sprintf("key%03d", (2-i)*10)
+		e, err := d.Search([]byte(key))
+		assert.Nil(t, err)
+		assert.Equal(t, key, string(e.Key))
+	}
+
+	v.Release()
+	assert.Equal(t, 1, countFiles(t, conf.MmapDir))
+	assert.Nil(t, tree.Close())
+	assert.Equal(t, 0, countFiles(t, conf.MmapDir))
+}
+
+/* Get不需要磁盘文件链表的锁 */
+func TestGetWithoutDiskLock(t *testing.T) {
+	tree := NewLSMTree(2)
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, tree.Put([]byte(fmt.Sprintf("%d", i)), []byte("value")))
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	tree.drwm.Lock()
+	defer tree.drwm.Unlock()
+	done := make(chan error)
+	go func() {
+		_, err := tree.Get([]byte("0"))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Get blocked by drwm")
+	}
+}
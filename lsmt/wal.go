@@ -0,0 +1,425 @@
+package lsmt
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"LSM-Tree/core"
+	"LSM-Tree/vfs"
+)
+
+const (
+	walMagic uint32 = 0x4c4f4731 // "LOG1"
+	// 每条记录的头部：uint32(len(payload)), uint32(crc32c(payload))
+	walRecordHeaderSize = 8
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+/* 日志中的记录不完整或已损坏 */
+var errBadRecord = errors.New("bad log record")
+
+/** 预写日志，每次写入追加一条或多条记录，每棵内存中的树开始时切换到一个新的日志文件
+ * 日志文件名为<dir>/%06d.log，编号递增；文件以头部开始：uint32魔数, uint16(len(keyID)), keyID
+ * 之后是若干条记录，每条记录为uint32(len(payload)), uint32(crc32c(payload)), payload，整数均为小端序
+ * 设置了KeyProvider时payload按记录加密，keyID为加密使用的密钥ID，为空表示未加密
+ * 所有方法都由mu保护，可被多个线程并发调用，写入或Sync失败后之后的写入都返回该错误
+ */
+type logWriter struct {
+	mu    sync.Mutex
+	fs    vfs.FS
+	dir   string
+	keys  core.KeyProvider
+	stats *Statistics
+	// 当前日志文件的编号和文件，offset是已写入的字节数，dirty表示有尚未Sync的数据
+	num    int
+	file   vfs.File
+	offset int
+	dirty  bool
+	aead   cipher.AEAD
+	// 尚未删除的所有日志文件的编号，从小到大排列，包括当前日志文件
+	logs []int
+	err  error
+}
+
+func logName(dir string, num int) string {
+	return filepath.Join(dir, fmt.Sprintf("%06d.log", num))
+}
+
+/* 返回dir中所有日志文件的编号，从小到大排列 */
+func listLogs(fs vfs.FS, dir string) ([]int, error) {
+	names, err := fs.List(dir)
+	if err != nil {
+		return nil, err
+	}
+	var nums []int
+	for _, name := range names {
+		if !strings.HasSuffix(name, ".log") {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimSuffix(name, ".log")); err == nil {
+			nums = append(nums, n)
+		}
+	}
+	sort.Ints(nums)
+	return nums, nil
+}
+
+/* 在dir中创建编号为num的日志文件并开始写入，logs是dir中已有的日志文件编号 */
+func newLogWriter(fs vfs.FS, dir string, num int, logs []int, keys core.KeyProvider, stats *Statistics) (*logWriter, error) {
+	l := &logWriter{fs: fs, dir: dir, keys: keys, stats: stats, logs: logs}
+	if err := l.create(num); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+/* 创建编号为num的日志文件并写入头部，调用者需持有mu */
+func (l *logWriter) create(num int) error {
+	var keyID string
+	var aead cipher.AEAD
+	if l.keys != nil {
+		id, key, err := l.keys.CurrentKey()
+		if err != nil {
+			return fmt.Errorf("get encryption key for log %d: %w", num, err)
+		}
+		if aead, err = newAEAD(key); err != nil {
+			return fmt.Errorf("create cipher with key %q: %w", id, err)
+		}
+		keyID = id
+	}
+	name := logName(l.dir, num)
+	f, err := l.fs.Create(name)
+	if err != nil {
+		return err
+	}
+	header := binary.LittleEndian.AppendUint32(nil, walMagic)
+	header = binary.LittleEndian.AppendUint16(header, uint16(len(keyID)))
+	header = append(header, keyID...)
+	_, err = f.Write(header)
+	// 日志文件的创建需要持久化，否则崩溃后整个文件可能丢失
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = l.fs.SyncDir(l.dir)
+	}
+	if err != nil {
+		f.Close()
+		l.fs.Remove(name)
+		return err
+	}
+	l.num, l.file, l.offset, l.dirty, l.aead = num, f, len(header), false, aead
+	l.logs = append(l.logs, num)
+	return nil
+}
+
+/** 将records依次追加到当前日志文件，sync为true时写入后Sync
+ * 返回写入的日志文件的编号
+ */
+func (l *logWriter) write(records [][]byte, sync bool) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return 0, l.err
+	}
+	var buf []byte
+	for _, r := range records {
+		if l.aead != nil {
+			var err error
+			// 以payload在文件中的位置作为附加数据
+			if r, err = sealBlock(l.aead, l.offset+len(buf)+walRecordHeaderSize, r); err != nil {
+				return 0, err
+			}
+		}
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(r)))
+		buf = binary.LittleEndian.AppendUint32(buf, crc32.Checksum(r, crcTable))
+		buf = append(buf, r...)
+	}
+	if _, err := l.file.Write(buf); err != nil {
+		l.err = fmt.Errorf("write log %d: %w", l.num, err)
+		return 0, l.err
+	}
+	l.offset += len(buf)
+	l.dirty = true
+	l.stats.recordWALWrite(len(buf))
+	if sync {
+		if err := l.syncLocked(); err != nil {
+			return 0, err
+		}
+	}
+	return l.num, nil
+}
+
+/* 将当前日志文件中尚未Sync的数据持久化 */
+func (l *logWriter) sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return l.err
+	}
+	return l.syncLocked()
+}
+
+func (l *logWriter) syncLocked() error {
+	if !l.dirty {
+		return nil
+	}
+	if err := l.file.Sync(); err != nil {
+		l.err = fmt.Errorf("sync log %d: %w", l.num, err)
+		return l.err
+	}
+	l.dirty = false
+	l.stats.recordWALSync()
+	return nil
+}
+
+/* 切换到一个新的日志文件，返回新文件的编号；失败时仍使用当前文件，返回当前文件的编号 */
+func (l *logWriter) rotate() (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return l.num, l.err
+	}
+	if err := l.syncLocked(); err != nil {
+		return l.num, err
+	}
+	old := l.file
+	if err := l.create(l.num + 1); err != nil {
+		return l.num, err
+	}
+	old.Close()
+	return l.num, nil
+}
+
+/* 当前日志文件的编号 */
+func (l *logWriter) current() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.num
+}
+
+/* 删除编号小于num的日志文件，其中的数据都已写入磁盘文件，当前日志文件不会被删除 */
+func (l *logWriter) removeBefore(num int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var errs []error
+	i := 0
+	for ; i < len(l.logs) && l.logs[i] < num && l.logs[i] != l.num; i++ {
+		if err := l.fs.Remove(logName(l.dir, l.logs[i])); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	l.logs = l.logs[i:]
+	return errors.Join(errs...)
+}
+
+/* Sync并关闭当前日志文件 */
+func (l *logWriter) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	err := l.err
+	if err == nil {
+		err = l.syncLocked()
+	}
+	if cerr := l.file.Close(); err == nil {
+		err = cerr
+	}
+	if l.err == nil {
+		l.err = errors.New("log is closed")
+	}
+	return err
+}
+
+/** 依次读取日志文件中的记录，对每条记录的payload调用fn
+ * 崩溃时最后一条记录可能只写入了一部分，遇到不完整、校验或解密失败的记录时停止读取，返回已读取的记录数和包装了errBadRecord的错误；fn返回错误时停止读取并返回该错误
+ */
+func readLog(fs vfs.FS, name string, keys core.KeyProvider, fn func(payload []byte) error) (int, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return 0, err
+	}
+	// 刚创建的日志文件可能还没有写完头部，与末尾不完整的记录一样处理
+	if len(data) < 6 {
+		return 0, fmt.Errorf("%s: %w: truncated header", name, errBadRecord)
+	}
+	if binary.LittleEndian.Uint32(data) != walMagic {
+		return 0, fmt.Errorf("%s: bad log header", name)
+	}
+	keyLen := int(binary.LittleEndian.Uint16(data[4:]))
+	offset := 6 + keyLen
+	if offset > len(data) {
+		return 0, fmt.Errorf("%s: %w: truncated header", name, errBadRecord)
+	}
+	var aead cipher.AEAD
+	if keyID := string(data[6:offset]); keyID != "" {
+		if keys == nil {
+			return 0, fmt.Errorf("%s: log is encrypted with key %q but no KeyProvider is configured", name, keyID)
+		}
+		key, err := keys.Key(keyID)
+		if err != nil {
+			return 0, err
+		}
+		if aead, err = newAEAD(key); err != nil {
+			return 0, err
+		}
+	}
+	cnt := 0
+	for offset < len(data) {
+		if len(data)-offset < walRecordHeaderSize {
+			return cnt, fmt.Errorf("%s: %w: truncated header at %d", name, errBadRecord, offset)
+		}
+		n := int(binary.LittleEndian.Uint32(data[offset:]))
+		sum := binary.LittleEndian.Uint32(data[offset+4:])
+		start := offset + walRecordHeaderSize
+		if n > len(data)-start {
+			return cnt, fmt.Errorf("%s: %w: truncated payload at %d", name, errBadRecord, offset)
+		}
+		payload := data[start : start+n]
+		if crc32.Checksum(payload, crcTable) != sum {
+			return cnt, fmt.Errorf("%s: %w: checksum mismatch at %d", name, errBadRecord, offset)
+		}
+		if aead != nil {
+			if payload, err = openBlock(aead, start, payload); err != nil {
+				return cnt, fmt.Errorf("%s: %w: %v", name, errBadRecord, err)
+			}
+		}
+		if err := fn(payload); err != nil {
+			return cnt, err
+		}
+		cnt++
+		offset = start + n
+	}
+	return cnt, nil
+}
+
+/** 重放config.WALDir中的日志，然后创建新的日志文件开始写入
+ * 编号小于清单中记录的起点的日志中的数据已在磁盘文件中，直接删除
+ */
+func (t *LSMTree) openWAL() error {
+	fs, dir := t.config.FS, t.config.WALDir
+	if err := fs.MkdirAll(dir); err != nil {
+		return err
+	}
+	all, err := listLogs(fs, dir)
+	if err != nil {
+		return err
+	}
+	var logs []int
+	for _, num := range all {
+		if num >= t.logNum {
+			logs = append(logs, num)
+		} else if err := fs.Remove(logName(dir, num)); err != nil {
+			return err
+		}
+	}
+	t.rwm.Lock()
+	defer t.rwm.Unlock()
+	if err := t.replayLogs(logs); err != nil {
+		return err
+	}
+
+	// 新日志的编号不能小于清单中的起点，否则下次打开时会被跳过
+	next := max(1, t.logNum)
+	if len(all) > 0 {
+		next = max(next, all[len(all)-1]+1)
+	}
+	if t.wal, err = newLogWriter(fs, dir, next, logs, t.config.KeyProvider, t.stats); err != nil {
+		return err
+	}
+	// 重放的数据在旧的日志文件中，直到它们被flush
+	t.nextLog = next
+	t.memLogs = map[Memtable]int{t.tree: next}
+	if len(logs) > 0 {
+		t.memLogs[t.tree] = logs[0]
+	}
+	if t.config.WALSyncInterval > 0 {
+		t.syncerStop = make(chan struct{})
+		stop := t.syncerStop
+		t.goBackground(func() { t.syncWALPeriodically(t.config.WALSyncInterval, stop) })
+	}
+	if t.shouldFlush() {
+		t.toFlush()
+	}
+	return nil
+}
+
+/** 依次将config.WALDir中编号为logs的日志重放到内存中的树，调用者需持有rwm的写锁
+ * 只有最后一个日志末尾的不完整记录被丢弃，更早的日志中有损坏的记录时返回包装了ErrCorruption的错误
+ * merge操作数与已重放的记录合并失败时返回该错误
+ */
+func (t *LSMTree) replayLogs(logs []int) error {
+	fs, dir := t.config.FS, t.config.WALDir
+	for i, num := range logs {
+		n, err := readLog(fs, logName(dir, num), t.config.KeyProvider, func(payload []byte) error {
+			b, err := decodeWriteBatch(payload)
+			if err != nil {
+				return err
+			}
+			for _, op := range b.ops {
+				if op.kind == batchMerge && t.mergeOperator == nil {
+					return fmt.Errorf("%w: log contains merge operands but config.MergeOperator is not set", ErrInvalidArgument)
+				}
+				if err := t.apply(op); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if errors.Is(err, errBadRecord) && i < len(logs)-1 {
+			// 切换日志前已Sync，只有最后一个日志可能在崩溃时没有写完
+			return fmt.Errorf("%w: replay log %d: %v", ErrCorruption, num, err)
+		} else if errors.Is(err, errBadRecord) {
+			t.logger.Warn("dropped incomplete log records", "log", num, "replayed", n, "err", err)
+		} else if err != nil {
+			return fmt.Errorf("replay log %d: %w", num, err)
+		}
+		t.logger.Info("replayed log", "log", num, "records", n)
+	}
+	return nil
+}
+
+/* 返回所有尚未flush的内存中的树的数据所在的最早的日志编号，调用者需持有rwm */
+func (t *LSMTree) minMemLog() int {
+	min := math.MaxInt
+	for _, num := range t.memLogs {
+		if num < min {
+			min = num
+		}
+	}
+	return min
+}
+
+/* 每隔interval将日志中尚未Sync的数据持久化，使不要求Sync的写入最多丢失interval内的数据，直到stop被关闭 */
+func (t *LSMTree) syncWALPeriodically(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := t.wal.sync(); err != nil {
+				// 日志已不可写，之后的写入都会返回该错误
+				t.logger.Error("failed to sync log", "err", err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package lsmt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"LSM-Tree/config"
+	"LSM-Tree/core"
+	"LSM-Tree/vfs"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func walConfig(fs vfs.FS) *config.Config {
+	return testConfig(func(c *config.Config) {
+		c.FS = fs
+		c.WALDir = "/wal"
+	})
+}
+
+func assertValue(t *testing.T, tree *LSMTree, key, value string) {
+	v, err := tree.Get([]byte(key))
+	if assert.Nil(t, err, key) {
+		assert.Equal(t, value, string(v), key)
+	}
+}
+
+func assertMissing(t *testing.T, tree *LSMTree, key string) {
+	_, err := tree.Get([]byte(key))
+	assert.NotNil(t, err, key)
+}
+
+/* 重新打开后重放日志，恢复尚未flush的写入 */
+func TestWALRecovery(t *testing.T) {
+	conf := walConfig(vfs.NewMem())
+	tree, err := Open(0, conf)
+	assert.Nil(t, err)
+	assert.Nil(t, tree.Put([]byte("a"), []byte("1")))
+	assert.Nil(t, tree.PutWithOptions([]byte("b"), []byte("2"), WriteOptions{Sync: true}))
+	assert.Nil(t, tree.Delete([]byte("a")))
+	b := &WriteBatch{}
+	b.Put([]byte("c"), []byte("3"))
+	b.Put([]byte("d"), []byte("4"))
+	b.DeleteRange([]byte("d"), []byte("e"))
+	assert.Nil(t, tree.Write(b, WriteOptions{}))
+	assert.Nil(t, tree.PutWithOptions([]byte("nolog"), []byte("5"), WriteOptions{DisableWAL: true}))
+	assert.Nil(t, tree.PutWithTTL([]byte("ttl"), []byte("6"), time.Hour))
+	assert.Nil(t, tree.Close())
+
+	tree, err = Open(0, conf)
+	assert.Nil(t, err)
+	assertMissing(t, tree, "a")
+	assertValue(t, tree, "b", "2")
+	assertValue(t, tree, "c", "3")
+	assertMissing(t, tree, "d")
+	assertMissing(t, tree, "nolog")
+	assertValue(t, tree, "ttl", "6")
+	assert.Nil(t, tree.Close())
+}
+
+/* 不合法的操作使整个WriteBatch都不写入 */
+func TestWriteBatchAtomic(t *testing.T) {
+	tree := NewLSMTree(0)
+	b := &WriteBatch{}
+	b.Put([]byte("a"), []byte("1"))
+	b.Put([]byte("b"), []byte(config.DefaultConfig().DeleteValue))
+	assert.True(t, errors.Is(tree.Write(b, WriteOptions{}), ErrReservedValue))
+	assertMissing(t, tree, "a")
+
+	b = &WriteBatch{}
+	b.Put([]byte("a"), []byte("1"))
+	b.Merge([]byte("a"), []byte("2"))
+	assert.True(t, errors.Is(tree.Write(b, WriteOptions{}), ErrInvalidArgument))
+	tree.SetMergeOperator(Int64AddOperator{})
+	assert.Nil(t, tree.Write(b, WriteOptions{}))
+	assert.Equal(t, 2, b.Len())
+	assertValue(t, tree, "a", "3")
+}
+
+/* 断电后只保留已Sync的写入，日志末尾不完整的记录被丢弃 */
+func TestWALCrash(t *testing.T) {
+	fs := vfs.NewFaultFS(vfs.NewMem())
+	conf := walConfig(fs)
+	tree, err := Open(0, conf)
+	assert.Nil(t, err)
+	assert.Nil(t, tree.PutWithOptions([]byte("synced"), []byte("1"), WriteOptions{Sync: true}))
+	assert.Nil(t, tree.Put([]byte("unsynced"), []byte("2")))
+	assert.Nil(t, fs.Crash())
+
+	tree, err = Open(0, conf)
+	assert.Nil(t, err)
+	assertValue(t, tree, "synced", "1")
+	assertMissing(t, tree, "unsynced")
+
+	// 模拟最后一条记录只写入了一部分
+	assert.Nil(t, tree.PutWithOptions([]byte("torn"), []byte("3"), WriteOptions{Sync: true}))
+	logs, err := listLogs(fs, conf.WALDir)
+	assert.Nil(t, err)
+	last := logName(conf.WALDir, logs[len(logs)-1])
+	data, err := readLogFile(fs, last)
+	assert.Nil(t, err)
+	assert.Nil(t, fs.Corrupt(last, int64(len(data)-1)))
+	assert.Nil(t, fs.Crash())
+
+	tree, err = Open(0, conf)
+	assert.Nil(t, err)
+	assertValue(t, tree, "synced", "1")
+	assertMissing(t, tree, "torn")
+	assert.Nil(t, tree.Close())
+}
+
+/* 只有最后一个日志可能没有写完，更早的日志损坏时无法打开 */
+func TestWALCorruptEarlierLog(t *testing.T) {
+	fs := vfs.NewFaultFS(vfs.NewMem())
+	conf := walConfig(fs)
+	// 每次打开都创建新的日志，重放的数据仍留在旧日志中
+	for _, key := range []string{"a", "b"} {
+		tree, err := Open(0, conf)
+		assert.Nil(t, err)
+		assert.Nil(t, tree.Put([]byte(key), []byte("value")))
+		assert.Nil(t, tree.Close())
+	}
+	logs, err := listLogs(fs, conf.WALDir)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 2}, logs)
+	first := logName(conf.WALDir, logs[0])
+	data, err := readLogFile(fs, first)
+	assert.Nil(t, err)
+	assert.Nil(t, fs.Corrupt(first, int64(len(data)-1)))
+
+	_, err = Open(0, conf)
+	assert.True(t, errors.Is(err, ErrCorruption), "%v", err)
+}
+
+/* 切换日志失败时写入失败，不会写入已交给旧的树的日志，恢复后重试切换 */
+func TestWALRotateFailure(t *testing.T) {
+	fs := vfs.NewFaultFS(vfs.NewMem())
+	conf := manifestConfig(fs)
+	tree, err := Open(1, conf)
+	assert.Nil(t, err)
+	// 日志已Sync，切换时只有创建新日志会失败
+	assert.Nil(t, tree.PutWithOptions([]byte("a"), []byte("value"), WriteOptions{Sync: true}))
+	assert.Eventually(t, func() bool {
+		return len(tree.LevelSummary()[0].Files) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	fs.FailWrites(errors.New("disk full"))
+	assert.NotNil(t, tree.Put([]byte("b"), []byte("value")))
+	fs.FailWrites(nil)
+	assert.Nil(t, tree.PutWithOptions([]byte("c"), []byte("value"), WriteOptions{Sync: true}))
+	logs, err := listLogs(fs, conf.WALDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, logs[len(logs)-1])
+	assert.Nil(t, fs.Crash())
+
+	tree, err = Open(0, conf)
+	assert.Nil(t, err)
+	assertValue(t, tree, "a", "value")
+	assertMissing(t, tree, "b")
+	assertValue(t, tree, "c", "value")
+	assert.Nil(t, tree.Close())
+}
+
+/* 读取日志文件的原始内容 */
+func readLogFile(fs vfs.FS, name string) ([]byte, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var buf bytes.Buffer
+	_, err = buf.ReadFrom(f)
+	return buf.Bytes(), err
+}
+
+/* 后台定期Sync日志，不要求Sync的写入在一个周期后也已持久化 */
+func TestWALSyncInterval(t *testing.T) {
+	fs := vfs.NewFaultFS(vfs.NewMem())
+	conf := walConfig(fs)
+	conf.WALSyncInterval = 10 * time.Millisecond
+	tree, err := Open(0, conf)
+	assert.Nil(t, err)
+	assert.Nil(t, tree.Put([]byte("a"), []byte("1")))
+	time.Sleep(100 * time.Millisecond)
+	assert.Nil(t, fs.Crash())
+
+	tree, err = Open(0, conf)
+	assert.Nil(t, err)
+	assertValue(t, tree, "a", "1")
+	assert.Nil(t, tree.Close())
+}
+
+/* flush完成后删除其数据所在的日志文件 */
+func TestWALRemovedAfterFlush(t *testing.T) {
+	fs := vfs.NewMem()
+	conf := walConfig(fs)
+	tree, err := Open(2, conf)
+	assert.Nil(t, err)
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, tree.Put([]byte(fmt.Sprintf("%d", i)), []byte("value")))
+	}
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, 2, len(tree.LevelSummary()[0].Files))
+	logs, err := listLogs(fs, conf.WALDir)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{3}, logs)
+	assert.Nil(t, tree.Close())
+
+	// 只有第5个key需要重放
+	tree, err = Open(0, conf)
+	assert.Nil(t, err)
+	assertValue(t, tree, "4", "value")
+	assertMissing(t, tree, "0")
+	assert.Nil(t, tree.Close())
+}
+
+/* Sync很慢的文件系统 */
+type slowSyncFS struct {
+	vfs.FS
+}
+
+func (fs slowSyncFS) Create(name string) (vfs.File, error) {
+	f, err := fs.FS.Create(name)
+	return slowSyncFile{f}, err
+}
+
+type slowSyncFile struct {
+	vfs.File
+}
+
+func (f slowSyncFile) Sync() error {
+	time.Sleep(time.Millisecond)
+	return f.File.Sync()
+}
+
+/* 并发的Sync写入合并提交，Sync次数远少于写入次数 */
+func TestGroupCommit(t *testing.T) {
+	conf := walConfig(slowSyncFS{vfs.NewMem()})
+	tree, err := Open(0, conf)
+	assert.Nil(t, err)
+	const writers, writes = 16, 50
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < writes; j++ {
+				key := []byte(fmt.Sprintf("%d-%d", i, j))
+				assert.Nil(t, tree.PutWithOptions(key, []byte("value"), WriteOptions{Sync: true}))
+			}
+		}(i)
+	}
+	wg.Wait()
+	s := tree.Statistics().Snapshot()
+	assert.Less(t, s.WALSyncs, int64(writers*writes/2))
+	assert.Less(t, int64(0), s.WALBytesWritten)
+	assert.Nil(t, tree.Close())
+
+	tree, err = Open(0, conf)
+	assert.Nil(t, err)
+	for i := 0; i < writers; i++ {
+		for j := 0; j < writes; j++ {
+			assertValue(t, tree, fmt.Sprintf("%d-%d", i, j), "value")
+		}
+	}
+	assert.Nil(t, tree.Close())
+}
+
+/* 设置KeyProvider时日志按记录加密 */
+func TestWALEncryption(t *testing.T) {
+	fs := vfs.NewMem()
+	conf := walConfig(fs)
+	keys := core.NewMemKeyProvider()
+	keys.Rotate("k1", []byte("0123456789abcdef"))
+	conf.KeyProvider = keys
+	tree, err := Open(0, conf)
+	assert.Nil(t, err)
+	assert.Nil(t, tree.Put([]byte("key"), []byte("secret")))
+	assert.Nil(t, tree.Close())
+
+	logs, err := listLogs(fs, conf.WALDir)
+	assert.Nil(t, err)
+	data, err := readLogFile(fs, logName(conf.WALDir, logs[0]))
+	assert.Nil(t, err)
+	assert.False(t, bytes.Contains(data, []byte("secret")))
+
+	tree, err = Open(0, conf)
+	assert.Nil(t, err)
+	assertValue(t, tree, "key", "secret")
+	assert.Nil(t, tree.Close())
+
+	conf.KeyProvider = nil
+	_, err = Open(0, conf)
+	assert.NotNil(t, err)
+}
+
+/* config.MergeOperator在重放日志之前设置，merge操作数可以在重新打开后重放 */
+func TestWALMergeRoundTrip(t *testing.T) {
+	conf := walConfig(vfs.NewMem())
+	conf.MergeOperator = Int64AddOperator{}
+	tree, err := Open(0, conf)
+	assert.Nil(t, err)
+	assert.Nil(t, tree.Put([]byte("a"), []byte("1")))
+	assert.Nil(t, tree.Merge([]byte("a"), []byte("2")))
+	assert.Nil(t, tree.Merge([]byte("b"), []byte("3")))
+	assert.Nil(t, tree.Close())
+
+	tree, err = Open(0, conf)
+	assert.Nil(t, err)
+	assertValue(t, tree, "a", "3")
+	assertValue(t, tree, "b", "3")
+	assert.Nil(t, tree.Merge([]byte("a"), []byte("4")))
+	assertValue(t, tree, "a", "7")
+	assert.Nil(t, tree.Close())
+
+	// 没有合并操作时无法重放
+	noMerge := *conf
+	noMerge.MergeOperator = nil
+	_, err = Open(0, &noMerge)
+	assert.True(t, errors.Is(err, ErrInvalidArgument))
+}
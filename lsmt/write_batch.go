@@ -0,0 +1,470 @@
+package lsmt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"LSM-Tree/core"
+)
+
+/** 每次写入的持久化方式
+ * 默认写入预写日志但不Sync，进程崩溃不会丢失数据，机器断电可能丢失最近的写入；未设置config.WALDir时没有预写日志，两个选项都被忽略
+ */
+type WriteOptions struct {
+	// 写入日志后Sync，返回时数据已持久化；同时等待的多个写者合并为一次Sync
+	Sync bool
+	// 不写入日志，数据在flush到磁盘文件之前只保存在内存中
+	DisableWAL bool
+}
+
+type batchOpKind byte
+
+const (
+	batchPut batchOpKind = iota + 1
+	batchDelete
+	batchMerge
+	// key为范围的起点，value为终点
+	batchDeleteRange
+)
+
+type batchOp struct {
+	kind     batchOpKind
+	key      []byte
+	value    []byte
+	expireAt int64
+}
+
+/** 一组原子写入的操作，Write时要么全部写入，要么都不写入
+ * 原子性针对持久化：整个WriteBatch是日志中的一条记录，崩溃后重放时要么全部恢复，要么都不恢复
+ * 对并发的读者，AVL树模式下Write返回前读者看不到其中的任何操作；跳表模式下读者不加锁，可能看到只写入了一部分的WriteBatch
+ * 操作按加入的顺序生效，加入时复制key和value，之后修改传入的切片不影响WriteBatch
+ */
+type WriteBatch struct {
+	ops []batchOp
+}
+
+func (b *WriteBatch) Put(key, value []byte) {
+	b.ops = append(b.ops, batchOp{kind: batchPut, key: clone(key), value: clone(value)})
+}
+
+func (b *WriteBatch) Delete(key []byte) {
+	b.ops = append(b.ops, batchOp{kind: batchDelete, key: clone(key)})
+}
+
+func (b *WriteBatch) Merge(key, operand []byte) {
+	b.ops = append(b.ops, batchOp{kind: batchMerge, key: clone(key), value: clone(operand)})
+}
+
+/* 删除[start, end)内的所有key */
+func (b *WriteBatch) DeleteRange(start, end []byte) {
+	b.ops = append(b.ops, batchOp{kind: batchDeleteRange, key: clone(start), value: clone(end)})
+}
+
+/* 操作的个数 */
+func (b *WriteBatch) Len() int {
+	return len(b.ops)
+}
+
+/** 编码为一条日志记录
+ * 格式：uvarint(操作个数)，然后依次是每个操作的类型字节、uvarint(len(key)), key, uvarint(len(value)), value, varint(expireAt)
+ */
+func (b *WriteBatch) encode() []byte {
+	buf := binary.AppendUvarint(nil, uint64(len(b.ops)))
+	for _, op := range b.ops {
+		buf = append(buf, byte(op.kind))
+		buf = binary.AppendUvarint(buf, uint64(len(op.key)))
+		buf = append(buf, op.key...)
+		buf = binary.AppendUvarint(buf, uint64(len(op.value)))
+		buf = append(buf, op.value...)
+		buf = binary.AppendVarint(buf, op.expireAt)
+	}
+	return buf
+}
+
+func decodeWriteBatch(data []byte) (*WriteBatch, error) {
+	bad := fmt.Errorf("%w: malformed write batch", errBadRecord)
+	n, k := binary.Uvarint(data)
+	if k <= 0 {
+		return nil, bad
+	}
+	data = data[k:]
+	readBytes := func() ([]byte, bool) {
+		l, k := binary.Uvarint(data)
+		if k <= 0 || l > uint64(len(data)-k) {
+			return nil, false
+		}
+		b := clone(data[k : k+int(l)])
+		data = data[k+int(l):]
+		return b, true
+	}
+	b := &WriteBatch{}
+	for i := uint64(0); i < n; i++ {
+		if len(data) == 0 {
+			return nil, bad
+		}
+		op := batchOp{kind: batchOpKind(data[0])}
+		if op.kind < batchPut || op.kind > batchDeleteRange {
+			return nil, bad
+		}
+		data = data[1:]
+		var ok bool
+		if op.key, ok = readBytes(); !ok {
+			return nil, bad
+		}
+		if op.value, ok = readBytes(); !ok {
+			return nil, bad
+		}
+		if op.expireAt, k = binary.Varint(data); k <= 0 {
+			return nil, bad
+		}
+		data = data[k:]
+		b.ops = append(b.ops, op)
+	}
+	return b, nil
+}
+
+/* 按opts写入一个键值对 */
+func (t *LSMTree) PutWithOptions(key, value []byte, opts WriteOptions) error {
+	return t.put(key, value, 0, opts)
+}
+
+/* 按opts删除一个key */
+func (t *LSMTree) DeleteWithOptions(key []byte, opts WriteOptions) error {
+	b := &WriteBatch{}
+	b.Delete(key)
+	return t.writeOne(b, opts)
+}
+
+/** 按opts原子地写入b中的所有操作，原子性的范围见WriteBatch
+ * 任何一个操作不合法或merge操作数无法与内存中的树里已有的记录合并时返回该操作的错误，不写入任何操作；只读实例返回ErrReadOnly
+ */
+func (t *LSMTree) Write(b *WriteBatch, opts WriteOptions) error {
+	if t.readOnly {
+		return ErrReadOnly
+	}
+	for _, op := range b.ops {
+		if err := t.validateOp(op); err != nil {
+			return err
+		}
+	}
+	return t.write(b, opts)
+}
+
+/* 写入只有一个操作的b，并按操作类型记录延迟 */
+func (t *LSMTree) writeOne(b *WriteBatch, opts WriteOptions) error {
+	switch b.ops[0].kind {
+	case batchPut:
+		defer t.stats.recordPut(time.Now())
+	case batchDelete:
+		defer t.stats.recordDelete(time.Now())
+	}
+	return t.Write(b, opts)
+}
+
+/* 检查一个操作是否合法，与对应的单个写入方法返回相同的错误 */
+func (t *LSMTree) validateOp(op batchOp) error {
+	switch op.kind {
+	case batchPut:
+		if err := t.validateKey(op.key); err != nil {
+			return err
+		}
+		if err := t.validateValue(op.value); err != nil {
+			return err
+		}
+		if string(op.value) == t.config.DeleteValue {
+			return fmt.Errorf("%w: try another value or use escape characters", ErrReservedValue)
+		}
+	case batchDelete:
+		return t.validateKey(op.key)
+	case batchMerge:
+		if t.mergeOperator == nil {
+			return fmt.Errorf("%w: no merge operator is set", ErrInvalidArgument)
+		}
+		if err := t.validateKey(op.key); err != nil {
+			return err
+		}
+		if err := t.validateValue(op.value); err != nil {
+			return err
+		}
+		if _, err := t.mergeOperator.FullMerge(op.key, nil, [][]byte{op.value}); err != nil {
+			return fmt.Errorf("%w: invalid merge operand %q: %v", ErrInvalidArgument, op.value, err)
+		}
+	case batchDeleteRange:
+		if err := t.validateKey(op.key); err != nil {
+			return err
+		}
+		if err := t.validateKey(op.value); err != nil {
+			return err
+		}
+		if t.cmp.Compare(op.key, op.value) >= 0 {
+			return fmt.Errorf("%w: range start %q must be smaller than end %q", ErrInvalidArgument, op.key, op.value)
+		}
+	}
+	return nil
+}
+
+/** 将一个操作写入内存中的树，调用者需持有rwm的写锁
+ * merge操作数与树中已有的记录合并失败时返回错误，不修改树
+ */
+func (t *LSMTree) apply(op batchOp) error {
+	switch op.kind {
+	case batchPut:
+		t.tracer.Trace(op.key, "Put", "value", op.value, "expireAt", op.expireAt)
+		t.TotalSize += t.tree.AddElement(&core.Element{Key: op.key, Value: op.value, ExpireAt: op.expireAt})
+	case batchDelete:
+		t.tracer.Trace(op.key, "Delete")
+		t.TotalSize += t.tree.AddElement(&core.Element{Key: op.key, Value: []byte(t.config.DeleteValue)})
+	case batchMerge:
+		t.tracer.Trace(op.key, "Merge", "operand", op.value)
+		elem := &core.Element{Key: op.key, Value: op.value, IsMerge: true}
+		if old := t.memtableBase(op.key); old != nil {
+			var err error
+			if elem, err = t.combine(elem, old, t.clock().UnixNano()); err != nil {
+				return err
+			}
+		}
+		t.TotalSize += t.tree.AddElement(elem)
+	case batchDeleteRange:
+		// 内存中的树里已有的key直接写入删除标记，更旧的数据则由写入树中的范围删除标记覆盖
+		t.tracer.Trace(op.key, "DeleteRange", "end", op.value)
+		for _, e := range t.tree.Range(op.key, op.value) {
+			t.tree.AddElement(&core.Element{Key: e.Key, Value: []byte(t.config.DeleteValue)})
+		}
+		t.tree.AddRangeTombstone(op.key, op.value)
+	}
+	return nil
+}
+
+/** 返回merge操作数在内存中的树里要合并的较旧记录，没有时返回nil，操作数原样写入
+ * 更旧的value已被范围删除时，操作数作用在空值上，返回删除标记；调用者需持有rwm
+ */
+func (t *LSMTree) memtableBase(key []byte) *core.Element {
+	if old := t.tree.Get(key); old != nil {
+		return old
+	}
+	if IsCoveredByRangeTombstones(t.cmp, t.tree.RangeTombstones(), key) {
+		return &core.Element{Key: key, Value: []byte(t.config.DeleteValue)}
+	}
+	return nil
+}
+
+/** 检查merge操作时模拟的一层写入，parent为nil时下一层是内存中的树
+ * 每个写者的操作先写入自己的一层，全部合并成功后再并入整组的一层，使后面的写者能看到前面的写者写入的记录
+ */
+type mergeCheck struct {
+	t      *LSMTree
+	parent *mergeCheck
+	elems  map[string]*core.Element
+	ranges []core.RangeTombstone
+}
+
+func (t *LSMTree) newMergeCheck(parent *mergeCheck) *mergeCheck {
+	return &mergeCheck{t: t, parent: parent, elems: make(map[string]*core.Element)}
+}
+
+/* 返回key在这一层及更旧的各层中最新的记录，与memtableBase相同，没有时返回nil */
+func (c *mergeCheck) get(key []byte) *core.Element {
+	if e, ok := c.elems[string(key)]; ok {
+		return e
+	}
+	if IsCoveredByRangeTombstones(c.t.cmp, c.ranges, key) {
+		return &core.Element{Key: key, Value: []byte(c.t.config.DeleteValue)}
+	}
+	if c.parent != nil {
+		return c.parent.get(key)
+	}
+	return c.t.memtableBase(key)
+}
+
+/* 删除这一层中[start, end)内的key，并记录范围删除标记覆盖更旧的层 */
+func (c *mergeCheck) deleteRange(start, end []byte) {
+	r := core.RangeTombstone{Start: start, End: end}
+	for k := range c.elems {
+		if r.Covers(c.t.cmp, []byte(k)) {
+			c.elems[k] = &core.Element{Key: []byte(k), Value: []byte(c.t.config.DeleteValue)}
+		}
+	}
+	c.ranges = append(c.ranges, r)
+}
+
+/* 按apply的方式在这一层中执行一个操作，merge操作数合并失败时返回错误 */
+func (c *mergeCheck) apply(op batchOp, now int64) error {
+	switch op.kind {
+	case batchPut:
+		c.elems[string(op.key)] = &core.Element{Key: op.key, Value: op.value, ExpireAt: op.expireAt}
+	case batchDelete:
+		c.elems[string(op.key)] = &core.Element{Key: op.key, Value: []byte(c.t.config.DeleteValue)}
+	case batchMerge:
+		elem := &core.Element{Key: op.key, Value: op.value, IsMerge: true}
+		if old := c.get(op.key); old != nil {
+			var err error
+			if elem, err = c.t.combine(elem, old, now); err != nil {
+				return err
+			}
+		}
+		c.elems[string(op.key)] = elem
+	case batchDeleteRange:
+		c.deleteRange(op.key, op.value)
+	}
+	return nil
+}
+
+/* 将这一层的写入并入parent，范围删除标记先于这一层写入的key生效 */
+func (c *mergeCheck) mergeInto(parent *mergeCheck) {
+	for _, r := range c.ranges {
+		parent.deleteRange(r.Start, r.End)
+	}
+	for k, e := range c.elems {
+		parent.elems[k] = e
+	}
+}
+
+/** 在写入日志之前检查一组写者中的merge操作数能否与已有的记录合并，返回可以写入的写者
+ * 合并失败的写者记录该错误，不写入日志和内存中的树，较旧的记录保持不变；调用者不能持有rwm
+ */
+func (t *LSMTree) checkMerges(group []*writer) []*writer {
+	hasMerge := false
+	for _, w := range group {
+		for _, op := range w.batch.ops {
+			hasMerge = hasMerge || op.kind == batchMerge
+		}
+	}
+	if !hasMerge {
+		return group
+	}
+	t.rwm.RLock()
+	defer t.rwm.RUnlock()
+	now := t.clock().UnixNano()
+	all := t.newMergeCheck(nil)
+	ok := make([]*writer, 0, len(group))
+	for _, w := range group {
+		c := t.newMergeCheck(all)
+		for _, op := range w.batch.ops {
+			if w.err = c.apply(op, now); w.err != nil {
+				break
+			}
+		}
+		if w.err == nil {
+			c.mergeInto(all)
+			ok = append(ok, w)
+		}
+	}
+	return ok
+}
+
+/* 等待写入的一个WriteBatch */
+type writer struct {
+	batch *WriteBatch
+	opts  WriteOptions
+	done  bool
+	err   error
+}
+
+/** 写入b，b中的操作需已检查过
+ * 写者按到达顺序排队，队首的写者把队列中所有等待的写者合并为一组，依次写入日志，只Sync一次，再按顺序写入内存中的树，然后唤醒组内的其他写者；日志和内存中的树的写入顺序因此总是一致的
+ */
+func (t *LSMTree) write(b *WriteBatch, opts WriteOptions) error {
+	for _, op := range b.ops {
+		t.stats.recordBytesWritten(len(op.key) + len(op.value))
+	}
+	t.beforeWrite()
+	w := &writer{batch: b, opts: opts}
+	t.writeMu.Lock()
+	t.writers = append(t.writers, w)
+	for !w.done && t.writers[0] != w {
+		t.writeCond.Wait()
+	}
+	if w.done {
+		t.writeMu.Unlock()
+		return w.err
+	}
+	group := append([]*writer{}, t.writers...)
+	t.writeMu.Unlock()
+
+	err := t.commit(group)
+
+	t.writeMu.Lock()
+	t.writers = t.writers[len(group):]
+	for _, g := range group {
+		// 检查merge时已失败的写者保留自己的错误
+		g.done = true
+		if g.err == nil {
+			g.err = err
+		}
+	}
+	t.writeCond.Broadcast()
+	t.writeMu.Unlock()
+	return w.err
+}
+
+/** 切换toFlush要求切换的日志文件，由队首的写者在写入日志前调用，期间没有其他写者写入日志
+ * 新的树记录的日志编号已是切换后的编号，切换失败时不能写入旧日志，本组写入失败，下一组写入时重试
+ */
+func (t *LSMTree) rotateLogIfNeeded() error {
+	if t.wal == nil {
+		return nil
+	}
+	t.rwm.RLock()
+	rotate := t.rotateLog
+	t.rwm.RUnlock()
+	if !rotate {
+		return nil
+	}
+	num, err := t.wal.rotate()
+	if err != nil {
+		t.logger.Error("failed to switch log", "err", err)
+		return fmt.Errorf("switch log: %w", err)
+	}
+	t.rwm.Lock()
+	// 切换期间的toFlush没有再增加nextLog，切换后的日志就是nextLog
+	t.rotateLog = false
+	t.rwm.Unlock()
+	t.logger.Debug("switched log", "log", num)
+	return nil
+}
+
+/** 将一组写者的数据写入日志和内存中的树，同一时刻只有一个队首的写者调用
+ * merge操作数无法合并的写者被跳过，错误记录在该写者中
+ */
+func (t *LSMTree) commit(group []*writer) error {
+	logNum := -1
+	if err := t.rotateLogIfNeeded(); err != nil {
+		return err
+	}
+	if group = t.checkMerges(group); len(group) == 0 {
+		return nil
+	}
+	if t.wal != nil {
+		var records [][]byte
+		sync := false
+		for _, w := range group {
+			if !w.opts.DisableWAL {
+				records = append(records, w.batch.encode())
+				sync = sync || w.opts.Sync
+			}
+		}
+		if len(records) > 0 {
+			var err error
+			if logNum, err = t.wal.write(records, sync); err != nil {
+				return err
+			}
+		}
+	}
+	t.rwm.Lock()
+	defer t.rwm.Unlock()
+	if logNum >= 0 && logNum < t.memLogs[t.tree] {
+		// 写入日志后日志切换过，这些数据在更早的日志文件中
+		t.memLogs[t.tree] = logNum
+	}
+	for _, w := range group {
+		for _, op := range w.batch.ops {
+			// 队首的写者之外没有人写入内存中的树，checkMerges之后树只可能被切换为空树，合并不会再失败
+			if err := t.apply(op); err != nil {
+				return err
+			}
+		}
+	}
+	t.afterWrite()
+	return nil
+}
@@ -0,0 +1,228 @@
+package lsmt
+
+import (
+	"sync"
+	"time"
+)
+
+/** 多个LSMTree共享的内存预算
+ * 统计所有共享该预算的树中内存中的树（包括正在flush的树）占用的字节数，以及缓存通过ReserveCache登记的字节数
+ * 写入前检查预算：可变的树占用过多时flush其中最大的一棵；总用量超过预算且还有树正在flush时，若allowStall为true，则阻塞写者直到flush释放出内存
+ */
+type WriteBufferManager struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	// 内存预算，单位是字节，0表示不限制
+	bufferSize int
+	// 总用量超过预算时是否阻塞写者
+	allowStall bool
+	// 每棵树当前可变的内存中的树占用的字节数
+	mutable      map[*LSMTree]int
+	mutableTotal int
+	// 正在flush的树占用的字节数
+	immutable int
+	// 缓存登记的字节数
+	cache int
+	// 当前是否有写者被阻塞，状态变化时通知所有树的EventListener
+	stalled bool
+}
+
+/* 创建一个预算为bufferSize字节的WriteBufferManager */
+func NewWriteBufferManager(bufferSize int, allowStall bool) *WriteBufferManager {
+	m := &WriteBufferManager{
+		bufferSize: bufferSize,
+		allowStall: allowStall,
+		mutable:    make(map[*LSMTree]int),
+	}
+	m.cond = sync.NewCond(&m.mu)
+	return m
+}
+
+/* 让LSMTree使用共享的内存预算，需在读写之前调用，Close时自动注销 */
+func (t *LSMTree) SetWriteBufferManager(m *WriteBufferManager) {
+	t.wbm = m
+	m.mu.Lock()
+	m.mutable[t] = 0
+	m.mu.Unlock()
+}
+
+func (m *WriteBufferManager) BufferSize() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.bufferSize
+}
+
+/* 修改内存预算，被阻塞的写者会重新检查 */
+func (m *WriteBufferManager) SetBufferSize(bufferSize int) {
+	m.mu.Lock()
+	m.bufferSize = bufferSize
+	m.mu.Unlock()
+	m.wakeStalled()
+}
+
+/* 所有内存中的树和缓存占用的字节数 */
+func (m *WriteBufferManager) MemoryUsage() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.memoryUsage()
+}
+
+/* 可变的内存中的树占用的字节数，不包括正在flush的树和缓存 */
+func (m *WriteBufferManager) MutableMemtableMemoryUsage() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mutableTotal
+}
+
+/* 缓存分配内存后登记占用的字节数，登记的内存计入预算 */
+func (m *WriteBufferManager) ReserveCache(n int) {
+	m.mu.Lock()
+	m.cache += n
+	m.mu.Unlock()
+}
+
+/* 缓存释放内存后注销占用的字节数 */
+func (m *WriteBufferManager) ReleaseCache(n int) {
+	m.mu.Lock()
+	m.cache -= n
+	m.mu.Unlock()
+	m.wakeStalled()
+}
+
+func (m *WriteBufferManager) memoryUsage() int {
+	return m.mutableTotal + m.immutable + m.cache
+}
+
+/** 判断是否需要flush可变的树，调用者需持有mu
+ * 可变的树超过预算的7/8，或总用量超过预算且可变的树超过预算的一半时需要flush，后一个条件避免正在flush的树和缓存占满预算时反复flush很小的树
+ */
+func (m *WriteBufferManager) shouldFlush() bool {
+	if m.bufferSize <= 0 {
+		return false
+	}
+	if m.mutableTotal >= m.bufferSize/8*7 {
+		return true
+	}
+	return m.memoryUsage() >= m.bufferSize && m.mutableTotal >= m.bufferSize/2
+}
+
+/* 判断写者是否需要等待，只有还有树正在flush时等待才有意义，调用者需持有mu */
+func (m *WriteBufferManager) shouldStall() bool {
+	return m.allowStall && m.bufferSize > 0 && m.memoryUsage() >= m.bufferSize && m.immutable > 0
+}
+
+/** 写入前由树t调用，调用者不能持有任何树的锁
+ * 需要flush时flush可变的树中最大的一棵，然后在需要时阻塞直到flush释放出内存，返回被阻塞的时长
+ */
+func (m *WriteBufferManager) beforeWrite(t *LSMTree) time.Duration {
+	m.mu.Lock()
+	var victim *LSMTree
+	if m.shouldFlush() {
+		largest := 0
+		for t, usage := range m.mutable {
+			if usage > largest {
+				victim, largest = t, usage
+			}
+		}
+	}
+	m.mu.Unlock()
+	if victim != nil {
+		victim.flushForWriteBuffer()
+	}
+
+	m.mu.Lock()
+	if !m.shouldStall() {
+		m.mu.Unlock()
+		return 0
+	}
+	t.logger.Warn("write stalled by WriteBufferManager", "usage", m.memoryUsage(), "bufferSize", m.bufferSize)
+	if !m.stalled {
+		m.stalled = true
+		info, trees := m.stallCondition()
+		m.mu.Unlock()
+		notifyStallConditionChanged(trees, info)
+		m.mu.Lock()
+	}
+	start := time.Now()
+	for m.shouldStall() {
+		m.cond.Wait()
+	}
+	m.mu.Unlock()
+	return time.Since(start)
+}
+
+/* 内存被释放后唤醒被阻塞的写者，不再需要阻塞时通知所有树的EventListener */
+func (m *WriteBufferManager) wakeStalled() {
+	m.mu.Lock()
+	var trees []*LSMTree
+	var info StallConditionInfo
+	if m.stalled && !m.shouldStall() {
+		m.stalled = false
+		info, trees = m.stallCondition()
+	}
+	m.mu.Unlock()
+	m.cond.Broadcast()
+	notifyStallConditionChanged(trees, info)
+}
+
+/* 返回当前的阻塞状态和共享预算的所有树，调用者需持有mu */
+func (m *WriteBufferManager) stallCondition() (StallConditionInfo, []*LSMTree) {
+	trees := make([]*LSMTree, 0, len(m.mutable))
+	for t := range m.mutable {
+		trees = append(trees, t)
+	}
+	return StallConditionInfo{Stalled: m.stalled, MemoryUsage: m.memoryUsage(), BufferSize: m.bufferSize}, trees
+}
+
+func notifyStallConditionChanged(trees []*LSMTree, info StallConditionInfo) {
+	for _, t := range trees {
+		t.notify(func(l EventListener) { l.OnStallConditionChanged(info) })
+	}
+}
+
+/* 更新一棵树的可变的树占用的字节数，调用者需持有该树rwm的写锁 */
+func (m *WriteBufferManager) setMutable(t *LSMTree, usage int) {
+	m.mu.Lock()
+	m.mutableTotal += usage - m.mutable[t]
+	m.mutable[t] = usage
+	m.mu.Unlock()
+}
+
+/* 一棵树的可变的树开始flush，调用者需持有该树rwm的写锁 */
+func (m *WriteBufferManager) markImmutable(t *LSMTree, usage int) {
+	m.mu.Lock()
+	m.mutableTotal -= m.mutable[t]
+	m.mutable[t] = 0
+	m.immutable += usage
+	m.mu.Unlock()
+}
+
+/* flush完成或失败，释放被flush的树占用的字节数 */
+func (m *WriteBufferManager) freeImmutable(usage int) {
+	m.mu.Lock()
+	m.immutable -= usage
+	m.mu.Unlock()
+	m.wakeStalled()
+}
+
+/* 树关闭后不再共享预算，释放它的可变的树占用的字节数，正在flush的树已在flush结束时释放 */
+func (m *WriteBufferManager) unregister(t *LSMTree) {
+	m.mu.Lock()
+	m.mutableTotal -= m.mutable[t]
+	delete(m.mutable, t)
+	m.mu.Unlock()
+	m.wakeStalled()
+}
+
+/* 由WriteBufferManager触发的flush，加锁后再次确认仍需flush，避免多个写者重复flush同一棵树 */
+func (t *LSMTree) flushForWriteBuffer() {
+	t.rwm.Lock()
+	defer t.rwm.Unlock()
+	t.wbm.mu.Lock()
+	need := t.wbm.shouldFlush()
+	t.wbm.mu.Unlock()
+	if need && t.tree.Size() > 0 {
+		t.logger.Info("WriteBufferManager triggers flush", "memUsage", t.tree.ApproximateMemoryUsage())
+		t.toFlush()
+	}
+}
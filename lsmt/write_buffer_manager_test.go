@@ -0,0 +1,155 @@
+package lsmt
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"LSM-Tree/config"
+	"LSM-Tree/vfs"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func wbmTree(m *WriteBufferManager) *LSMTree {
+	conf := testConfig(func(c *config.Config) {
+		// 单棵树的上限足够大，只由共享的预算触发flush
+		c.WriteBufferSize = 1 << 30
+	})
+	tree := NewLSMTreeWithConfig(0, conf)
+	tree.SetWriteBufferManager(m)
+	return tree
+}
+
+/* 多棵树共享预算，超出预算时flush最大的一棵 */
+func TestWriteBufferManagerFlushLargest(t *testing.T) {
+	m := NewWriteBufferManager(64<<10, false)
+	a, b := wbmTree(m), wbmTree(m)
+	val := make([]byte, 1<<10)
+	na, nb := 0, 0
+	for ; a.tree.ApproximateMemoryUsage() < 32<<10; na++ {
+		assert.Nil(t, a.Put([]byte(fmt.Sprintf("a%d", na)), val))
+	}
+	for ; m.MutableMemtableMemoryUsage() < 56<<10; nb++ {
+		assert.Nil(t, b.Put([]byte(fmt.Sprintf("b%d", nb)), val))
+	}
+	assert.Equal(t, a.tree.ApproximateMemoryUsage()+b.tree.ApproximateMemoryUsage(), m.MutableMemtableMemoryUsage())
+
+	// 可变的树超过预算的7/8，下一次写入前flush最大的a
+	assert.Nil(t, b.Put([]byte("b"), val))
+	assert.Equal(t, 0, a.tree.Size())
+	assert.Equal(t, nb+1, b.tree.Size())
+	time.Sleep(200 * time.Millisecond)
+	a.drwm.RLock()
+	assert.Equal(t, 1, len(a.LevelSummary()[0].Files))
+	a.drwm.RUnlock()
+	assert.Equal(t, b.tree.ApproximateMemoryUsage(), m.MemoryUsage())
+	for i := 0; i < na; i++ {
+		_, err := a.Get([]byte(fmt.Sprintf("a%d", i)))
+		assert.Nil(t, err)
+	}
+}
+
+/* 缓存登记的内存计入预算 */
+func TestWriteBufferManagerCache(t *testing.T) {
+	m := NewWriteBufferManager(64<<10, false)
+	tree := wbmTree(m)
+	m.ReserveCache(40 << 10)
+	assert.Equal(t, 40<<10, m.MemoryUsage())
+	val := make([]byte, 1<<10)
+	for i := 0; tree.tree.ApproximateMemoryUsage() < 32<<10; i++ {
+		assert.Nil(t, tree.Put([]byte(fmt.Sprintf("%d", i)), val))
+	}
+	// 总用量超过预算且可变的树超过预算的一半
+	assert.Nil(t, tree.Put([]byte("last"), val))
+	assert.Equal(t, 1, tree.tree.Size())
+	m.ReleaseCache(40 << 10)
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, tree.tree.ApproximateMemoryUsage(), m.MemoryUsage())
+}
+
+/* flush跟不上时写者被阻塞，flush完成后恢复 */
+func TestWriteBufferManagerStall(t *testing.T) {
+	m := NewWriteBufferManager(1<<10, true)
+	tree := wbmTree(m)
+	// 模拟一棵正在flush的树占满了预算
+	m.markImmutable(tree, 2<<10)
+
+	done := make(chan struct{})
+	go func() {
+		tree.Put([]byte("k"), []byte("v"))
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("write should be stalled")
+	case <-time.After(100 * time.Millisecond):
+	}
+	m.freeImmutable(2 << 10)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("write should be resumed")
+	}
+	val, err := tree.Get([]byte("k"))
+	assert.Nil(t, err)
+	assert.Equal(t, "v", string(val))
+	assert.Less(t, 50*time.Millisecond, tree.Statistics().Snapshot().StallTime)
+
+	// 只有缓存占满预算时不阻塞写者
+	m.ReserveCache(2 << 10)
+	assert.Nil(t, tree.Delete([]byte("k")))
+}
+
+/* flush失败时释放被flush的树占用的字节数，写者不会一直等待无法完成的flush */
+func TestWriteBufferManagerFlushFailure(t *testing.T) {
+	fs := vfs.NewFaultFS(vfs.NewMem())
+	assert.Nil(t, fs.MkdirAll("/db"))
+	conf := testConfig(func(c *config.Config) {
+		c.WriteBufferSize = 1 << 30
+		c.FS = fs
+		c.MmapDir = "/db"
+	})
+	tree := NewLSMTreeWithConfig(0, conf)
+	tree.flushRetryDelay = 10 * time.Millisecond
+	m := NewWriteBufferManager(16<<10, true)
+	tree.SetWriteBufferManager(m)
+	fs.FailWrites(errors.New("disk full"))
+
+	done := make(chan struct{})
+	go func() {
+		val := make([]byte, 1<<10)
+		for i := 0; i < 64; i++ {
+			tree.Put([]byte(fmt.Sprintf("%d", i)), val)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("writes should not stall after a failed flush")
+	}
+	assert.Equal(t, m.MutableMemtableMemoryUsage(), m.MemoryUsage())
+	for i := 0; i < 64; i++ {
+		_, err := tree.Get([]byte(fmt.Sprintf("%d", i)))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, tree.Close())
+}
+
+/* 关闭的树不再共享预算 */
+func TestWriteBufferManagerClose(t *testing.T) {
+	m := NewWriteBufferManager(64<<10, false)
+	a, b := wbmTree(m), wbmTree(m)
+	assert.Nil(t, a.Put([]byte("a"), []byte("value")))
+	assert.Nil(t, b.Put([]byte("b"), []byte("value")))
+	assert.Nil(t, a.Close())
+	assert.Equal(t, b.tree.ApproximateMemoryUsage(), m.MemoryUsage())
+	m.mu.Lock()
+	_, trees := m.stallCondition()
+	m.mu.Unlock()
+	assert.Equal(t, []*LSMTree{b}, trees)
+	assert.Nil(t, b.Close())
+	assert.Equal(t, 0, m.MemoryUsage())
+}
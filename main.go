@@ -1,17 +1,33 @@
 package main
 
 import (
-	log "LSM-Tree/log"
+	"LSM-Tree/config"
 	"LSM-Tree/lsmt"
 	"fmt"
 	"math/rand"
 	"time"
+
+	log15 "github.com/inconshreveable/log15"
 )
 
+/* 将日志写入当前目录下的logfile.log */
+func newFileLogger() log15.Logger {
+	handler, err := log15.FileHandler("logfile.log", log15.LogfmtFormat())
+	if err != nil {
+		panic(err)
+	}
+	logger := log15.New()
+	logger.SetHandler(log15.CallerFileHandler(handler))
+	return logger
+}
+
 func main() {
 	elems := lsmt.GenerateData(1000000)
 
-	lsmTree := lsmt.NewLSMTree(0)
+	logger := newFileLogger()
+	conf := *config.DefaultConfig()
+	conf.Logger = logger
+	lsmTree := lsmt.NewLSMTreeWithConfig(0, &conf)
 
 	block_size := 10000
 	index := 0
@@ -33,16 +49,16 @@ func main() {
 	lsmTree.Log_file_info()
 
 	fmt.Printf("Get==1\n")
-	log.Logger.Debug("Get==1")
+	logger.Debug("Get==1")
 	keys := make([]string, 0)
 	for i := 0; i < 10; i++ {
 		key := fmt.Sprintf("key%d", rand.Intn(1000))
 		keys = append(keys, key)
-		val, err := lsmTree.Get(key)
+		val, err := lsmTree.Get([]byte(key))
 		if err != nil {
 			panic(err)
 		} else {
-			fmt.Printf("search key %v, got value %v\n", key, val)
+			fmt.Printf("search key %v, got value %s\n", key, val)
 		}
 		time.Sleep(500 * time.Millisecond)
 	}
@@ -51,19 +67,19 @@ func main() {
 
 	for i := 0; i < 100000; i++ {
 		key := fmt.Sprintf("key%d", i*10)
-		lsmTree.Delete(key)
+		lsmTree.Delete([]byte(key))
 	}
 	lsmTree.Log_file_info()
 
 	fmt.Printf("Get==2\n")
-	log.Logger.Debug("Get==2")
+	logger.Debug("Get==2")
 	for i := 0; i < 10; i++ {
 		key := keys[i]
-		val, err := lsmTree.Get(key)
+		val, err := lsmTree.Get([]byte(key))
 		if err != nil {
 			fmt.Printf("%v\n", err)
 		} else {
-			fmt.Printf("search key %v, got value %v\n", key, val)
+			fmt.Printf("search key %v, got value %s\n", key, val)
 		}
 		// time.Sleep(500 * time.Millisecond)
 	}
@@ -71,14 +87,14 @@ func main() {
 	time.Sleep(7 * time.Second)
 	lsmTree.Log_file_info()
 	fmt.Printf("Get==3\n")
-	log.Logger.Debug("Get==3")
+	logger.Debug("Get==3")
 	for i := 0; i < 10; i++ {
 		key := keys[i]
-		val, err := lsmTree.Get(key)
+		val, err := lsmTree.Get([]byte(key))
 		if err != nil {
 			fmt.Printf("%v\n", err)
 		} else {
-			fmt.Printf("search key %v, got value %v\n", key, val)
+			fmt.Printf("search key %v, got value %s\n", key, val)
 		}
 		time.Sleep(500 * time.Millisecond)
 	}
@@ -87,19 +103,19 @@ func main() {
 
 	for i := 0; i < 100000; i++ {
 		key := fmt.Sprintf("key%d", i*10+7)
-		lsmTree.Put(key, "updated-"+fmt.Sprintf("value%d", i*10+7))
+		lsmTree.Put([]byte(key), []byte("updated-"+fmt.Sprintf("value%d", i*10+7)))
 	}
 	lsmTree.Log_file_info()
 
 	fmt.Printf("Get==4\n")
-	log.Logger.Debug("Get==4")
+	logger.Debug("Get==4")
 	for i := 0; i < 10; i++ {
 		key := keys[i]
-		val, err := lsmTree.Get(key)
+		val, err := lsmTree.Get([]byte(key))
 		if err != nil {
 			fmt.Printf("%v\n", err)
 		} else {
-			fmt.Printf("search key %v, got value %v\n", key, val)
+			fmt.Printf("search key %v, got value %s\n", key, val)
 		}
 		// time.Sleep(500 * time.Millisecond)
 	}
@@ -107,23 +123,23 @@ func main() {
 	time.Sleep(7 * time.Second)
 	lsmTree.Log_file_info()
 	fmt.Printf("Get==5\n")
-	log.Logger.Debug("Get==5")
+	logger.Debug("Get==5")
 	for i := 0; i < 10; i++ {
 		key := keys[i]
-		val, err := lsmTree.Get(key)
+		val, err := lsmTree.Get([]byte(key))
 		if err != nil {
 			fmt.Printf("%v\n", err)
 		} else {
-			fmt.Printf("search key %v, got value %v\n", key, val)
+			fmt.Printf("search key %v, got value %s\n", key, val)
 		}
 		time.Sleep(500 * time.Millisecond)
 	}
 
-	val, err := lsmTree.Get("key1000001")
+	val, err := lsmTree.Get([]byte("key1000001"))
 	if err != nil {
 		fmt.Printf("%v\n", err)
 	} else {
-		fmt.Printf("search key %v, got value %v\n", "key1000001", val)
+		fmt.Printf("search key %v, got value %s\n", "key1000001", val)
 	}
 
 }
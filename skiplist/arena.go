@@ -0,0 +1,44 @@
+package skiplist
+
+/* 每块内存的默认大小 */
+const defaultChunkSize = 1 << 20
+
+/** 只追加的内存分配器，跳表中所有节点的key和value都复制到arena中
+ * 已分配出去的内存不会被移动或复用，因此读者持有的切片始终有效；整张跳表被丢弃时，所有内存随arena一起被回收
+ * arena不是并发安全的，只能由写者调用
+ */
+type arena struct {
+	chunks [][]byte
+	cur    []byte
+	// 已分配出去的字节数
+	used int
+}
+
+/* 从arena中分配n个字节 */
+func (a *arena) alloc(n int) []byte {
+	if n > len(a.cur) {
+		size := defaultChunkSize
+		if n > size {
+			// 超大的key或value单独占用一块内存
+			size = n
+		}
+		a.cur = make([]byte, size)
+		a.chunks = append(a.chunks, a.cur)
+	}
+	b := a.cur[:n:n]
+	a.cur = a.cur[n:]
+	a.used += n
+	return b
+}
+
+/* 将b复制到arena中 */
+func (a *arena) copy(b []byte) []byte {
+	res := a.alloc(len(b))
+	copy(res, b)
+	return res
+}
+
+/* 已分配出去的字节数 */
+func (a *arena) size() int {
+	return a.used
+}
@@ -0,0 +1,209 @@
+package skiplist
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"unsafe"
+
+	"LSM-Tree/core"
+)
+
+const (
+	maxHeight = 12
+	// 每升高一层的概率为 1/branching
+	branching = 4
+)
+
+var (
+	nodeOverhead  = int64(unsafe.Sizeof(node{}))
+	entryOverhead = int64(unsafe.Sizeof(entry{}))
+)
+
+/** 基于arena的并发跳表
+ * 同一时刻只允许一个写者（由调用者保证写者之间互斥），读者无需加锁，也不会被写者阻塞
+ * 写者插入节点时先设置好新节点的后继指针，再自底向上原子地发布到各层，读者看到的始终是一个合法的链表；更新已有key时原子地替换节点的entry，读者看到的是更新前或更新后的完整记录
+ */
+type SkipList struct {
+	head   *node
+	height int32
+	size   int64
+	/* 跳表占用的近似字节数，包括arena和所有节点、entry的开销，读者可并发读取 */
+	memUsage int64
+	arena    arena
+	rnd      *rand.Rand
+	cmp      core.Comparator
+	/* 范围删除标记，只作用于比本表更旧的数据，以写时复制的方式更新 */
+	rangeDels atomic.Value
+}
+
+type node struct {
+	key   []byte
+	entry unsafe.Pointer // *entry
+	tower [maxHeight]unsafe.Pointer
+}
+
+/* 节点中key对应的记录，每次更新都替换成新的entry，不原地修改 */
+type entry struct {
+	value    []byte
+	expireAt int64
+	isMerge  bool
+}
+
+/* 创建一个按cmp排序的跳表，cmp为nil时按字节序 */
+func NewSkipList(cmp core.Comparator) *SkipList {
+	if cmp == nil {
+		cmp = core.BytewiseComparator
+	}
+	s := &SkipList{
+		head:   &node{},
+		height: 1,
+		rnd:    rand.New(rand.NewSource(rand.Int63())),
+		cmp:    cmp,
+	}
+	s.rangeDels.Store([]core.RangeTombstone{})
+	return s
+}
+
+func (s *SkipList) Comparator() core.Comparator {
+	return s.cmp
+}
+
+func (n *node) next(level int) *node {
+	return (*node)(atomic.LoadPointer(&n.tower[level]))
+}
+
+func (n *node) setNext(level int, next *node) {
+	atomic.StorePointer(&n.tower[level], unsafe.Pointer(next))
+}
+
+func (n *node) load() *entry {
+	return (*entry)(atomic.LoadPointer(&n.entry))
+}
+
+func (s *SkipList) randomHeight() int {
+	h := 1
+	for h < maxHeight && s.rnd.Intn(branching) == 0 {
+		h++
+	}
+	return h
+}
+
+/** 查找第一个key大于等于参数key的节点，prev不为nil时记录每一层的前驱节点
+ * 若查找不到满足的节点，则返回nil
+ */
+func (s *SkipList) findGreaterOrEqual(key []byte, prev *[maxHeight]*node) *node {
+	x := s.head
+	level := int(atomic.LoadInt32(&s.height)) - 1
+	for {
+		next := x.next(level)
+		if next != nil && s.cmp.Compare(next.key, key) < 0 {
+			x = next
+			continue
+		}
+		if prev != nil {
+			prev[level] = x
+		}
+		if level == 0 {
+			return next
+		}
+		level--
+	}
+}
+
+/** 插入或更新一个元素，key和value会被复制到arena中
+ * 插入成功返回1，更新成功返回0
+ */
+func (s *SkipList) AddElement(e *core.Element) int {
+	ent := &entry{value: s.arena.copy(e.Value), expireAt: e.ExpireAt, isMerge: e.IsMerge}
+	var prev [maxHeight]*node
+	x := s.findGreaterOrEqual(e.Key, &prev)
+	if x != nil && s.cmp.Compare(x.key, e.Key) == 0 {
+		// 旧的entry和value仍留在arena中，不计入回收
+		atomic.StorePointer(&x.entry, unsafe.Pointer(ent))
+		atomic.AddInt64(&s.memUsage, int64(len(e.Value))+entryOverhead)
+		return 0
+	}
+
+	h := s.randomHeight()
+	if cur := int(atomic.LoadInt32(&s.height)); h > cur {
+		for i := cur; i < h; i++ {
+			prev[i] = s.head
+		}
+		// 读者可能先看到新的高度，此时新层中头节点的后继为nil，不影响查找结果
+		atomic.StoreInt32(&s.height, int32(h))
+	}
+	n := &node{key: s.arena.copy(e.Key), entry: unsafe.Pointer(ent)}
+	for i := 0; i < h; i++ {
+		// 先设置新节点的后继，再发布新节点
+		n.tower[i] = unsafe.Pointer(prev[i].next(i))
+		prev[i].setNext(i, n)
+	}
+	atomic.AddInt64(&s.size, 1)
+	atomic.AddInt64(&s.memUsage, int64(len(e.Key)+len(e.Value))+nodeOverhead+entryOverhead)
+	return 1
+}
+
+/* 查找key对应的元素，查找不到时返回nil */
+func (s *SkipList) Get(key []byte) *core.Element {
+	x := s.findGreaterOrEqual(key, nil)
+	if x == nil || s.cmp.Compare(x.key, key) != 0 {
+		return nil
+	}
+	return x.element()
+}
+
+func (n *node) element() *core.Element {
+	ent := n.load()
+	return &core.Element{
+		Key:      n.key,
+		Value:    ent.value,
+		ExpireAt: ent.expireAt,
+		IsMerge:  ent.isMerge,
+	}
+}
+
+/* 按顺序返回key在[start, end)内的所有元素 */
+func (s *SkipList) Range(start, end []byte) []*core.Element {
+	elems := make([]*core.Element, 0)
+	for x := s.findGreaterOrEqual(start, nil); x != nil && s.cmp.Compare(x.key, end) < 0; x = x.next(0) {
+		elems = append(elems, x.element())
+	}
+	return elems
+}
+
+/* 按顺序返回所有元素 */
+func (s *SkipList) Inorder() []*core.Element {
+	elems := make([]*core.Element, 0, s.Size())
+	for x := s.head.next(0); x != nil; x = x.next(0) {
+		elems = append(elems, x.element())
+	}
+	return elems
+}
+
+/* 记录一个范围删除标记，表中已有的key不受影响 */
+func (s *SkipList) AddRangeTombstone(start, end []byte) {
+	old := s.RangeTombstones()
+	dels := make([]core.RangeTombstone, len(old), len(old)+1)
+	copy(dels, old)
+	dels = append(dels, core.RangeTombstone{Start: s.arena.copy(start), End: s.arena.copy(end)})
+	s.rangeDels.Store(dels)
+	atomic.AddInt64(&s.memUsage, int64(len(start)+len(end)))
+}
+
+func (s *SkipList) RangeTombstones() []core.RangeTombstone {
+	return s.rangeDels.Load().([]core.RangeTombstone)
+}
+
+func (s *SkipList) Size() int {
+	return int(atomic.LoadInt64(&s.size))
+}
+
+/* 跳表占用的近似字节数，可与写者并发调用 */
+func (s *SkipList) ApproximateMemoryUsage() int {
+	return int(atomic.LoadInt64(&s.memUsage))
+}
+
+/* arena中已分配的字节数，即所有key和value占用的内存 */
+func (s *SkipList) ArenaSize() int {
+	return s.arena.size()
+}
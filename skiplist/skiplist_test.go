@@ -0,0 +1,117 @@
+package skiplist
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+
+	"LSM-Tree/core"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSkipListBasic(t *testing.T) {
+	s := NewSkipList(nil)
+	m := make(map[string]string)
+	for i := 0; i < 10000; i++ {
+		k := fmt.Sprintf("%d", rand.Intn(2000))
+		v := fmt.Sprintf("%d", rand.Int())
+		isAdd := s.AddElement(&core.Element{Key: []byte(k), Value: []byte(v)})
+		_, ok := m[k]
+		assert.Equal(t, !ok, isAdd == 1)
+		m[k] = v
+	}
+	assert.Equal(t, len(m), s.Size())
+	for k, v := range m {
+		e := s.Get([]byte(k))
+		if assert.NotNil(t, e) {
+			assert.Equal(t, v, string(e.Value))
+		}
+	}
+	assert.Nil(t, s.Get([]byte("not exist")))
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	got := make([]string, 0, len(m))
+	for _, e := range s.Inorder() {
+		got = append(got, string(e.Key))
+	}
+	assert.Equal(t, keys, got)
+}
+
+func TestSkipListFields(t *testing.T) {
+	s := NewSkipList(core.BytewiseComparator)
+	s.AddElement(&core.Element{Key: []byte("b"), Value: []byte("1"), ExpireAt: 100})
+	s.AddElement(&core.Element{Key: []byte("a"), Value: []byte("2"), IsMerge: true})
+	s.AddElement(&core.Element{Key: []byte{}, Value: []byte("empty")})
+	assert.Equal(t, &core.Element{Key: []byte("b"), Value: []byte("1"), ExpireAt: 100}, s.Get([]byte("b")))
+
+	// 更新时替换整条记录
+	assert.Equal(t, 0, s.AddElement(&core.Element{Key: []byte("b"), Value: []byte("3")}))
+	assert.Equal(t, &core.Element{Key: []byte("b"), Value: []byte("3")}, s.Get([]byte("b")))
+	assert.Equal(t, true, s.Get([]byte("a")).IsMerge)
+	assert.Equal(t, "empty", string(s.Get(nil).Value))
+
+	elems := s.Range([]byte{}, []byte("b"))
+	assert.Equal(t, 2, len(elems))
+	assert.Equal(t, "a", string(elems[1].Key))
+
+	s.AddRangeTombstone([]byte("c"), []byte("d"))
+	assert.Equal(t, []core.RangeTombstone{{Start: []byte("c"), End: []byte("d")}}, s.RangeTombstones())
+	assert.Less(t, 0, s.ArenaSize())
+	assert.Less(t, s.ArenaSize(), s.ApproximateMemoryUsage())
+
+	// 更新不回收旧的value，占用的内存只增不减
+	before := s.ApproximateMemoryUsage()
+	s.AddElement(&core.Element{Key: []byte("b"), Value: []byte("4")})
+	assert.Less(t, before, s.ApproximateMemoryUsage())
+}
+
+/* 一个写者和多个读者并发访问，读者始终能读到已写入的key */
+func TestSkipListConcurrentReaders(t *testing.T) {
+	s := NewSkipList(nil)
+	const total = 20000
+	var written int64
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				mu.Lock()
+				n := written
+				mu.Unlock()
+				if n == 0 {
+					continue
+				}
+				k := fmt.Sprintf("%08d", rand.Int63n(n))
+				if e := s.Get([]byte(k)); e == nil || string(e.Value) != k {
+					t.Errorf("key %s not found", k)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < total; i++ {
+		k := []byte(fmt.Sprintf("%08d", i))
+		s.AddElement(&core.Element{Key: k, Value: k})
+		mu.Lock()
+		written = int64(i + 1)
+		mu.Unlock()
+	}
+	close(done)
+	wg.Wait()
+	assert.Equal(t, total, s.Size())
+}
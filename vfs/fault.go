@@ -0,0 +1,246 @@
+package vfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sync"
+)
+
+/* 模拟崩溃之前打开的文件在崩溃后的读写都返回该错误 */
+var ErrCrashed = errors.New("vfs: file system crashed")
+
+/** 在另一个FS上注入故障的FS，用于测试恢复逻辑，可被多个线程并发调用
+ * FailWrites使之后的写入失败；Crash模拟断电，丢弃所有未Sync的数据；Corrupt修改文件中的字节
+ * 只跟踪通过它创建的文件的Sync情况，目录的修改视为立即持久化，不需要SyncDir
+ */
+type FaultFS struct {
+	FS
+	mu       sync.Mutex
+	writeErr error
+	// 上次崩溃后通过它创建的文件，以及该文件已Sync的字节数，从未Sync时为-1
+	synced map[string]int64
+	// 每次崩溃加一，之前打开的文件失效
+	epoch int
+}
+
+func NewFaultFS(base FS) *FaultFS {
+	return &FaultFS{FS: base, synced: make(map[string]int64)}
+}
+
+/* 之后的Create、Write、Sync和Rename都返回err，err为nil时恢复正常 */
+func (f *FaultFS) FailWrites(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.writeErr = err
+}
+
+func (f *FaultFS) checkWrite() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.writeErr
+}
+
+func (f *FaultFS) Create(name string) (File, error) {
+	if err := f.checkWrite(); err != nil {
+		return nil, err
+	}
+	file, err := f.FS.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.synced[path.Clean(name)] = -1
+	return &faultFile{File: file, fs: f, name: path.Clean(name), epoch: f.epoch}, nil
+}
+
+func (f *FaultFS) Open(name string) (File, error) {
+	file, err := f.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &faultFile{File: file, fs: f, name: path.Clean(name), epoch: f.epoch}, nil
+}
+
+func (f *FaultFS) Rename(oldname, newname string) error {
+	if err := f.checkWrite(); err != nil {
+		return err
+	}
+	if err := f.FS.Rename(oldname, newname); err != nil {
+		return err
+	}
+	oldname, newname = path.Clean(oldname), path.Clean(newname)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.synced, newname)
+	if n, ok := f.synced[oldname]; ok {
+		delete(f.synced, oldname)
+		f.synced[newname] = n
+	}
+	return nil
+}
+
+func (f *FaultFS) Link(oldname, newname string) error {
+	if err := f.checkWrite(); err != nil {
+		return err
+	}
+	if err := f.FS.Link(oldname, newname); err != nil {
+		return err
+	}
+	oldname, newname = path.Clean(oldname), path.Clean(newname)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// 新名称与原文件共享内容，崩溃时按原文件已Sync的长度处理
+	if n, ok := f.synced[oldname]; ok {
+		f.synced[newname] = n
+	}
+	return nil
+}
+
+func (f *FaultFS) Remove(name string) error {
+	if err := f.FS.Remove(name); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.synced, path.Clean(name))
+	return nil
+}
+
+/** 模拟断电后重启：通过它创建的文件截断到最后一次Sync时的长度，从未Sync的文件被删除
+ * 之前打开的文件之后的读写都返回ErrCrashed，注入的写入错误被清除
+ */
+func (f *FaultFS) Crash() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for name, n := range f.synced {
+		if n < 0 {
+			if err := f.FS.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			continue
+		}
+		if err := truncate(f.FS, name, n); err != nil {
+			return fmt.Errorf("truncate %s to %d bytes: %w", name, n, err)
+		}
+	}
+	f.synced = make(map[string]int64)
+	f.writeErr = nil
+	f.epoch++
+	return nil
+}
+
+/* 将文件中offset处的字节按位取反，模拟磁盘上的数据损坏 */
+func (f *FaultFS) Corrupt(name string, offset int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, err := readFile(f.FS, name)
+	if err != nil {
+		return err
+	}
+	if offset < 0 || offset >= int64(len(data)) {
+		return fmt.Errorf("corrupt %s: offset %d out of range", name, offset)
+	}
+	data[offset] ^= 0xff
+	return writeFile(f.FS, name, data)
+}
+
+type faultFile struct {
+	File
+	fs    *FaultFS
+	name  string
+	epoch int
+}
+
+func (f *faultFile) check(write bool) error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if f.epoch != f.fs.epoch {
+		return ErrCrashed
+	}
+	if write {
+		return f.fs.writeErr
+	}
+	return nil
+}
+
+func (f *faultFile) Read(p []byte) (int, error) {
+	if err := f.check(false); err != nil {
+		return 0, err
+	}
+	return f.File.Read(p)
+}
+
+func (f *faultFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.check(false); err != nil {
+		return 0, err
+	}
+	return f.File.ReadAt(p, off)
+}
+
+func (f *faultFile) Write(p []byte) (int, error) {
+	if err := f.check(true); err != nil {
+		return 0, err
+	}
+	return f.File.Write(p)
+}
+
+func (f *faultFile) Sync() error {
+	if err := f.check(true); err != nil {
+		return err
+	}
+	if err := f.File.Sync(); err != nil {
+		return err
+	}
+	info, err := f.File.Stat()
+	if err != nil {
+		return err
+	}
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if _, ok := f.fs.synced[f.name]; ok {
+		f.fs.synced[f.name] = info.Size()
+	}
+	return nil
+}
+
+func readFile(fs FS, name string) ([]byte, error) {
+	file, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+func writeFile(fs FS, name string, data []byte) error {
+	file, err := fs.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func truncate(fs FS, name string, size int64) error {
+	data, err := readFile(fs, name)
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) <= size {
+		return nil
+	}
+	return writeFile(fs, name, data[:size])
+}
@@ -0,0 +1,79 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func write(t *testing.T, f File, s string) {
+	_, err := f.Write([]byte(s))
+	assert.Nil(t, err)
+}
+
+func read(t *testing.T, fs FS, name string) string {
+	data, err := readFile(fs, name)
+	assert.Nil(t, err)
+	return string(data)
+}
+
+func TestFaultFSFailWrites(t *testing.T) {
+	fs := NewFaultFS(NewMem())
+	f, err := fs.Create("a")
+	assert.Nil(t, err)
+	injected := errors.New("injected")
+	fs.FailWrites(injected)
+	_, err = f.Write([]byte("x"))
+	assert.Equal(t, injected, err)
+	assert.Equal(t, injected, f.Sync())
+	_, err = fs.Create("b")
+	assert.Equal(t, injected, err)
+
+	fs.FailWrites(nil)
+	write(t, f, "x")
+	assert.Nil(t, f.Sync())
+	assert.Equal(t, "x", read(t, fs, "a"))
+}
+
+func TestFaultFSCrash(t *testing.T) {
+	base := NewMem()
+	fs := NewFaultFS(base)
+	synced, err := fs.Create("synced")
+	assert.Nil(t, err)
+	write(t, synced, "durable")
+	assert.Nil(t, synced.Sync())
+	write(t, synced, " lost")
+	unsynced, err := fs.Create("unsynced")
+	assert.Nil(t, err)
+	write(t, unsynced, "lost")
+	assert.Nil(t, unsynced.Close())
+	// 已Sync的文件重命名后仍然保留
+	assert.Nil(t, fs.Rename("synced", "renamed"))
+
+	assert.Nil(t, fs.Crash())
+	assert.Equal(t, "durable", read(t, fs, "renamed"))
+	_, err = fs.Open("unsynced")
+	assert.NotNil(t, err)
+	_, err = synced.Write([]byte("x"))
+	assert.Equal(t, ErrCrashed, err)
+
+	// 崩溃后重新打开的文件只包含已Sync的数据
+	f, err := fs.Open("renamed")
+	assert.Nil(t, err)
+	data, err := io.ReadAll(f)
+	assert.Nil(t, err)
+	assert.Equal(t, "durable", string(data))
+}
+
+func TestFaultFSCorrupt(t *testing.T) {
+	fs := NewFaultFS(NewMem())
+	f, err := fs.Create("a")
+	assert.Nil(t, err)
+	write(t, f, "abc")
+	assert.Nil(t, f.Sync())
+	assert.Nil(t, fs.Corrupt("a", 1))
+	assert.Equal(t, []byte{'a', 'b' ^ 0xff, 'c'}, []byte(read(t, fs, "a")))
+	assert.NotNil(t, fs.Corrupt("a", 3))
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package vfs
+
+import (
+	"errors"
+	"io"
+)
+
+func lockFile(name string) (io.Closer, error) {
+	return nil, errors.New("file locking is not supported on this platform")
+}
@@ -0,0 +1,23 @@
+//go:build unix
+
+package vfs
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+)
+
+func lockFile(name string) (io.Closer, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("lock %s: %w", name, err)
+	}
+	// 关闭文件即释放flock
+	return f, nil
+}
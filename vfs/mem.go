@@ -0,0 +1,285 @@
+package vfs
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/** 内存中的文件系统，可被多个线程并发调用
+ * 路径按path.Clean规范化，根目录总是存在，创建文件前其所在目录需已存在
+ */
+type memFS struct {
+	mu     sync.Mutex
+	files  map[string]*memNode
+	dirs   map[string]bool
+	locked map[string]bool
+}
+
+/* 文件的内容，被打开它的所有File共享 */
+type memNode struct {
+	mu      sync.RWMutex
+	data    []byte
+	modTime time.Time
+}
+
+func NewMem() FS {
+	return &memFS{
+		files:  make(map[string]*memNode),
+		dirs:   map[string]bool{".": true, "/": true},
+		locked: make(map[string]bool),
+	}
+}
+
+func (m *memFS) checkDir(name string) error {
+	if !m.dirs[path.Dir(name)] {
+		return &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return nil
+}
+
+func (m *memFS) Create(name string) (File, error) {
+	name = path.Clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkDir(name); err != nil {
+		return nil, err
+	}
+	n := &memNode{modTime: time.Now()}
+	m.files[name] = n
+	return &memFile{name: name, node: n, writable: true}, nil
+}
+
+func (m *memFS) Open(name string) (File, error) {
+	name = path.Clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, ok := m.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &memFile{name: name, node: n}, nil
+}
+
+func (m *memFS) Rename(oldname, newname string) error {
+	oldname, newname = path.Clean(oldname), path.Clean(newname)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, ok := m.files[oldname]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrNotExist}
+	}
+	if err := m.checkDir(newname); err != nil {
+		return err
+	}
+	delete(m.files, oldname)
+	m.files[newname] = n
+	return nil
+}
+
+func (m *memFS) Link(oldname, newname string) error {
+	oldname, newname = path.Clean(oldname), path.Clean(newname)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, ok := m.files[oldname]
+	if !ok {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: fs.ErrNotExist}
+	}
+	if _, ok := m.files[newname]; ok {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: fs.ErrExist}
+	}
+	if err := m.checkDir(newname); err != nil {
+		return err
+	}
+	m.files[newname] = n
+	return nil
+}
+
+func (m *memFS) Remove(name string) error {
+	name = path.Clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.files[name]; ok {
+		delete(m.files, name)
+		return nil
+	}
+	if m.dirs[name] {
+		prefix := name + "/"
+		for f := range m.files {
+			if strings.HasPrefix(f, prefix) {
+				return &fs.PathError{Op: "remove", Path: name, Err: fmt.Errorf("directory not empty")}
+			}
+		}
+		delete(m.dirs, name)
+		return nil
+	}
+	return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+}
+
+func (m *memFS) List(dir string) ([]string, error) {
+	dir = path.Clean(dir)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.dirs[dir] {
+		return nil, &fs.PathError{Op: "open", Path: dir, Err: fs.ErrNotExist}
+	}
+	var names []string
+	for f := range m.files {
+		if path.Dir(f) == dir {
+			names = append(names, path.Base(f))
+		}
+	}
+	for d := range m.dirs {
+		if d != dir && path.Dir(d) == dir {
+			names = append(names, path.Base(d))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (m *memFS) MkdirAll(dir string) error {
+	dir = path.Clean(dir)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for ; !m.dirs[dir]; dir = path.Dir(dir) {
+		if _, ok := m.files[dir]; ok {
+			return &fs.PathError{Op: "mkdir", Path: dir, Err: fs.ErrExist}
+		}
+		m.dirs[dir] = true
+	}
+	return nil
+}
+
+func (m *memFS) SyncDir(dir string) error {
+	dir = path.Clean(dir)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.dirs[dir] {
+		return &fs.PathError{Op: "sync", Path: dir, Err: fs.ErrNotExist}
+	}
+	return nil
+}
+
+func (m *memFS) Lock(name string) (io.Closer, error) {
+	name = path.Clean(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.locked[name] {
+		return nil, fmt.Errorf("lock %s: already locked", name)
+	}
+	if _, ok := m.files[name]; !ok {
+		if err := m.checkDir(name); err != nil {
+			return nil, err
+		}
+		m.files[name] = &memNode{modTime: time.Now()}
+	}
+	m.locked[name] = true
+	return &memLock{fs: m, name: name}, nil
+}
+
+type memLock struct {
+	fs   *memFS
+	name string
+	once sync.Once
+}
+
+func (l *memLock) Close() error {
+	l.once.Do(func() {
+		l.fs.mu.Lock()
+		delete(l.fs.locked, l.name)
+		l.fs.mu.Unlock()
+	})
+	return nil
+}
+
+type memFile struct {
+	name     string
+	node     *memNode
+	pos      int64
+	writable bool
+	closed   bool
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.pos)
+	f.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
+	f.node.mu.RLock()
+	defer f.node.mu.RUnlock()
+	if off >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.node.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
+	if !f.writable {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrPermission}
+	}
+	f.node.mu.Lock()
+	defer f.node.mu.Unlock()
+	if end := f.pos + int64(len(p)); end > int64(len(f.node.data)) {
+		f.node.data = append(f.node.data, make([]byte, end-int64(len(f.node.data)))...)
+	}
+	copy(f.node.data[f.pos:], p)
+	f.pos += int64(len(p))
+	f.node.modTime = time.Now()
+	return len(p), nil
+}
+
+func (f *memFile) Sync() error {
+	if f.closed {
+		return fs.ErrClosed
+	}
+	return nil
+}
+
+func (f *memFile) Close() error {
+	if f.closed {
+		return fs.ErrClosed
+	}
+	f.closed = true
+	return nil
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	f.node.mu.RLock()
+	defer f.node.mu.RUnlock()
+	return memFileInfo{name: path.Base(f.name), size: int64(len(f.node.data)), modTime: f.node.modTime}, nil
+}
+
+type memFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (i memFileInfo) Name() string       { return i.name }
+func (i memFileInfo) Size() int64        { return i.size }
+func (i memFileInfo) Mode() fs.FileMode  { return 0644 }
+func (i memFileInfo) ModTime() time.Time { return i.modTime }
+func (i memFileInfo) IsDir() bool        { return false }
+func (i memFileInfo) Sys() any           { return nil }
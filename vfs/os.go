@@ -0,0 +1,59 @@
+package vfs
+
+import (
+	"io"
+	"os"
+	"sort"
+)
+
+type osFS struct{}
+
+func (osFS) Create(name string) (File, error) {
+	return os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+}
+
+func (osFS) Open(name string) (File, error) {
+	return os.Open(name)
+}
+
+func (osFS) Rename(oldname, newname string) error {
+	return os.Rename(oldname, newname)
+}
+
+func (osFS) Link(oldname, newname string) error {
+	return os.Link(oldname, newname)
+}
+
+func (osFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (osFS) List(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name()
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (osFS) MkdirAll(dir string) error {
+	return os.MkdirAll(dir, 0755)
+}
+
+func (osFS) SyncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+func (osFS) Lock(name string) (io.Closer, error) {
+	return lockFile(name)
+}
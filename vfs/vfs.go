@@ -0,0 +1,42 @@
+package vfs
+
+import (
+	"io"
+	"io/fs"
+)
+
+/* 打开的文件，Create返回的文件可读写，Open返回的文件只能读 */
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Writer
+	io.Closer
+	/* 将已写入的数据持久化 */
+	Sync() error
+	Stat() (fs.FileInfo, error)
+}
+
+/** 文件系统，LSMTree读写的所有文件都通过它访问
+ * 除了默认的操作系统实现，还有用于测试的内存实现NewMem和注入故障的FaultFS
+ */
+type FS interface {
+	/* 创建文件，已存在时截断为空，以读写方式打开 */
+	Create(name string) (File, error)
+	/* 以只读方式打开文件 */
+	Open(name string) (File, error)
+	/* 重命名文件，newname已存在时被替换 */
+	Rename(oldname, newname string) error
+	/* 为文件创建一个硬链接，两个名称共享同一份内容，newname已存在时返回错误 */
+	Link(oldname, newname string) error
+	Remove(name string) error
+	/* 返回目录中的所有文件和子目录的名称，按名称排序 */
+	List(dir string) ([]string, error)
+	MkdirAll(dir string) error
+	/* 将目录中文件的创建、重命名和删除持久化 */
+	SyncDir(dir string) error
+	/* 以独占方式锁定文件，文件不存在时创建，已被锁定时立即返回错误，关闭返回的Closer释放锁 */
+	Lock(name string) (io.Closer, error)
+}
+
+/* 操作系统的文件系统 */
+var Default FS = osFS{}
@@ -0,0 +1,75 @@
+package vfs
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/* 操作系统和内存的实现行为相同 */
+func TestFS(t *testing.T) {
+	t.Run("os", func(t *testing.T) { testFS(t, Default, t.TempDir()) })
+	t.Run("mem", func(t *testing.T) { testFS(t, NewMem(), "/db") })
+}
+
+func testFS(t *testing.T, fs FS, dir string) {
+	assert.Nil(t, fs.MkdirAll(filepath.Join(dir, "sub")))
+	name := filepath.Join(dir, "a")
+	f, err := fs.Create(name)
+	assert.Nil(t, err)
+	_, err = f.Write([]byte("hello "))
+	assert.Nil(t, err)
+	_, err = f.Write([]byte("world"))
+	assert.Nil(t, err)
+	assert.Nil(t, f.Sync())
+	info, err := f.Stat()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(11), info.Size())
+	assert.Nil(t, f.Close())
+
+	f, err = fs.Open(name)
+	assert.Nil(t, err)
+	data, err := io.ReadAll(f)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello world", string(data))
+	buf := make([]byte, 5)
+	n, err := f.ReadAt(buf, 6)
+	assert.Nil(t, err)
+	assert.Equal(t, "world", string(buf[:n]))
+	_, err = f.Write([]byte("x"))
+	assert.NotNil(t, err)
+	assert.Nil(t, f.Close())
+
+	assert.Nil(t, fs.Rename(name, filepath.Join(dir, "b")))
+	_, err = fs.Open(name)
+	assert.NotNil(t, err)
+	assert.Nil(t, fs.Link(filepath.Join(dir, "b"), filepath.Join(dir, "sub", "c")))
+	assert.NotNil(t, fs.Link(filepath.Join(dir, "b"), filepath.Join(dir, "sub", "c")))
+	names, err := fs.List(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b", "sub"}, names)
+	assert.Nil(t, fs.SyncDir(dir))
+
+	_, err = fs.Create(filepath.Join(dir, "missing", "c"))
+	assert.NotNil(t, err)
+	assert.Nil(t, fs.Remove(filepath.Join(dir, "b")))
+	assert.NotNil(t, fs.Remove(filepath.Join(dir, "b")))
+	// 删除原名称后链接仍然可读
+	f, err = fs.Open(filepath.Join(dir, "sub", "c"))
+	assert.Nil(t, err)
+	data, err = io.ReadAll(f)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello world", string(data))
+	assert.Nil(t, f.Close())
+
+	lock, err := fs.Lock(filepath.Join(dir, "LOCK"))
+	assert.Nil(t, err)
+	_, err = fs.Lock(filepath.Join(dir, "LOCK"))
+	assert.NotNil(t, err)
+	assert.Nil(t, lock.Close())
+	lock, err = fs.Lock(filepath.Join(dir, "LOCK"))
+	assert.Nil(t, err)
+	assert.Nil(t, lock.Close())
+}